@@ -2,12 +2,14 @@
 package main
 
 import (
-	"log"
-	_ "net/http/pprof" // подключаем пакет pprof
+	"context"
+	"errors"
+	_ "net/http/pprof" // подключаем пакет pprof, доступен на сервере статуса
 
 	"github.com/netzen86/collectmetrics/config"
 	"github.com/netzen86/collectmetrics/internal/agent"
 	"github.com/netzen86/collectmetrics/internal/logger"
+	"github.com/netzen86/collectmetrics/internal/tracing"
 	"github.com/netzen86/collectmetrics/internal/utils"
 )
 
@@ -17,26 +19,35 @@ func main() {
 
 	utils.PrintBuildInfos()
 
-	agnlog, err := logger.Logger()
-	if err != nil {
-		log.Fatalf("error when get logger %v", err)
-	}
+	agnlog := logger.Logger()
 
 	// получаем конфиг агента
 	agentCfg, err = config.GetAgentCfg()
+	if errors.Is(err, config.ErrConfigPrinted) {
+		return
+	}
 	if err != nil {
 		agnlog.Fatalf("error on get configuration %v", err)
 	}
 
+	// уровень логирования переключается сигналом
+	go logger.WatchLevelSignal(agentCfg.AgentSCtx)
+
+	// настраиваем экспорт спанов трассировки
+	shutdownTracing, err := tracing.Setup(context.Background(), agentCfg.Tracing(), "collectmetrics-agent")
+	if err != nil {
+		agnlog.Fatalf("error when setup tracing %v", err)
+	}
+
 	// запускаем агента
 	err = agent.RunAgent(agentCfg)
 	if err != nil {
 		agnlog.Fatalf("agent don't send metrics %v", err)
 	}
 
-	// agnlog.Infoln("RUNNIG SRV FOR PROFILING")
-	// err = http.ListenAndServe(config.ProfilerAddr, nil)
-	// if err != nil {
-	// 	agnlog.Fatalf("error when start server %v ", err)
-	// }
+	// отправляем накопленные спаны
+	if err = shutdownTracing(context.Background()); err != nil {
+		agnlog.Errorf("error when shutdown tracing %v", err)
+	}
+	_ = logger.Sync()
 }
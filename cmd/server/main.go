@@ -5,17 +5,19 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
 
 	"github.com/netzen86/collectmetrics/config"
 	"github.com/netzen86/collectmetrics/internal/logger"
+	"github.com/netzen86/collectmetrics/internal/repositories"
 	"github.com/netzen86/collectmetrics/internal/repositories/db"
 	"github.com/netzen86/collectmetrics/internal/repositories/files"
 	"github.com/netzen86/collectmetrics/internal/router"
 	"github.com/netzen86/collectmetrics/internal/server"
+	"github.com/netzen86/collectmetrics/internal/tracing"
 	"github.com/netzen86/collectmetrics/internal/utils"
 )
 
@@ -27,19 +29,28 @@ func main() {
 	ctx := context.Background()
 
 	// инициализируем логер
-	srvlog, err := logger.Logger()
-	if err != nil {
-		log.Fatalf("error when get logger %v", err)
-	}
+	srvlog := logger.Logger()
 
 	// получаем конфиг сервера
-	err = cfg.GetServerCfg(srvlog)
+	err := cfg.GetServerCfg(srvlog)
+	if errors.Is(err, config.ErrConfigPrinted) {
+		return
+	}
 	if err != nil {
 		srvlog.Fatalf("error when getting config %v ", err)
 	}
 
+	// уровень логирования переключается сигналом
+	go logger.WatchLevelSignal(cfg.ServerCtx)
+
+	// настраиваем экспорт спанов трассировки
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing(), "collectmetrics-server")
+	if err != nil {
+		srvlog.Fatalf("error when setup tracing %v ", err)
+	}
+
 	// если хранилище база данных то создаем необходимые таблицы
-	_, dbstor := cfg.Storage.(*db.DBStorage)
+	_, dbstor := repositories.Unwrap(cfg.Storage).(*db.DBStorage)
 	if dbstor {
 		err = server.MakeDBMigrations(ctx, cfg, srvlog)
 		if err != nil {
@@ -62,6 +73,18 @@ func main() {
 			cfg.StoreInterval, cfg.ServerCtx, cfg.Wg, srvlog)
 	}
 
+	// вычисляем правила записи
+	if cfg.Recording != nil {
+		cfg.Wg.Add(1)
+		go cfg.Recording.Run(cfg.ServerCtx, cfg.Wg)
+	}
+
+	// проверяем правила оповещения
+	if cfg.Alerts != nil {
+		cfg.Wg.Add(1)
+		go cfg.Alerts.Run(cfg.ServerCtx, cfg.Wg)
+	}
+
 	srvlog.Infoln("!!! SERVER START !!!")
 
 	// получаем роутер
@@ -75,8 +98,16 @@ func main() {
 	}
 	gSRV := server.GetgRPCSrv(cfg)
 
+	// запускаем прием метрик graphite
+	if cfg.Graphite != nil {
+		err = cfg.Graphite.Start(cfg.ServerCtx)
+		if err != nil {
+			srvlog.Fatalf("error when start graphite listener %v", err)
+		}
+	}
+
 	go server.GracefulSrv(cfg.Sig, cfg.ServerCtx,
-		cfg.ServerStopCtx, httpServer, gSRV, srvlog)
+		cfg.ServerStopCtx, httpServer, gSRV, cfg.Graphite, srvlog)
 
 	go func() {
 		if err = gSRV.Serve(listen); err != nil {
@@ -91,4 +122,17 @@ func main() {
 	}
 	<-cfg.ServerCtx.Done()
 	cfg.Wg.Wait()
+
+	// закрываем журнал аудита после остановки приема метрик
+	if cfg.Audit != nil {
+		if err = cfg.Audit.Close(); err != nil {
+			srvlog.Errorf("error when close audit log %v ", err)
+		}
+	}
+
+	// отправляем накопленные спаны
+	if err = shutdownTracing(ctx); err != nil {
+		srvlog.Errorf("error when shutdown tracing %v ", err)
+	}
+	_ = logger.Sync()
 }
@@ -5,171 +5,172 @@
 package config
 
 import (
-	"bufio"
 	"context"
 	"crypto/rsa"
-	"encoding/json"
 	"fmt"
 	"math/big"
 	"os"
 	"os/signal"
-	"strconv"
+	"reflect"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/spf13/pflag"
 	"go.uber.org/zap"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 
-	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/aggregate"
+	"github.com/netzen86/collectmetrics/internal/cfgload"
+	"github.com/netzen86/collectmetrics/internal/collectors"
 	"github.com/netzen86/collectmetrics/internal/logger"
 	"github.com/netzen86/collectmetrics/internal/security"
+	"github.com/netzen86/collectmetrics/internal/telemetry"
+	"github.com/netzen86/collectmetrics/internal/tracing"
 	"github.com/netzen86/collectmetrics/internal/utils"
-	pb "github.com/netzen86/collectmetrics/proto/server"
 )
 
 // константы используещиеся для работы Агента
 const (
-	addressServerAgent string        = "localhost:8080"
-	AgentgRPCEndpoint  string        = "localhost:3200"
-	AgentgRPCProto     string        = "tcp"
-	EnablegRPC         bool          = false
-	pollInterval       time.Duration = 5
-	reportInterval     time.Duration = 0
-	ratelimit          int           = 5
-	envPI              string        = "POLL_INTERVAL"
-	envRI              string        = "REPORT_INTERVAL"
-	envRL              string        = "RATE_LIMIT"
-	envPUBKEY          string        = "CRYPTO_KEY"
-	UpdateAddress      string        = "http://%s/update/"
-	UpdatesAddress     string        = "http://%s/updates/"
-	ProfilerAddr       string        = "localhost:8081"
-	Alloc              string        = "Alloc"
-	BuckHashSys        string        = "BuckHashSys"
-	Frees              string        = "Frees"
-	GCCPUFraction      string        = "GCCPUFraction"
-	GCSys              string        = "GCSys"
-	HeapAlloc          string        = "HeapAlloc"
-	HeapIdle           string        = "HeapIdle"
-	HeapInuse          string        = "HeapInuse"
-	HeapObjects        string        = "HeapObjects"
-	HeapReleased       string        = "HeapReleased"
-	HeapSys            string        = "HeapSys"
-	LastGC             string        = "LastGC"
-	Lookups            string        = "Lookups"
-	MCacheInuse        string        = "MCacheInuse"
-	MCacheSys          string        = "MCacheSys"
-	MSpanInuse         string        = "MSpanInuse"
-	MSpanSys           string        = "MSpanSys"
-	Mallocs            string        = "Mallocs"
-	NextGC             string        = "NextGC"
-	NumForcedGC        string        = "NumForcedGC"
-	NumGC              string        = "NumGC"
-	OtherSys           string        = "OtherSys"
-	PauseTotalNs       string        = "PauseTotalNs"
-	StackInuse         string        = "StackInuse"
-	StackSys           string        = "StackSys"
-	Sys                string        = "Sys"
-	TotalAlloc         string        = "TotalAlloc"
-	PollCount          string        = "PollCount"
-	RandomValue        string        = "RandomValue"
-	TotalMemory        string        = "TotalMemory"
-	FreeMemory         string        = "FreeMemory"
-	CPUutilization1    string        = "CPUutilization1"
+	UpdateAddress   string = "http://%s/update/"
+	UpdatesAddress  string = "http://%s/updates/"
+	ProfilerAddr    string = "localhost:8081"
+	Alloc           string = "Alloc"
+	BuckHashSys     string = "BuckHashSys"
+	Frees           string = "Frees"
+	GCCPUFraction   string = "GCCPUFraction"
+	GCSys           string = "GCSys"
+	HeapAlloc       string = "HeapAlloc"
+	HeapIdle        string = "HeapIdle"
+	HeapInuse       string = "HeapInuse"
+	HeapObjects     string = "HeapObjects"
+	HeapReleased    string = "HeapReleased"
+	HeapSys         string = "HeapSys"
+	LastGC          string = "LastGC"
+	Lookups         string = "Lookups"
+	MCacheInuse     string = "MCacheInuse"
+	MCacheSys       string = "MCacheSys"
+	MSpanInuse      string = "MSpanInuse"
+	MSpanSys        string = "MSpanSys"
+	Mallocs         string = "Mallocs"
+	NextGC          string = "NextGC"
+	NumForcedGC     string = "NumForcedGC"
+	NumGC           string = "NumGC"
+	OtherSys        string = "OtherSys"
+	PauseTotalNs    string = "PauseTotalNs"
+	StackInuse      string = "StackInuse"
+	StackSys        string = "StackSys"
+	Sys             string = "Sys"
+	TotalAlloc      string = "TotalAlloc"
+	PollCount       string = "PollCount"
+	RandomValue     string = "RandomValue"
+	TotalMemory     string = "TotalMemory"
+	FreeMemory      string = "FreeMemory"
+	CPUutilization1 string = "CPUutilization1"
 )
 
-type configAgnFile struct {
-	Adderss    string `json:"address,omitempty"`
-	CryKey     string `json:"crypto_key,omitempty"`
-	RepInterv  int    `json:"report_interval,omitempty"`
-	PolIntervv int    `json:"poll_interval,omitempty"`
-}
-
-// AgentCfg структура для конфигурации Агента
+// AgentCfg структура для конфигурации Агента.
+// Теги flag, env, file и DefVal разбирает пакет cfgload.
 type AgentCfg struct {
-	AgentSCtx         context.Context    `env:"" DefVal:""`
-	AgentPCtx         context.Context    `env:"" DefVal:""`
-	CligRPC           pb.MetricClient    `env:"" DefVal:""`
-	Logger            zap.SugaredLogger  `env:"" DefVal:""`
-	PubKey            *rsa.PublicKey     `env:"" DefVal:""`
-	Sig               chan os.Signal     `env:"" DefVal:""`
-	AgentSStopCtx     context.CancelFunc `env:"" DefVal:""`
-	AgentPStopCtx     context.CancelFunc `env:"" DefVal:""`
-	AgnFileCfg        string             `env:"" DefVal:""`
-	ContentEncoding   string             `env:"" DefVal:""`
-	PublicKeyFilename string             `env:"CRYPTO_KEY" DefVal:""`
-	Endpoint          string             `env:"ADDRESS" DefVal:"localhost:8080"`
-	LocalIP           string             `env:"" DefVal:""`
-	SignKeyString     string             `env:"KEY" DefVal:""`
-	PollInterval      int                `env:"POLL_INTERVAL" DefVal:"5"`
-	ReportInterval    int                `env:"REPORT_INTERVAL" DefVal:"0"`
-	RateLimit         int                `env:"RATE_LIMIT" DefVal:"5"`
-	PollTik           time.Duration      `env:"" DefVal:""`
-	ReportTik         time.Duration      `env:"" DefVal:""`
-	EnablegRPC        bool               `env:"" DefVal:""`
+	AgentSCtx         context.Context            `env:"" DefVal:""`
+	AgentPCtx         context.Context            `env:"" DefVal:""`
+	Logger            zap.SugaredLogger          `env:"" DefVal:""`
+	PubKey            *rsa.PublicKey             `env:"" DefVal:""`
+	Stats             *telemetry.AgentStats      `env:"" DefVal:""`
+	Sig               chan os.Signal             `env:"" DefVal:""`
+	AgentSStopCtx     context.CancelFunc         `env:"" DefVal:""`
+	AgentPStopCtx     context.CancelFunc         `env:"" DefVal:""`
+	Collectors        []collectors.Collector     `env:"" DefVal:""`
+	Endpoints         []Endpoint                 `env:"" DefVal:""`
+	EndpointsCfg      []EndpointCfg              `file:"endpoints" env:"" DefVal:""`
+	ScrapeTargets     []collectors.ScrapeTarget  `file:"scrape" env:"" DefVal:""`
+	ProcessTargets    []collectors.ProcessTarget `file:"processes" env:"" DefVal:""`
+	ExecCommands      []collectors.ExecCommand   `file:"exec" env:"" DefVal:""`
+	LogTail           collectors.LogTailConfig   `file:"logtail" env:"" DefVal:""`
+	Cgroup            collectors.CgroupConfig    `file:"cgroup" env:"" DefVal:""`
+	Runtime           collectors.RuntimeConfig   `file:"runtime" env:"" DefVal:""`
+	Retry             utils.RetryPolicy          `file:"retry" env:"" DefVal:""`
+	Breaker           BreakerCfg                 `file:"breaker" env:"" DefVal:""`
+	Aggregation       aggregate.Config           `file:"aggregation" env:"" DefVal:""`
+	Log               logger.Config              `file:"log" env:"" DefVal:""`
+	AgnFileCfg        string                     `flag:"config,c" env:"CONFIG" DefVal:"" configfile:"true" usage:"Load configuration from file, JSON or YAML by extension."`
+	ContentEncoding   string                     `flag:"contentenc,e" env:"" DefVal:"gzip" usage:"Used to set content encoding to connect server."`
+	PublicKeyFilename string                     `flag:"crypto-key,s" env:"CRYPTO_KEY" file:"crypto_key" DefVal:"" usage:"Load public key for encrypting."`
+	Endpoint          string                     `flag:"endpoint,a" env:"ADDRESS" file:"address" DefVal:"localhost:8080" usage:"Used to set the address and port to connect server."`
+	LocalIP           string                     `env:"" DefVal:""`
+	SignKeyString     string                     `flag:"signkeystring,k" env:"KEY" file:"key" DefVal:"" secret:"true" usage:"Used to set key for calc hash."`
+	StatusAddr        string                     `flag:"status-addr" env:"STATUS_ADDRESS" file:"status_address" DefVal:"localhost:8081" empty:"true" usage:"Used to set address of local status server, empty to disable."`
+	SendMode          string                     `flag:"send-mode" env:"SEND_MODE" file:"send_mode" DefVal:"failover" oneof:"failover,fanout" usage:"Used to set sending to several servers: failover or fanout."`
+	TraceFile         string                     `flag:"trace-file" env:"TRACE_FILE" file:"trace_file" DefVal:"" usage:"Write trace spans to file."`
+	TraceEndpoint     string                     `flag:"trace-endpoint" env:"TRACE_ENDPOINT" file:"trace_endpoint" DefVal:"" usage:"Send trace spans to OTLP/HTTP endpoint, e.g. http://localhost:4318."`
+	Token             string                     `flag:"token" env:"AUTH_TOKEN" file:"token" DefVal:"" secret:"true" usage:"Used to set access token sent to server."`
+	PollInterval      int                        `flag:"pollinterval,p" env:"POLL_INTERVAL" file:"poll_interval" DefVal:"5" unit:"s" min:"1" usage:"Used to set poll interval, seconds or duration like 1m."`
+	ReportInterval    int                        `flag:"reportinterval,r" env:"REPORT_INTERVAL" file:"report_interval" DefVal:"0" unit:"s" min:"0" usage:"Used to set report interval (send to srv), seconds or duration like 1m."`
+	RateLimit         int                        `flag:"ratelimit,l" env:"RATE_LIMIT" file:"rate_limit" DefVal:"5" min:"1" max:"32" usage:"Used to set limit of concurrent requests to server."`
+	PollTik           time.Duration              `env:"" DefVal:""`
+	ReportTik         time.Duration              `env:"" DefVal:""`
+	EnablegRPC        bool                       `flag:"enablegrpc,g" env:"" DefVal:"false" usage:"Use to enable send metiric via gRPC."`
+	PrintConfig       bool                       `env:"" DefVal:"false"`
+	reload            *agentReload
 }
 
-// GetgRPCCli функция для создания клиента gRPC сервера
-func GetgRPCCli() (pb.MetricClient, error) {
-	// устанавливаем соединение с сервером
-	conn, err := grpc.NewClient(AgentgRPCEndpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		return nil, fmt.Errorf("error when connect to server %w", err)
-	}
-	// получаем переменную интерфейсного типа MetricClient,
-	// через которую будем отправлять сообщения
-	cli := pb.NewMetricClient(conn)
-	return cli, nil
+// структура с данными для перечитывания конфигурации агента по SIGHUP
+type agentReload struct {
+	// актуальная конфигурация
+	current atomic.Pointer[AgentCfg]
+	// конфигурация полученная из флагов
+	flags AgentCfg
+	// загрузчик помнит какие поля заданы флагами
+	loader *cfgload.Loader
 }
 
-// функция для получения параметров запуска агента из файла формата json
-func getAgnCfgFile(agentCfg *AgentCfg) error {
-	var agnCfg configAgnFile
-	config, err := os.Open(agentCfg.AgnFileCfg)
-	if err != nil {
-		return fmt.Errorf("error when read server config file %w", err)
-	}
-	defer func() {
-		err = config.Close()
+// функция для создания дополнительных сборщиков метрик
+func initCollectors(agentCfg *AgentCfg) error {
+	agentCfg.Collectors = nil
+
+	if len(agentCfg.ScrapeTargets) != 0 {
+		scraper, err := collectors.NewScraper(agentCfg.ScrapeTargets)
 		if err != nil {
-			agentCfg.Logger.Infof("error when close agent cfg %v", err)
+			return fmt.Errorf("error when create scraper %w", err)
 		}
-	}()
-
-	fileinfo, _ := config.Stat()
-	cfgBytes := make([]byte, fileinfo.Size())
-	buffer := bufio.NewReader(config)
-	_, err = buffer.Read(cfgBytes)
-	if err != nil {
-		return fmt.Errorf("error when read config file %w", err)
-	}
-	err = json.Unmarshal(cfgBytes, &agnCfg)
-	if err != nil {
-		return fmt.Errorf("error when unmarshal config %w", err)
+		agentCfg.Collectors = append(agentCfg.Collectors, scraper)
 	}
 
-	if agentCfg.Endpoint == addressServerAgent && len(agnCfg.Adderss) != 0 {
-		agentCfg.Endpoint = agnCfg.Adderss
+	if len(agentCfg.ProcessTargets) != 0 {
+		procCollector, err := collectors.NewProcessCollector(agentCfg.ProcessTargets)
+		if err != nil {
+			return fmt.Errorf("error when create process collector %w", err)
+		}
+		agentCfg.Collectors = append(agentCfg.Collectors, procCollector)
 	}
-	if agentCfg.ReportInterval == int(reportInterval) {
-		agentCfg.ReportInterval = agnCfg.RepInterv
+
+	if len(agentCfg.ExecCommands) != 0 {
+		execCollector, err := collectors.NewExecCollector(agentCfg.ExecCommands)
+		if err != nil {
+			return fmt.Errorf("error when create exec collector %w", err)
+		}
+		agentCfg.Collectors = append(agentCfg.Collectors, execCollector)
 	}
-	if agentCfg.PollInterval == int(pollInterval) {
-		agentCfg.PollInterval = agnCfg.PolIntervv
+
+	if len(agentCfg.LogTail.Files) != 0 {
+		tailer, err := collectors.NewLogTailer(agentCfg.LogTail)
+		if err != nil {
+			return fmt.Errorf("error when create log tailer %w", err)
+		}
+		agentCfg.Collectors = append(agentCfg.Collectors, tailer)
 	}
-	if len(agentCfg.PublicKeyFilename) == 0 && len(agnCfg.CryKey) != 0 {
-		agentCfg.PublicKeyFilename = agnCfg.CryKey
+
+	if agentCfg.Cgroup.Enabled {
+		cgroupCollector, err := collectors.NewCgroupCollector(agentCfg.Cgroup)
+		if err != nil {
+			return fmt.Errorf("error when create cgroup collector %w", err)
+		}
+		agentCfg.Collectors = append(agentCfg.Collectors, cgroupCollector)
 	}
-	return nil
-}
 
-func validRateLimit(ratelimit int, logger zap.SugaredLogger) bool {
-	if ratelimit == 0 || ratelimit > 32 {
-		logger.Infoln("rate limit must be greater than 0 and less than 32")
-		return false
+	if agentCfg.Runtime.Enabled {
+		agentCfg.Collectors = append(agentCfg.Collectors, collectors.NewRuntimeCollector(agentCfg.Runtime))
 	}
-	return true
+	return nil
 }
 
 func GracefulShutAgent(agentCfg *AgentCfg) {
@@ -183,7 +184,8 @@ func GracefulShutAgent(agentCfg *AgentCfg) {
 
 	// Listen for syscall signals for process to interrupt/quit
 	agentCfg.Sig = make(chan os.Signal, 1)
-	signal.Notify(agentCfg.Sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	// SIGHUP используется для перечитывания конфигурации
+	signal.Notify(agentCfg.Sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
 }
 
 // GetAgentCfg функция получения конфигурации агента.
@@ -193,103 +195,216 @@ func GetAgentCfg() (AgentCfg, error) {
 
 	GracefulShutAgent(&agentCfg)
 
-	agentCfg.Logger, err = logger.Logger()
-	if err != nil {
-		return AgentCfg{}, fmt.Errorf("error when get agent logger %w", err)
-	}
-
-	// опредаляем флаги
-	pflag.StringVarP(&agentCfg.Endpoint, "endpoint", "a", addressServerAgent, "Used to set the address and port to connect server.")
-	pflag.StringVarP(&agentCfg.ContentEncoding, "contentenc", "e", api.Gz, "Used to set content encoding to connect server.")
-	pflag.StringVarP(&agentCfg.SignKeyString, "signkeystring", "k", "", "Used to set key for calc hash.")
-	pflag.StringVarP(&agentCfg.PublicKeyFilename, "crypto-key", "s", "", "Load public key for encrypting.")
-	pflag.StringVarP(&agentCfg.AgnFileCfg, "config", "c", "", "Load configuration from file.")
-	pflag.IntVarP(&agentCfg.PollInterval, "pollinterval", "p", int(pollInterval), "User for set poll interval in seconds.")
-	pflag.IntVarP(&agentCfg.ReportInterval, "reportinterval", "r", int(reportInterval), "User for set report interval (send to srv) in seconds.")
-	pflag.IntVarP(&agentCfg.RateLimit, "ratelimit", "l", ratelimit, "User for set report interval (send to srv) in seconds.")
-	pflag.BoolVarP(&agentCfg.EnablegRPC, "enablegrpc", "g", EnablegRPC, "Use to enable send metiric via gRPC.")
-	pflag.Parse()
+	agentCfg.Logger = logger.Logger()
 
-	if len(agentCfg.AgnFileCfg) != 0 {
-		err = getAgnCfgFile(&agentCfg)
-		if err != nil {
-			return AgentCfg{}, fmt.Errorf("when get gonfig from file %w", err)
-		}
+	// счетчики самодиагностики переживают перечитывание конфигурации
+	agentCfg.Stats = telemetry.NewAgentStats()
+
+	// опредаляем флаги по тегам конфигурации
+	loader, err := cfgload.New(&agentCfg)
+	if err != nil {
+		return AgentCfg{}, fmt.Errorf("error when parse config tags %w", err)
+	}
+	err = loader.Defaults(&agentCfg)
+	if err != nil {
+		return AgentCfg{}, err
+	}
+	err = loader.BindPFlags(pflag.CommandLine, &agentCfg)
+	if err != nil {
+		return AgentCfg{}, err
 	}
+	pflag.BoolVar(&agentCfg.PrintConfig, "print-config", false, "Print effective configuration with secrets redacted and exit.")
+	pflag.Parse()
 
 	// если переданы аргументы не флаги печатаем подсказку
 	if len(pflag.Args()) != 0 {
 		pflag.PrintDefaults()
 		return AgentCfg{}, fmt.Errorf("accept only dash flags")
 	}
-	// получаем данные для работы програмы из переменных окружения
-	// переменные окружения имеют наивысший приоритет
-	if len(os.Getenv(envAdd)) != 0 {
-		agentCfg.Endpoint = os.Getenv(envAdd)
+
+	// запоминаем значения флагов, при перечитывании конфигурации
+	// файл и переменные окружения применяются поверх них
+	agentCfg.reload = &agentReload{flags: agentCfg, loader: loader}
+
+	err = agentCfg.applyCfg()
+	if err != nil {
+		return AgentCfg{}, err
 	}
-	// получение интервала сбора метрик
-	if len(os.Getenv(envPI)) != 0 {
-		agentCfg.PollInterval, err = strconv.Atoi(os.Getenv(envPI))
+
+	if agentCfg.PrintConfig {
+		err = loader.Print(os.Stdout, &agentCfg)
 		if err != nil {
-			return AgentCfg{}, fmt.Errorf("error atoi poll interval %v ", err)
+			return AgentCfg{}, fmt.Errorf("error when print config %w", err)
 		}
+		return AgentCfg{}, ErrConfigPrinted
 	}
 
-	// получение интервала отправки метрик
-	if len(os.Getenv(envRI)) != 0 {
-		agentCfg.ReportInterval, err = strconv.Atoi(os.Getenv(envRI))
-		if err != nil {
-			return AgentCfg{}, fmt.Errorf("error atoi report interval %v ", err)
-		}
+	// настраиваем общий логгер, ранее полученные логгеры пишут по новым параметрам
+	err = logger.Setup(agentCfg.Log)
+	if err != nil {
+		return AgentCfg{}, fmt.Errorf("error setup logger %w ", err)
 	}
 
-	// получение лимита отправки метрик
-	if len(os.Getenv(envRL)) != 0 {
-		agentCfg.RateLimit, err = strconv.Atoi(os.Getenv(envRI))
-		if err != nil {
-			return AgentCfg{}, fmt.Errorf("error atoi report interval %w ", err)
-		}
+	err = agentCfg.Aggregation.Validate()
+	if err != nil {
+		return AgentCfg{}, fmt.Errorf("error in aggregation config %w ", err)
+	}
+
+	err = agentCfg.Retry.Validate()
+	if err != nil {
+		return AgentCfg{}, fmt.Errorf("error in retry config %w ", err)
 	}
 
-	// получение ключа для генерации подписи при отправки данных
-	if len(os.Getenv(envKey)) != 0 {
-		agentCfg.SignKeyString = os.Getenv(envKey)
+	err = agentCfg.Breaker.validate()
+	if err != nil {
+		return AgentCfg{}, fmt.Errorf("error in breaker config %w ", err)
 	}
 
-	// получение публичого ключа для шифрованния
-	if len(os.Getenv(envPUBKEY)) != 0 {
-		agentCfg.PublicKeyFilename = os.Getenv(envPUBKEY)
+	agentCfg.LocalIP, err = utils.GetLocalIP(agentCfg.Logger)
+	if err != nil {
+		return AgentCfg{}, fmt.Errorf("error when getting local ip %w ", err)
+	}
+
+	// серверы для отправки метрик
+	err = initEndpoints(&agentCfg, nil)
+	if err != nil {
+		return AgentCfg{}, fmt.Errorf("error when init endpoints %w ", err)
+	}
+
+	// создание дополнительных сборщиков метрик
+	err = initCollectors(&agentCfg)
+	if err != nil {
+		return AgentCfg{}, fmt.Errorf("error when init collectors %w ", err)
+	}
+
+	current := agentCfg
+	agentCfg.reload.current.Store(&current)
+
+	return agentCfg, nil
+}
+
+// метод применяет к значениям флагов файл конфигурации и переменные окружения,
+// проверяет значения по тегам, считывает публичный ключ и устанавливает интервалы
+func (agentCfg *AgentCfg) applyCfg() error {
+	var err error
+
+	// значения флагов дополняются файлом конфигурации и переменными окружения,
+	// переменные окружения имеют наивысший приоритет
+	err = agentCfg.reload.loader.Load(agentCfg)
+	if err != nil {
+		return fmt.Errorf("error load config %w", err)
 	}
 
 	if len(agentCfg.PublicKeyFilename) != 0 {
 		agentCfg.PubKey, err = security.ReadPublicKey(agentCfg.PublicKeyFilename, agentCfg.Logger)
 		if err != nil {
-			return AgentCfg{}, fmt.Errorf("error reading public key %w ", err)
+			return fmt.Errorf("error reading public key %w ", err)
 		}
 	} else {
 		agentCfg.PubKey = &rsa.PublicKey{N: big.NewInt(0), E: 0}
 	}
 
-	agentCfg.LocalIP, err = utils.GetLocalIP(agentCfg.Logger)
+	// установка интервалов получения и отправки метрик
+	agentCfg.PollTik = time.Duration(agentCfg.PollInterval) * time.Second
+	agentCfg.ReportTik = time.Duration(agentCfg.ReportInterval) * time.Second
+
+	return nil
+}
+
+// метод проверяет значения которые не описываются тегами
+func (agentCfg *AgentCfg) validate() error {
+	if len(agentCfg.Endpoint) == 0 && len(agentCfg.EndpointsCfg) == 0 {
+		return fmt.Errorf("endpoint is empty")
+	}
+	if err := agentCfg.Aggregation.Validate(); err != nil {
+		return fmt.Errorf("aggregation %w", err)
+	}
+	if err := agentCfg.Retry.Validate(); err != nil {
+		return fmt.Errorf("retry %w", err)
+	}
+	if err := agentCfg.Breaker.validate(); err != nil {
+		return err
+	}
+	if err := agentCfg.Log.Validate(); err != nil {
+		return fmt.Errorf("log %w", err)
+	}
+	return nil
+}
+
+// Current метод возвращает актуальную конфигурацию агента
+// с учетом перечитываний по SIGHUP
+func (agentCfg AgentCfg) Current() AgentCfg {
+	if agentCfg.reload == nil {
+		return agentCfg
+	}
+	current := agentCfg.reload.current.Load()
+	if current == nil {
+		return agentCfg
+	}
+	return *current
+}
+
+// ReloadAgentCfg функция перечитывает файл конфигурации и переменные окружения.
+// Если новая конфигурация некорректна возвращается ошибка, а текущая конфигурация
+// остается в силе. Сборщики метрик пересоздаются только если изменились их настройки.
+func ReloadAgentCfg(agentCfg AgentCfg) (AgentCfg, error) {
+	var err error
+
+	if agentCfg.reload == nil {
+		return AgentCfg{}, fmt.Errorf("agent config does not support reload")
+	}
+	current := agentCfg.Current()
+
+	newCfg := agentCfg.reload.flags
+	newCfg.reload = agentCfg.reload
+	newCfg.LocalIP = current.LocalIP
+
+	err = newCfg.applyCfg()
 	if err != nil {
-		return AgentCfg{}, fmt.Errorf("error when getting local ip %w ", err)
+		return AgentCfg{}, err
+	}
+	err = newCfg.validate()
+	if err != nil {
+		return AgentCfg{}, fmt.Errorf("invalid config %w", err)
 	}
 
-	if !validRateLimit(agentCfg.RateLimit, agentCfg.Logger) {
-		agentCfg.Logger.Infoln("setting rate limit to default value = 5")
-		agentCfg.RateLimit = ratelimit
+	// параметры логирования применяются без перезапуска агента
+	if newCfg.Log != current.Log {
+		err = logger.Setup(newCfg.Log)
+		if err != nil {
+			return AgentCfg{}, fmt.Errorf("error setup logger %w ", err)
+		}
 	}
 
-	if agentCfg.EnablegRPC {
-		agentCfg.CligRPC, err = GetgRPCCli()
+	err = initEndpoints(&newCfg, current.Endpoints)
+	if err != nil {
+		return AgentCfg{}, fmt.Errorf("error when init endpoints %w ", err)
+	}
+
+	if sameCollectorsCfg(current, newCfg) {
+		newCfg.Collectors = current.Collectors
+	} else {
+		err = initCollectors(&newCfg)
 		if err != nil {
-			return AgentCfg{}, fmt.Errorf("error when connecting gRPC Server %w ", err)
+			return AgentCfg{}, fmt.Errorf("error when init collectors %w ", err)
 		}
 	}
 
-	// установка интервалов получения и отправки метрик
-	agentCfg.PollTik = time.Duration(agentCfg.PollInterval) * time.Second
-	agentCfg.ReportTik = time.Duration(agentCfg.ReportInterval) * time.Second
+	agentCfg.reload.current.Store(&newCfg)
+	return newCfg, nil
+}
 
-	return agentCfg, nil
+// функция сравнивает настройки дополнительных сборщиков метрик
+func sameCollectorsCfg(oldCfg, newCfg AgentCfg) bool {
+	return reflect.DeepEqual(oldCfg.ScrapeTargets, newCfg.ScrapeTargets) &&
+		reflect.DeepEqual(oldCfg.ProcessTargets, newCfg.ProcessTargets) &&
+		reflect.DeepEqual(oldCfg.ExecCommands, newCfg.ExecCommands) &&
+		reflect.DeepEqual(oldCfg.LogTail, newCfg.LogTail) &&
+		reflect.DeepEqual(oldCfg.Cgroup, newCfg.Cgroup) &&
+		reflect.DeepEqual(oldCfg.Runtime, newCfg.Runtime)
+}
+
+// Tracing метод возвращает параметры экспорта спанов трассировки
+func (agentCfg AgentCfg) Tracing() tracing.Config {
+	return tracing.Config{File: agentCfg.TraceFile, Endpoint: agentCfg.TraceEndpoint}
 }
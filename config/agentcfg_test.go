@@ -0,0 +1,173 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netzen86/collectmetrics/internal/cfgload"
+	"github.com/netzen86/collectmetrics/internal/logger"
+)
+
+func TestReloadAgentCfg(t *testing.T) {
+	for _, env := range []string{"ADDRESS", "POLL_INTERVAL", "REPORT_INTERVAL", "RATE_LIMIT", "KEY",
+		"CRYPTO_KEY", "SEND_MODE", "CONFIG"} {
+		t.Setenv(env, "")
+	}
+	testLogger := logger.Logger()
+
+	cfgFile := filepath.Join(t.TempDir(), "agent.json")
+	writeCfg := func(data string) {
+		require.NoError(t, os.WriteFile(cfgFile, []byte(data), 0644))
+	}
+	writeCfg(`{"address":"localhost:8081","poll_interval":2}`)
+
+	// значения по умолчанию берутся из тегов DefVal
+	var agentCfg AgentCfg
+	loader, err := cfgload.New(&agentCfg)
+	require.NoError(t, err)
+	require.NoError(t, loader.Defaults(&agentCfg))
+	agentCfg.Logger = testLogger
+	agentCfg.AgnFileCfg = cfgFile
+	agentCfg.reload = &agentReload{flags: agentCfg, loader: loader}
+	require.NoError(t, agentCfg.applyCfg())
+	current := agentCfg
+	agentCfg.reload.current.Store(&current)
+
+	t.Run("valid config applied", func(t *testing.T) {
+		writeCfg(`{"address":"localhost:8082","poll_interval":3,"report_interval":7}`)
+		_, err := ReloadAgentCfg(agentCfg)
+		require.NoError(t, err)
+		assert.Equal(t, "localhost:8082", agentCfg.Current().Endpoint)
+		assert.Equal(t, 3*time.Second, agentCfg.Current().PollTik)
+		assert.Equal(t, 7*time.Second, agentCfg.Current().ReportTik)
+	})
+
+	t.Run("broken json rejected", func(t *testing.T) {
+		writeCfg(`{"address":`)
+		_, err := ReloadAgentCfg(agentCfg)
+		assert.Error(t, err)
+		assert.Equal(t, "localhost:8082", agentCfg.Current().Endpoint)
+	})
+
+	t.Run("invalid collector rejected", func(t *testing.T) {
+		writeCfg(`{"address":"localhost:8083","scrape":[{"name":"remote","url":"http://example.com/metrics"}]}`)
+		_, err := ReloadAgentCfg(agentCfg)
+		assert.Error(t, err)
+		assert.Equal(t, "localhost:8082", agentCfg.Current().Endpoint)
+	})
+
+	t.Run("collectors kept when unchanged", func(t *testing.T) {
+		writeCfg(`{"processes":[{"name":"self","process":"agent"}]}`)
+		first, err := ReloadAgentCfg(agentCfg)
+		require.NoError(t, err)
+		writeCfg(`{"poll_interval":4,"processes":[{"name":"self","process":"agent"}]}`)
+		second, err := ReloadAgentCfg(agentCfg)
+		require.NoError(t, err)
+		require.Len(t, second.Collectors, 1)
+		assert.Same(t, first.Collectors[0], second.Collectors[0])
+	})
+
+	t.Run("endpoints", func(t *testing.T) {
+		writeCfg(`{"send_mode":"fanout","endpoints":[{"address":"localhost:8080"},{"name":"backup","address":"localhost:3200","protocol":"grpc"}]}`)
+		first, err := ReloadAgentCfg(agentCfg)
+		require.NoError(t, err)
+		assert.Equal(t, SendFanout, first.SendMode)
+		require.Len(t, first.Endpoints, 2)
+		assert.Equal(t, "localhost:8080", first.Endpoints[0].Name)
+		assert.Equal(t, ProtoHTTP, first.Endpoints[0].Protocol)
+		assert.NotNil(t, first.Endpoints[1].CligRPC)
+
+		// состояние серверов сохраняется при перечитывании
+		writeCfg(`{"poll_interval":4,"send_mode":"fanout","endpoints":[{"address":"localhost:8080"},{"name":"backup","address":"localhost:3200","protocol":"grpc"}]}`)
+		second, err := ReloadAgentCfg(agentCfg)
+		require.NoError(t, err)
+		assert.Same(t, first.Endpoints[0].Health, second.Endpoints[0].Health)
+		assert.Same(t, first.Endpoints[1].Health, second.Endpoints[1].Health)
+	})
+
+	t.Run("env overrides file", func(t *testing.T) {
+		writeCfg(`{"address":"localhost:8084","report_interval":"1m","rate_limit":3}`)
+		t.Setenv("RATE_LIMIT", "7")
+		t.Setenv("REPORT_INTERVAL", "")
+		cfg, err := ReloadAgentCfg(agentCfg)
+		require.NoError(t, err)
+		assert.Equal(t, 7, cfg.RateLimit)
+		assert.Equal(t, time.Minute, cfg.ReportTik)
+	})
+
+	t.Run("invalid values rejected", func(t *testing.T) {
+		for _, data := range []string{
+			`{"poll_interval":0}`,
+			`{"rate_limit":33}`,
+			`{"report_interval":"often"}`,
+		} {
+			writeCfg(data)
+			_, err := ReloadAgentCfg(agentCfg)
+			assert.Error(t, err, data)
+		}
+	})
+
+	t.Run("invalid endpoints rejected", func(t *testing.T) {
+		for _, data := range []string{
+			`{"send_mode":"broadcast"}`,
+			`{"endpoints":[{"address":"localhost:8080","protocol":"udp"}]}`,
+			`{"endpoints":[{"address":"localhost:8080"},{"address":"localhost:8080"}]}`,
+		} {
+			writeCfg(data)
+			_, err := ReloadAgentCfg(agentCfg)
+			assert.Error(t, err, data)
+		}
+	})
+}
+
+func TestInitDefaultEndpoint(t *testing.T) {
+	agentCfg := AgentCfg{Logger: logger.Logger(), Endpoint: "metrics.local:3300", Token: "secret"}
+	require.NoError(t, initEndpoints(&agentCfg, nil))
+	require.Len(t, agentCfg.Endpoints, 1)
+	assert.Equal(t, ProtoHTTP, agentCfg.Endpoints[0].Protocol)
+	assert.NotNil(t, agentCfg.Endpoints[0].HTTPClient)
+
+	// с флагом -g используется тот же адрес сервера
+	agentCfg.EnablegRPC = true
+	require.NoError(t, initEndpoints(&agentCfg, nil))
+	require.Len(t, agentCfg.Endpoints, 1)
+	endpoint := agentCfg.Endpoints[0]
+	assert.Equal(t, "metrics.local:3300", endpoint.Address)
+	assert.Equal(t, ProtogRPC, endpoint.Protocol)
+	assert.Equal(t, "secret", endpoint.Token)
+	assert.NotNil(t, endpoint.CligRPC)
+}
+
+func TestPrintAgentCfg(t *testing.T) {
+	agentCfg := AgentCfg{
+		Endpoint:      "localhost:8080",
+		SignKeyString: "AGENTKEY",
+		Token:         "AGENTTOKEN",
+		EndpointsCfg: []EndpointCfg{
+			{Address: "a:1", Key: "EPKEY", Token: "EPTOKEN", CryptoKey: "/path/to/a.pem"},
+			{Address: "b:2"},
+		},
+	}
+	loader, err := cfgload.New(&agentCfg)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, loader.Print(&buf, &agentCfg))
+	for _, secret := range []string{"AGENTKEY", "AGENTTOKEN", "EPKEY", "EPTOKEN"} {
+		assert.NotContains(t, buf.String(), secret)
+	}
+
+	var printed map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &printed))
+	assert.Equal(t, []any{
+		map[string]any{"address": "a:1", "key": "***", "token": "***", "crypto_key": "/path/to/a.pem"},
+		map[string]any{"address": "b:2"},
+	}, printed["endpoints"])
+}
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"reflect"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/netzen86/collectmetrics/internal/security"
+	"github.com/netzen86/collectmetrics/internal/telemetry"
+	"github.com/netzen86/collectmetrics/internal/tracing"
+	pb "github.com/netzen86/collectmetrics/proto/server"
+)
+
+// константы для отправки метрик на несколько серверов
+const (
+	ProtoHTTP       string = "http"
+	ProtogRPC       string = "grpc"
+	SendFailover    string = "failover"
+	SendFanout      string = "fanout"
+	defaultEndpoint string = "default"
+	// UpdateAddressTLS адрес обновления метрики для сервера с TLS
+	UpdateAddressTLS string = "https://%s/update/"
+)
+
+// EndpointCfg настройки сервера для отправки метрик из файла конфигурации
+type EndpointCfg struct {
+	TLS *TLSCfg `json:"tls,omitempty"`
+	// Name имя сервера, по умолчанию адрес
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+	// Protocol протокол отправки http или grpc, по умолчанию http
+	Protocol string `json:"protocol,omitempty"`
+	// Key ключ подписи, по умолчанию общий ключ агента
+	Key string `json:"key,omitempty" secret:"true"`
+	// Token токен доступа к серверу, по умолчанию общий токен агента
+	Token string `json:"token,omitempty" secret:"true"`
+	// CryptoKey публичный ключ для шифрования, по умолчанию общий ключ агента
+	CryptoKey string `json:"crypto_key,omitempty"`
+}
+
+// BreakerCfg настройки автоматического выключателя серверов
+type BreakerCfg struct {
+	// FailureThreshold число ошибок подряд после которого сервер исключается из отправки
+	FailureThreshold int `json:"failure_threshold,omitempty"`
+	// OpenTimeout время в секундах до пробной отправки на исключенный сервер
+	OpenTimeout float64 `json:"open_timeout,omitempty"`
+}
+
+// метод возвращает время до пробной отправки
+func (breaker BreakerCfg) openTimeout() time.Duration {
+	return time.Duration(breaker.OpenTimeout * float64(time.Second))
+}
+
+// метод проверяет настройки выключателя
+func (breaker BreakerCfg) validate() error {
+	if breaker.FailureThreshold < 0 || breaker.OpenTimeout < 0 {
+		return fmt.Errorf("breaker settings must not be negative")
+	}
+	return nil
+}
+
+// TLSCfg настройки TLS соединения с сервером
+type TLSCfg struct {
+	CAFile             string `json:"ca_file,omitempty"`
+	CertFile           string `json:"cert_file,omitempty"`
+	KeyFile            string `json:"key_file,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// Endpoint сервер для отправки метрик с подготовленными клиентами и ключами
+type Endpoint struct {
+	PubKey     *rsa.PublicKey
+	CligRPC    pb.MetricClient
+	HTTPClient *http.Client
+	Health     *telemetry.EndpointHealth
+	TLS        *tls.Config
+	EndpointCfg
+}
+
+// UpdateURL метод возвращает адрес обновления метрики на http сервере
+func (endpoint Endpoint) UpdateURL() string {
+	if endpoint.TLS != nil {
+		return fmt.Sprintf(UpdateAddressTLS, endpoint.Address)
+	}
+	return fmt.Sprintf(UpdateAddress, endpoint.Address)
+}
+
+// функция создает серверы для отправки метрик. Если список серверов не задан
+// используется один сервер из флагов. Клиенты и состояние серверов с неизменными
+// настройками берутся из предыдущей конфигурации.
+func initEndpoints(agentCfg *AgentCfg, previous []Endpoint) error {
+	agentCfg.Endpoints = nil
+
+	if len(agentCfg.EndpointsCfg) == 0 {
+		endpointCfg := EndpointCfg{
+			Name:     defaultEndpoint,
+			Address:  agentCfg.Endpoint,
+			Protocol: ProtoHTTP,
+			Key:      agentCfg.SignKeyString,
+			Token:    agentCfg.Token,
+		}
+		// с флагом -g метрики отправляются по gRPC на тот же адрес
+		if agentCfg.EnablegRPC {
+			endpointCfg.Protocol = ProtogRPC
+		}
+		endpoint, err := newEndpoint(agentCfg, endpointCfg, reuseEndpoint(endpointCfg, previous))
+		if err != nil {
+			return fmt.Errorf("endpoint %s %w", endpointCfg.Name, err)
+		}
+		agentCfg.Endpoints = append(agentCfg.Endpoints, endpoint)
+		return nil
+	}
+
+	names := make(map[string]bool, len(agentCfg.EndpointsCfg))
+	for _, endpointCfg := range agentCfg.EndpointsCfg {
+		if len(endpointCfg.Address) == 0 {
+			return fmt.Errorf("endpoint without address")
+		}
+		if len(endpointCfg.Name) == 0 {
+			endpointCfg.Name = endpointCfg.Address
+		}
+		if names[endpointCfg.Name] {
+			return fmt.Errorf("duplicate endpoint %s", endpointCfg.Name)
+		}
+		names[endpointCfg.Name] = true
+		if len(endpointCfg.Protocol) == 0 {
+			endpointCfg.Protocol = ProtoHTTP
+		}
+		if len(endpointCfg.Key) == 0 {
+			endpointCfg.Key = agentCfg.SignKeyString
+		}
+		if len(endpointCfg.Token) == 0 {
+			endpointCfg.Token = agentCfg.Token
+		}
+
+		endpoint, err := newEndpoint(agentCfg, endpointCfg, reuseEndpoint(endpointCfg, previous))
+		if err != nil {
+			return fmt.Errorf("endpoint %s %w", endpointCfg.Name, err)
+		}
+		agentCfg.Endpoints = append(agentCfg.Endpoints, endpoint)
+	}
+	return nil
+}
+
+// функция ищет сервер с такими же настройками в предыдущей конфигурации
+func reuseEndpoint(endpointCfg EndpointCfg, previous []Endpoint) Endpoint {
+	for _, endpoint := range previous {
+		if reflect.DeepEqual(endpoint.EndpointCfg, endpointCfg) {
+			return endpoint
+		}
+	}
+	return Endpoint{}
+}
+
+// функция возвращает учет доступности сервера из предыдущей конфигурации
+// с новыми настройками выключателя или создает новый
+func endpointHealth(breaker BreakerCfg, old Endpoint) *telemetry.EndpointHealth {
+	if old.Health == nil {
+		return telemetry.NewEndpointHealth(breaker.FailureThreshold, breaker.openTimeout())
+	}
+	old.Health.SetBreaker(breaker.FailureThreshold, breaker.openTimeout())
+	return old.Health
+}
+
+func newEndpoint(agentCfg *AgentCfg, endpointCfg EndpointCfg, old Endpoint) (Endpoint, error) {
+	var err error
+	endpoint := Endpoint{
+		EndpointCfg: endpointCfg,
+		Health:      endpointHealth(agentCfg.Breaker, old),
+		CligRPC:     old.CligRPC,
+	}
+
+	switch {
+	case len(endpointCfg.CryptoKey) != 0:
+		endpoint.PubKey, err = security.ReadPublicKey(endpointCfg.CryptoKey, agentCfg.Logger)
+		if err != nil {
+			return Endpoint{}, fmt.Errorf("error reading public key %w ", err)
+		}
+	case agentCfg.PubKey != nil:
+		endpoint.PubKey = agentCfg.PubKey
+	default:
+		endpoint.PubKey = &rsa.PublicKey{N: big.NewInt(0), E: 0}
+	}
+
+	if endpointCfg.TLS != nil {
+		endpoint.TLS, err = endpointCfg.TLS.tlsConfig()
+		if err != nil {
+			return Endpoint{}, err
+		}
+	}
+
+	switch endpointCfg.Protocol {
+	case ProtoHTTP:
+		endpoint.HTTPClient = &http.Client{}
+		if endpoint.TLS != nil {
+			endpoint.HTTPClient.Transport = &http.Transport{TLSClientConfig: endpoint.TLS}
+		}
+	case ProtogRPC:
+		if endpoint.CligRPC == nil {
+			creds := insecure.NewCredentials()
+			if endpoint.TLS != nil {
+				creds = credentials.NewTLS(endpoint.TLS)
+			}
+			conn, err := grpc.NewClient(endpointCfg.Address, grpc.WithTransportCredentials(creds),
+				grpc.WithUnaryInterceptor(tracing.UnaryClientInterceptor()))
+			if err != nil {
+				return Endpoint{}, fmt.Errorf("error when connect to server %w", err)
+			}
+			endpoint.CligRPC = pb.NewMetricClient(conn)
+		}
+	default:
+		return Endpoint{}, fmt.Errorf("wrong protocol %s", endpointCfg.Protocol)
+	}
+	return endpoint, nil
+}
+
+// метод создает TLS конфигурацию клиента
+func (tlsCfg TLSCfg) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: tlsCfg.InsecureSkipVerify} //nolint:gosec // задается явно в конфигурации
+
+	if len(tlsCfg.CAFile) != 0 {
+		caCert, err := os.ReadFile(tlsCfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error when read ca file %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates in ca file %s", tlsCfg.CAFile)
+		}
+	}
+
+	if len(tlsCfg.CertFile) != 0 || len(tlsCfg.KeyFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error when load client certificate %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
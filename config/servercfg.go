@@ -5,100 +5,114 @@
 package config
 
 import (
-	"bufio"
 	"context"
 	"crypto/rsa"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net/netip"
 	"os"
 	"os/signal"
-	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/netzen86/collectmetrics/internal/alerts"
+	"github.com/netzen86/collectmetrics/internal/audit"
+	"github.com/netzen86/collectmetrics/internal/auth"
+	"github.com/netzen86/collectmetrics/internal/cfgload"
+	"github.com/netzen86/collectmetrics/internal/clientlimit"
+	"github.com/netzen86/collectmetrics/internal/graphite"
+	"github.com/netzen86/collectmetrics/internal/health"
+	"github.com/netzen86/collectmetrics/internal/logger"
+	"github.com/netzen86/collectmetrics/internal/recording"
 	"github.com/netzen86/collectmetrics/internal/repositories"
 	"github.com/netzen86/collectmetrics/internal/repositories/db"
 	"github.com/netzen86/collectmetrics/internal/repositories/files"
 	"github.com/netzen86/collectmetrics/internal/repositories/memstorage"
 	"github.com/netzen86/collectmetrics/internal/security"
+	"github.com/netzen86/collectmetrics/internal/selfmetrics"
+	"github.com/netzen86/collectmetrics/internal/tracing"
 )
 
 // константы используещиеся для работы Сервера.
 const (
-	addressServer    string = "localhost:8080"
-	EndpointRPC      string = "localhost:3200"
-	ProtoTCP         string = "tcp"
-	storeIntervalDef int    = 300
-	// имена переменных окружения
-	envAdd     string = "ADDRESS"
-	envSI      string = "STORE_INTERVAL"
-	envFSP     string = "FILE_STORAGE_PATH"
-	envCFG     string = "CONFIG"
-	envRes     string = "RESTORE"
-	envKey     string = "KEY"
-	envPRIVKEY string = "CRYPTO_KEY"
-	envDB      string = "DATABASE_DSN"
-	envTS      string = "TRUSTED_SUBNET"
+	EndpointRPC string = "localhost:3200"
+	ProtoTCP    string = "tcp"
+	// имя файла для сохранения метрик по умолчанию
+	fileStoragePathDef string = "servermetrics.json"
 )
 
-type configSrvFile struct {
-	Adderss       string `json:"address,omitempty"`
-	StoreFile     string `json:"store_file,omitempty"`
-	Dsn           string `json:"database_dsn,omitempty"`
-	CryptoKey     string `json:"crypto_key,omitempty"`
-	TrustedSubnet string `json:"trusted_subnet,omitempty"`
-	StorInter     int    `json:"store_interval,omitempty"`
-	Restore       bool   `json:"restore,omitempty"`
-}
+// ErrConfigPrinted ошибка возвращается после печати конфигурации по флагу print-config,
+// приложение должно завершиться
+var ErrConfigPrinted = errors.New("config printed")
 
 // ServerCfg структура для конфигурации Сервера.
+// Теги flag, env, file и DefVal разбирает пакет cfgload.
 type ServerCfg struct {
-	Storage            repositories.Repo  `env:"" DefVal:""`
-	ServerCtx          context.Context    `env:"" DefVal:""`
-	PrivKey            *rsa.PrivateKey    `env:"" DefVal:""`
-	Tempfile           *os.File           `env:"" DefVal:""`
-	Wg                 *sync.WaitGroup    `env:"" DefVal:""`
-	Sig                chan os.Signal     `env:"" DefVal:""`
-	ServerStopCtx      context.CancelFunc `env:"" DefVal:""`
-	TrustedSubnet      netip.Prefix       `env:"" DefVal:""`
-	PrivKeyFileName    string             `env:"CRYPTO_KEY" DefVal:""`
-	DBconstring        string             `env:"DATABASE_DSN" DefVal:""`
-	SignKeyString      string             `env:"KEY" DefVal:""`
-	SrvFileCfg         string             `env:"" DefVal:""`
-	FileStoragePath    string             `env:"FILE_STORAGE_PATH" DefVal:""`
-	Endpoint           string             `env:"ADDRESS" DefVal:"localhost:8080"`
-	FileStoragePathDef string             `env:"" DefVal:"FileStoragePath"`
-	StoreInterval      int                `env:"STORE_INTERVAL" DefVal:"300s"`
-	KeyGenerate        bool               `env:"" DefVal:"false"`
-	Restore            bool               `env:"RESTORE" DefVal:"true"`
+	Storage            repositories.Repo     `env:"" DefVal:""`
+	Audit              audit.Log             `env:"" DefVal:""`
+	ServerCtx          context.Context       `env:"" DefVal:""`
+	PrivKey            *rsa.PrivateKey       `env:"" DefVal:""`
+	Limiter            *clientlimit.Limiter  `env:"" DefVal:""`
+	Auth               *auth.Store           `env:"" DefVal:""`
+	Alerts             *alerts.Engine        `env:"" DefVal:""`
+	Recording          *recording.Engine     `env:"" DefVal:""`
+	Graphite           *graphite.Listener    `env:"" DefVal:""`
+	Health             *health.Checker       `env:"" DefVal:""`
+	SelfMetrics        *selfmetrics.Registry `env:"" DefVal:""`
+	Tempfile           *os.File              `env:"" DefVal:""`
+	Wg                 *sync.WaitGroup       `env:"" DefVal:""`
+	Sig                chan os.Signal        `env:"" DefVal:""`
+	ServerStopCtx      context.CancelFunc    `env:"" DefVal:""`
+	TrustedSubnet      netip.Prefix          `flag:"t" env:"TRUSTED_SUBNET" file:"trusted_subnet" DefVal:"" usage:"set allowed network for connection to server."`
+	Log                logger.Config         `file:"log" env:"" DefVal:""`
+	PrivKeyFileName    string                `flag:"crypto-key" env:"CRYPTO_KEY" file:"crypto_key" DefVal:"" usage:"Load private key for decrypting."`
+	DBconstring        string                `flag:"d" env:"DATABASE_DSN" file:"database_dsn" DefVal:"" secret:"true" usage:"Used to set db connet string."`
+	SignKeyString      string                `flag:"k" env:"KEY" file:"key" DefVal:"" secret:"true" usage:"Used to set key for calc hash."`
+	SrvFileCfg         string                `flag:"config" env:"CONFIG" DefVal:"" configfile:"true" usage:"Load configuration from file, JSON or YAML by extension."`
+	FileStoragePath    string                `flag:"f" env:"FILE_STORAGE_PATH" file:"store_file" DefVal:"servermetrics.json" usage:"Used to set file path to save metrics."`
+	Endpoint           string                `flag:"a" env:"ADDRESS" file:"address" DefVal:"localhost:8080" usage:"Used to set the address and port on which the server runs."`
+	FileStoragePathDef string                `env:"" DefVal:""`
+	AlertsFile         string                `flag:"alerts" env:"ALERTS_FILE" file:"alerts_file" DefVal:"" usage:"Load alert rules from file."`
+	RecRulesFile       string                `flag:"recording-rules" env:"RECORDING_RULES_FILE" file:"recording_rules_file" DefVal:"" usage:"Load recording rules from file."`
+	GraphiteAddress    string                `flag:"graphite" env:"GRAPHITE_ADDRESS" file:"graphite_address" DefVal:"" usage:"Address for receiving graphite metrics over TCP and UDP."`
+	GraphiteRulesFile  string                `flag:"graphite-rules" env:"GRAPHITE_RULES_FILE" file:"graphite_rules_file" DefVal:"" usage:"Load graphite path mapping rules from file."`
+	InfluxCounters     string                `flag:"influx-counters" env:"INFLUX_COUNTERS" file:"influx_counters" DefVal:"" usage:"Comma separated influx fields measurement_field stored as counter increments."`
+	TraceFile          string                `flag:"trace-file" env:"TRACE_FILE" file:"trace_file" DefVal:"" usage:"Write trace spans to file."`
+	TraceEndpoint      string                `flag:"trace-endpoint" env:"TRACE_ENDPOINT" file:"trace_endpoint" DefVal:"" usage:"Send trace spans to OTLP/HTTP endpoint, e.g. http://localhost:4318."`
+	AuditFile          string                `flag:"audit-file" env:"AUDIT_FILE" file:"audit_file" DefVal:"" usage:"Write audit log of metric updates to JSONL file."`
+	AuthTokensFile     string                `flag:"auth-tokens-file" env:"AUTH_TOKENS_FILE" file:"auth_tokens_file" DefVal:"" usage:"Store hashed access tokens in file, enables token auth."`
+	AuthAdminToken     string                `flag:"auth-admin-token" env:"AUTH_ADMIN_TOKEN" file:"auth_admin_token" DefVal:"" secret:"true" usage:"Admin token for managing access tokens, enables token auth."`
+	ClientRateLimit    float64               `flag:"client-rate-limit" env:"CLIENT_RATE_LIMIT" file:"client_rate_limit" DefVal:"0" min:"0" usage:"Requests per second allowed for one client, 0 - unlimited."`
+	StoreInterval      int                   `flag:"i" env:"STORE_INTERVAL" file:"store_interval" DefVal:"300" unit:"s" min:"0" usage:"Used for set save metrics on disk, seconds or duration like 5m."`
+	ClientRateBurst    int                   `flag:"client-rate-burst" env:"CLIENT_RATE_BURST" file:"client_rate_burst" DefVal:"0" min:"0" usage:"Requests burst allowed for one client, default rate limit."`
+	ClientMaxMetrics   int                   `flag:"client-max-metrics" env:"CLIENT_MAX_METRICS" file:"client_max_metrics" DefVal:"0" min:"0" usage:"Distinct metrics allowed for one client, 0 - unlimited."`
+	ClientMetricsTTL   int                   `flag:"client-metrics-ttl" env:"CLIENT_METRICS_TTL" file:"client_metrics_ttl" DefVal:"0" unit:"s" min:"0" usage:"Forget distinct metrics of idle client, seconds or duration like 24h, 0 - never."`
+	KeyGenerate        bool                  `flag:"g" DefVal:"false" usage:"Used to generate private and public keys."`
+	Restore            bool                  `flag:"r" env:"RESTORE" file:"restore" DefVal:"true" usage:"Used to set restore metrics."`
+	AuditDB            bool                  `flag:"audit-db" env:"AUDIT_DB" file:"audit_db" DefVal:"false" usage:"Write audit log of metric updates to database table."`
+	PrintConfig        bool                  `env:"" DefVal:"false"`
 }
 
-// метод для получения параметров запуска сервера из флагов
-func (serverCfg *ServerCfg) parseSrvFlags() error {
-	var err error
-
-	// имя файла для сохранения метрик по умолчанию
-	serverCfg.FileStoragePathDef = "servermetrics.json"
-
-	// переменная для ACL
-	var trustedSubStr string
-
-	// опредаляем флаги
-	flag.StringVar(&serverCfg.Endpoint, "a", addressServer, "Used to set the address and port on which the server runs.")
-	flag.StringVar(&serverCfg.FileStoragePath, "f", serverCfg.FileStoragePathDef, "Used to set file path to save metrics.")
-	flag.StringVar(&serverCfg.DBconstring, "d", "", "Used to set db connet string.")
-	flag.StringVar(&serverCfg.SignKeyString, "k", "", "Used to set key for calc hash.")
-	flag.StringVar(&serverCfg.PrivKeyFileName, "crypto-key", "", "Load private key for decrypting.")
-	flag.StringVar(&serverCfg.SrvFileCfg, "config", "", "Load configuration from file.")
-	flag.StringVar(&trustedSubStr, "t", "", "set allowed network for connection to server.")
-	flag.BoolVar(&serverCfg.KeyGenerate, "g", false, "Used to generate private and public keys.")
-	flag.BoolVar(&serverCfg.Restore, "r", true, "Used to set restore metrics.")
-	flag.IntVar(&serverCfg.StoreInterval, "i", storeIntervalDef, "Used for set save metrics on disk.")
-
+// метод получает параметры запуска сервера: значения по умолчанию, файл конфигурации,
+// флаги и переменные окружения в порядке возрастания приоритета
+func (serverCfg *ServerCfg) loadSrvCfg() error {
+	loader, err := cfgload.New(serverCfg)
+	if err != nil {
+		return fmt.Errorf("error when parse config tags %w", err)
+	}
+	err = loader.Defaults(serverCfg)
+	if err != nil {
+		return err
+	}
+	err = loader.BindFlags(flag.CommandLine, serverCfg)
+	if err != nil {
+		return err
+	}
+	flag.BoolVar(&serverCfg.PrintConfig, "print-config", false, "Print effective configuration with secrets redacted and exit.")
 	flag.Parse()
 
 	// если серверу преданы параменты, а не флаги
@@ -108,125 +122,24 @@ func (serverCfg *ServerCfg) parseSrvFlags() error {
 		return fmt.Errorf("not args allowed")
 	}
 
-	if len(trustedSubStr) != 0 {
-		serverCfg.TrustedSubnet, err = netip.ParsePrefix(trustedSubStr)
-		if err != nil {
-			return fmt.Errorf("error this is not prefix %w ", err)
-		}
-	}
-
-	// для замены имени файла по умолчанию
-	if serverCfg.FileStoragePath != serverCfg.FileStoragePathDef {
-		serverCfg.FileStoragePathDef = serverCfg.FileStoragePath
-	}
-	return nil
-}
-
-// метод для получения параметров запуска сервера из переменных окружения
-func (serverCfg *ServerCfg) getSrvEnv() error {
-	var err error
-
-	// получаем данные для работы програмы из переменных окружения
-	// переменные окружения имеют наивысший приоритет
-	if len(os.Getenv(envAdd)) > 0 {
-		serverCfg.Endpoint = os.Getenv(envAdd)
-	}
-	// получаем интервал сохранения метрик в файл
-	if len(os.Getenv(envSI)) != 0 {
-		serverCfg.StoreInterval, err = strconv.Atoi(os.Getenv(envSI))
-		if err != nil {
-			return fmt.Errorf("error atoi poll interval %v ", err)
-		}
-	}
-
-	// получаем имя файла для сохранения метрик
-	if len(os.Getenv(envFSP)) != 0 {
-		serverCfg.FileStoragePath = os.Getenv(envFSP)
-		serverCfg.FileStoragePathDef = os.Getenv(envFSP)
-
-	}
-	// получаем параметр восстановления метрик из файла
-	// при false не восстанавливаем, по умолчанию true
-	if len(os.Getenv(envRes)) != 0 {
-		serverCfg.Restore, err = strconv.ParseBool(os.Getenv(envRes))
-		if err != nil {
-			return fmt.Errorf("error parse bool restore %v ", err)
-		}
-	}
-	// получаем ключ для создания подписи
-	if len(os.Getenv(envKey)) != 0 {
-		serverCfg.SignKeyString = os.Getenv(envKey)
-	}
-
-	// получаем имя файла ключа для ассемитричного шифрования
-	if len(os.Getenv(envPRIVKEY)) > 0 {
-		serverCfg.PrivKeyFileName = os.Getenv(envPRIVKEY)
-	}
-
-	// получаем параметры подключения к базе данных
-	if len(os.Getenv(envDB)) != 0 {
-		serverCfg.DBconstring = os.Getenv(envDB)
-	}
-
-	// получаем разрешенную для подключений подсеть
-	if len(os.Getenv(envTS)) != 0 {
-		serverCfg.TrustedSubnet, err = netip.ParsePrefix(os.Getenv(envTS))
-		if err != nil {
-			return fmt.Errorf("error when get trusted subnet from env %w", err)
-		}
-	}
-
-	return nil
-}
-
-// метод для получения параметров запуска сервера из файла формата json
-func (serverCfg *ServerCfg) getSrvCfgFile(srvlog zap.SugaredLogger) error {
-	var srvCfg configSrvFile
-	config, err := os.Open(serverCfg.SrvFileCfg)
-	if err != nil {
-		return fmt.Errorf("error when read server config file %w", err)
-	}
-	defer func() {
-		err = config.Close()
-		if err != nil {
-			srvlog.Info("error when closing server config file %v", err)
-		}
-	}()
-	fileinfo, _ := config.Stat()
-	cfgBytes := make([]byte, fileinfo.Size())
-	buffer := bufio.NewReader(config)
-	_, err = buffer.Read(cfgBytes)
+	err = loader.Load(serverCfg)
 	if err != nil {
-		return fmt.Errorf("error when read config file %w", err)
-	}
-	err = json.Unmarshal(cfgBytes, &srvCfg)
-	if err != nil {
-		return fmt.Errorf("error when unmarshal config %w", err)
+		return err
 	}
 
-	if serverCfg.Endpoint == addressServer && len(srvCfg.Adderss) != 0 {
-		serverCfg.Endpoint = srvCfg.Adderss
-	}
-	if serverCfg.Restore {
-		serverCfg.Restore = srvCfg.Restore
+	// файл заданный в файле конфигурации служит хранилищем метрик,
+	// иначе в файл периодически сохраняются метрики из памяти или базы данных
+	serverCfg.FileStoragePathDef = serverCfg.FileStoragePath
+	if loader.Source("FileStoragePath") == cfgload.SourceFile {
+		serverCfg.FileStoragePathDef = fileStoragePathDef
 	}
-	if serverCfg.StoreInterval == 300 {
-		serverCfg.StoreInterval = srvCfg.StorInter
-	}
-	if serverCfg.FileStoragePath == serverCfg.FileStoragePathDef && len(srvCfg.StoreFile) != 0 {
-		serverCfg.FileStoragePath = srvCfg.StoreFile
-	}
-	if len(serverCfg.DBconstring) == 0 {
-		serverCfg.DBconstring = srvCfg.Dsn
-	}
-	if len(serverCfg.PrivKeyFileName) == 0 {
-		serverCfg.PrivKeyFileName = srvCfg.CryptoKey
-	}
-	if len(serverCfg.TrustedSubnet.String()) == 0 {
-		serverCfg.TrustedSubnet, err = netip.ParsePrefix(srvCfg.TrustedSubnet)
+
+	if serverCfg.PrintConfig {
+		err = loader.Print(os.Stdout, serverCfg)
 		if err != nil {
-			return fmt.Errorf("error when parsing ip prefix %w", err)
+			return fmt.Errorf("error when print config %w", err)
 		}
+		return ErrConfigPrinted
 	}
 	return nil
 }
@@ -264,6 +177,45 @@ func (serverCfg *ServerCfg) initSrv(srvlog zap.SugaredLogger) error {
 		}
 	}
 
+	// учитываем длительность и ошибки операций хранилища в собственных метриках сервера,
+	// каждая операция пишется в спан трассировки
+	backend := "memory"
+	switch serverCfg.Storage.(type) {
+	case *db.DBStorage:
+		backend = "database"
+	case *files.Filestorage:
+		backend = "file"
+	}
+	serverCfg.Storage = tracing.NewStorage(serverCfg.Storage, backend)
+	serverCfg.SelfMetrics = selfmetrics.NewRegistry()
+	serverCfg.Storage = selfmetrics.NewStorage(serverCfg.Storage, serverCfg.SelfMetrics, backend)
+
+	// журнал аудита изменений метрик в файле или в таблице базы данных хранилища
+	switch {
+	case len(serverCfg.AuditFile) != 0 && serverCfg.AuditDB:
+		return fmt.Errorf("audit file and audit db are mutually exclusive")
+	case len(serverCfg.AuditFile) != 0:
+		serverCfg.Audit, err = audit.NewFileLog(serverCfg.AuditFile)
+		if err != nil {
+			return fmt.Errorf("error when open audit log %w ", err)
+		}
+	case serverCfg.AuditDB:
+		dbstorage, ok := repositories.Unwrap(serverCfg.Storage).(*db.DBStorage)
+		if !ok {
+			return fmt.Errorf("audit db requires database storage")
+		}
+		serverCfg.Audit, err = audit.NewDBLog(ctx, dbstorage.DB)
+		if err != nil {
+			return fmt.Errorf("error when create audit table %w ", err)
+		}
+	}
+	if serverCfg.Audit != nil {
+		serverCfg.Storage = audit.NewStorage(serverCfg.Storage, serverCfg.Audit)
+	}
+
+	// учитываем время обновления метрик для дашборда
+	serverCfg.Storage = repositories.NewTracked(serverCfg.Storage)
+
 	// создание приватного и публичного ключа
 	if serverCfg.KeyGenerate {
 		err = security.GenerateKeys(srvlog)
@@ -280,6 +232,62 @@ func (serverCfg *ServerCfg) initSrv(srvlog zap.SugaredLogger) error {
 		}
 	}
 
+	// проверка готовности компонентов сервера
+	serverCfg.Health = health.NewChecker()
+	serverCfg.Health.Add("storage", serverCfg.Storage)
+
+	// ограничения запросов и числа метрик одного клиента
+	serverCfg.Limiter = clientlimit.NewLimiter(clientlimit.Config{
+		Rate:       serverCfg.ClientRateLimit,
+		Burst:      serverCfg.ClientRateBurst,
+		MaxMetrics: serverCfg.ClientMaxMetrics,
+		MetricsTTL: time.Duration(serverCfg.ClientMetricsTTL) * time.Second,
+	})
+
+	// проверка доступа по токенам, без файла токенов и токена администратора отключена
+	serverCfg.Auth, err = auth.NewStore(serverCfg.AuthTokensFile, serverCfg.AuthAdminToken)
+	if err != nil {
+		return fmt.Errorf("error loading access tokens %w ", err)
+	}
+
+	// правила оповещения
+	if len(serverCfg.AlertsFile) != 0 {
+		alertsCfg, err := alerts.LoadConfig(serverCfg.AlertsFile)
+		if err != nil {
+			return fmt.Errorf("error loading alert rules %w ", err)
+		}
+		serverCfg.Alerts = alerts.NewEngine(alertsCfg, serverCfg.Storage, srvlog)
+	}
+
+	// правила записи вычисляемых метрик
+	if len(serverCfg.RecRulesFile) != 0 {
+		recordingCfg, err := recording.LoadConfig(serverCfg.RecRulesFile)
+		if err != nil {
+			return fmt.Errorf("error loading recording rules %w ", err)
+		}
+		serverCfg.Recording, err = recording.NewEngine(recordingCfg, serverCfg.Storage, srvlog)
+		if err != nil {
+			return fmt.Errorf("error creating recording rules %w ", err)
+		}
+	}
+
+	// прием метрик graphite, правила преобразования путей необязательны.
+	// Протокол graphite не передает токен, поэтому вместе с авторизацией прием не запускается
+	if len(serverCfg.GraphiteAddress) != 0 {
+		if serverCfg.Auth != nil {
+			return fmt.Errorf("graphite listener can not be used with token auth")
+		}
+		var graphiteCfg graphite.Config
+		if len(serverCfg.GraphiteRulesFile) != 0 {
+			graphiteCfg, err = graphite.LoadConfig(serverCfg.GraphiteRulesFile)
+			if err != nil {
+				return fmt.Errorf("error loading graphite rules %w ", err)
+			}
+		}
+		serverCfg.Graphite = graphite.NewListener(serverCfg.GraphiteAddress, graphiteCfg, serverCfg.TrustedSubnet,
+			serverCfg.Limiter, serverCfg.Storage, srvlog)
+	}
+
 	// создание контекста для graceful shutdown сервера
 	serverCtx, serverStopCtx := context.WithCancel(context.Background())
 	serverCfg.ServerCtx = serverCtx
@@ -305,21 +313,18 @@ func (serverCfg *ServerCfg) initSrv(srvlog zap.SugaredLogger) error {
 func (serverCfg *ServerCfg) GetServerCfg(srvlog zap.SugaredLogger) error {
 	var err error
 
-	err = serverCfg.parseSrvFlags()
-	if err != nil {
-		return fmt.Errorf("error parse flags: %w", err)
+	err = serverCfg.loadSrvCfg()
+	if errors.Is(err, ErrConfigPrinted) {
+		return err
 	}
-
-	if len(serverCfg.SrvFileCfg) != 0 {
-		err = serverCfg.getSrvCfgFile(srvlog)
-		if err != nil {
-			return fmt.Errorf("error get config from file: %w", err)
-		}
+	if err != nil {
+		return fmt.Errorf("error get config: %w", err)
 	}
 
-	err = serverCfg.getSrvEnv()
+	// настраиваем общий логгер, ранее полученные логгеры пишут по новым параметрам
+	err = logger.Setup(serverCfg.Log)
 	if err != nil {
-		return fmt.Errorf("error get env var: %w", err)
+		return fmt.Errorf("error setup logger: %w", err)
 	}
 
 	err = serverCfg.initSrv(srvlog)
@@ -328,3 +333,8 @@ func (serverCfg *ServerCfg) GetServerCfg(srvlog zap.SugaredLogger) error {
 	}
 	return nil
 }
+
+// Tracing метод возвращает параметры экспорта спанов трассировки
+func (serverCfg ServerCfg) Tracing() tracing.Config {
+	return tracing.Config{File: serverCfg.TraceFile, Endpoint: serverCfg.TraceEndpoint}
+}
@@ -7,26 +7,31 @@ import (
 	"crypto/rsa"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"math/rand/v2"
 	"net/http"
-	"os"
 	"runtime"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/shirou/gopsutil/v4/cpu"
 	"github.com/shirou/gopsutil/v4/mem"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
 	"github.com/netzen86/collectmetrics/config"
+	"github.com/netzen86/collectmetrics/internal/aggregate"
 	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/collectors"
 	"github.com/netzen86/collectmetrics/internal/security"
+	"github.com/netzen86/collectmetrics/internal/tracing"
 	"github.com/netzen86/collectmetrics/internal/utils"
-	pb "github.com/netzen86/collectmetrics/proto/server"
 )
 
+// время на завершение отправки после остановки агента
+const shutdownGrace time.Duration = 30 * time.Second
+
 type gaugeJobs struct {
 	function func() float64
 	mName    string
@@ -85,35 +90,38 @@ func CollectMetrics(counter *int64, agentCfg config.AgentCfg,
 		close(results)
 	}
 
+	// мапа анонимных функций для сбора метрик runtime.MemStats
+	memStatsFunc := map[string]func() float64{
+		config.Alloc:         func() float64 { return float64(memStats.Alloc) },
+		config.BuckHashSys:   func() float64 { return float64(memStats.BuckHashSys) },
+		config.Frees:         func() float64 { return float64(memStats.Frees) },
+		config.GCCPUFraction: func() float64 { return float64(memStats.GCCPUFraction) },
+		config.GCSys:         func() float64 { return float64(memStats.GCSys) },
+		config.HeapAlloc:     func() float64 { return float64(memStats.HeapAlloc) },
+		config.HeapIdle:      func() float64 { return float64(memStats.HeapIdle) },
+		config.HeapInuse:     func() float64 { return float64(memStats.HeapInuse) },
+		config.HeapObjects:   func() float64 { return float64(memStats.HeapObjects) },
+		config.HeapReleased:  func() float64 { return float64(memStats.HeapReleased) },
+		config.HeapSys:       func() float64 { return float64(memStats.HeapSys) },
+		config.LastGC:        func() float64 { return float64(memStats.LastGC) },
+		config.Lookups:       func() float64 { return float64(memStats.Lookups) },
+		config.MCacheInuse:   func() float64 { return float64(memStats.MCacheInuse) },
+		config.MCacheSys:     func() float64 { return float64(memStats.MCacheSys) },
+		config.MSpanInuse:    func() float64 { return float64(memStats.MSpanInuse) },
+		config.MSpanSys:      func() float64 { return float64(memStats.MSpanSys) },
+		config.Mallocs:       func() float64 { return float64(memStats.Mallocs) },
+		config.NextGC:        func() float64 { return float64(memStats.NextGC) },
+		config.NumForcedGC:   func() float64 { return float64(memStats.NumForcedGC) },
+		config.NumGC:         func() float64 { return float64(memStats.NumGC) },
+		config.OtherSys:      func() float64 { return float64(memStats.OtherSys) },
+		config.PauseTotalNs:  func() float64 { return float64(memStats.PauseTotalNs) },
+		config.StackInuse:    func() float64 { return float64(memStats.StackInuse) },
+		config.StackSys:      func() float64 { return float64(memStats.StackSys) },
+		config.Sys:           func() float64 { return float64(memStats.Sys) },
+		config.TotalAlloc:    func() float64 { return float64(memStats.TotalAlloc) }}
+
 	// мапа анонимных функций для сбора метрик
 	gaugeFunc := map[string]func() float64{
-		config.Alloc:           func() float64 { return float64(memStats.Alloc) },
-		config.BuckHashSys:     func() float64 { return float64(memStats.BuckHashSys) },
-		config.Frees:           func() float64 { return float64(memStats.Frees) },
-		config.GCCPUFraction:   func() float64 { return float64(memStats.GCCPUFraction) },
-		config.GCSys:           func() float64 { return float64(memStats.GCSys) },
-		config.HeapAlloc:       func() float64 { return float64(memStats.HeapAlloc) },
-		config.HeapIdle:        func() float64 { return float64(memStats.HeapIdle) },
-		config.HeapInuse:       func() float64 { return float64(memStats.HeapInuse) },
-		config.HeapObjects:     func() float64 { return float64(memStats.HeapObjects) },
-		config.HeapReleased:    func() float64 { return float64(memStats.HeapReleased) },
-		config.HeapSys:         func() float64 { return float64(memStats.HeapSys) },
-		config.LastGC:          func() float64 { return float64(memStats.LastGC) },
-		config.Lookups:         func() float64 { return float64(memStats.Lookups) },
-		config.MCacheInuse:     func() float64 { return float64(memStats.MCacheInuse) },
-		config.MCacheSys:       func() float64 { return float64(memStats.MCacheSys) },
-		config.MSpanInuse:      func() float64 { return float64(memStats.MSpanInuse) },
-		config.MSpanSys:        func() float64 { return float64(memStats.MSpanSys) },
-		config.Mallocs:         func() float64 { return float64(memStats.Mallocs) },
-		config.NextGC:          func() float64 { return float64(memStats.NextGC) },
-		config.NumForcedGC:     func() float64 { return float64(memStats.NumForcedGC) },
-		config.NumGC:           func() float64 { return float64(memStats.NumGC) },
-		config.OtherSys:        func() float64 { return float64(memStats.OtherSys) },
-		config.PauseTotalNs:    func() float64 { return float64(memStats.PauseTotalNs) },
-		config.StackInuse:      func() float64 { return float64(memStats.StackInuse) },
-		config.StackSys:        func() float64 { return float64(memStats.StackSys) },
-		config.Sys:             func() float64 { return float64(memStats.Sys) },
-		config.TotalAlloc:      func() float64 { return float64(memStats.TotalAlloc) },
 		config.RandomValue:     func() float64 { return rand.Float64() },
 		config.TotalMemory:     func() float64 { return float64(mem.Total) },
 		config.FreeMemory:      func() float64 { return float64(mem.Free) },
@@ -125,16 +133,24 @@ func CollectMetrics(counter *int64, agentCfg config.AgentCfg,
 	}
 
 	for !shutdown {
+		// конфигурация могла быть перечитана по SIGHUP
+		agentCfg = agentCfg.Current()
 		<-time.After(agentCfg.PollTik)
 		agentCfg.Logger.Infoln("COLLECTING METRIC")
+		ctx, span := tracing.Start(agentCfg.AgentPCtx, "agent.CollectMetrics")
 
-		runtime.ReadMemStats(&memStats)
+		// при включенном сборщике runtime/metrics MemStats не читается,
+		// так как ReadMemStats останавливает выполнение программы
+		readMemStats := !agentCfg.Runtime.Enabled
+		if readMemStats {
+			runtime.ReadMemStats(&memStats)
+		}
 
 		wg := &sync.WaitGroup{}
-		jobsGauge := make(chan gaugeJobs, len(gaugeFunc)+1)
+		jobsGauge := make(chan gaugeJobs, len(gaugeFunc)+len(memStatsFunc)+1)
 		jobsCounter := make(chan counterJobs, len(counterFunc)+1)
 
-		for range len(gaugeFunc) + 1 {
+		for range len(gaugeFunc) + len(memStatsFunc) + 1 {
 			wg.Add(1)
 			go workerGauge(jobsGauge, results, wg)
 		}
@@ -148,6 +164,11 @@ func CollectMetrics(counter *int64, agentCfg config.AgentCfg,
 		for k, v := range gaugeFunc {
 			jobsGauge <- gaugeJobs{mName: k, function: v}
 		}
+		if readMemStats {
+			for k, v := range memStatsFunc {
+				jobsGauge <- gaugeJobs{mName: k, function: v}
+			}
+		}
 		close(jobsGauge)
 
 		for k, v := range counterFunc {
@@ -155,6 +176,11 @@ func CollectMetrics(counter *int64, agentCfg config.AgentCfg,
 		}
 		close(jobsCounter)
 		wg.Wait()
+
+		// опрашиваем дополнительные сборщики метрик
+		collectExtra(ctx, agentCfg, results)
+		span.End()
+
 		select {
 		case <-agentCfg.AgentPCtx.Done():
 			shutdown = true
@@ -166,6 +192,30 @@ func CollectMetrics(counter *int64, agentCfg config.AgentCfg,
 	}
 }
 
+// функция для опроса дополнительных сборщиков метрик,
+// ошибки сборщиков только логируются чтобы не останавливать сбор остальных метрик
+func collectExtra(ctx context.Context, agentCfg config.AgentCfg, results chan<- api.Metrics) {
+	for _, collector := range agentCfg.Collectors {
+		start := time.Now()
+		collectCtx, span := tracing.Start(ctx, "agent.Collect", attribute.String("collector", collector.Name()))
+		metrics, err := collector.Collect(collectCtx)
+		span.SetAttributes(attribute.Int("metrics.count", len(metrics)))
+		tracing.End(span, err)
+		agentCfg.Stats.CollectorDone(collector.Name(), len(metrics), time.Since(start), err)
+		if err != nil {
+			agentCfg.Logger.Infof("error when collect %s metrics %v", collector.Name(), err)
+		}
+		for _, metric := range metrics {
+			results <- metric
+		}
+	}
+
+	// метрики самодиагностики агента
+	for _, metric := range agentCfg.Stats.Metrics() {
+		results <- metric
+	}
+}
+
 // JSONdecode функция для парсинга ответа на запрос обновления метрик
 func JSONdecode(resp *http.Response, logger zap.SugaredLogger) {
 	var buf bytes.Buffer
@@ -211,29 +261,42 @@ func JSONdecode(resp *http.Response, logger zap.SugaredLogger) {
 }
 
 // JSONSendMetrics функция для отправки метрик
-func JSONSendMetrics(url, signKey, localIP string, metrics api.Metrics, pubKey *rsa.PublicKey, logger zap.SugaredLogger) error {
+func JSONSendMetrics(ctx context.Context, url, signKey, localIP string, metrics api.Metrics,
+	pubKey *rsa.PublicKey, logger zap.SugaredLogger) error {
+	return sendJSON(ctx, &http.Client{}, url, signKey, "", localIP, metrics, pubKey, logger)
+}
+
+// функция отправки метрики через переданный http клиент,
+// контекст трассировки передается серверу в заголовках запроса,
+// токен доступа в заголовке Authorization если задан
+func sendJSON(ctx context.Context, client *http.Client, url, signKey, token, localIP string, metrics api.Metrics,
+	pubKey *rsa.PublicKey, logger zap.SugaredLogger) (err error) {
 	var data, sign []byte
-	var err error
+	ctx, span := tracing.Start(ctx, "agent.JSONSendMetrics", attribute.String("url.full", url),
+		attribute.String("metric.id", metrics.ID), attribute.String("metric.type", metrics.MType))
+	defer func() { tracing.End(span, err) }()
 
 	// сериализуем данные в JSON
 	data, err = json.Marshal(metrics)
 	if err != nil {
 		logger.Infof("serilazing error: %v\n", err)
-		return fmt.Errorf("serilazing error: %v", err)
+		return utils.Permanent(fmt.Errorf("serilazing error: %v", err))
 	}
 
 	// если перадан публичнный ключ - шифруем контент
 	if pubKey.Size() != 0 {
+		_, encryptSpan := tracing.Start(ctx, "security.EncryptMetric")
 		data, err = security.EncryptMetic(data, pubKey)
+		tracing.End(encryptSpan, err)
 		if err != nil {
-			return fmt.Errorf("cannot encrypt metric %w", err)
+			return utils.Permanent(fmt.Errorf("cannot encrypt metric %w", err))
 		}
 	}
 
 	// сжимаем данные
 	data, err = utils.GzipCompress(data)
 	if err != nil {
-		return fmt.Errorf("cannot compress metirc %w", err)
+		return utils.Permanent(fmt.Errorf("cannot compress metirc %w", err))
 	}
 
 	// если передан ключ создаем подпись
@@ -242,10 +305,11 @@ func JSONSendMetrics(url, signKey, localIP string, metrics api.Metrics, pubKey *
 	}
 
 	// создаем реквест
-	request, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(data))
 	if err != nil {
-		return fmt.Errorf("%v", err)
+		return utils.Permanent(err)
 	}
+	tracing.InjectHTTP(ctx, request.Header)
 
 	// добавляем данные в заголовок запроса
 	request.Header.Add("Content-Encoding", api.Gz)
@@ -261,129 +325,198 @@ func JSONSendMetrics(url, signKey, localIP string, metrics api.Metrics, pubKey *
 	if len(signKey) != 0 {
 		request.Header.Add("HashSHA256", hex.EncodeToString(sign))
 	}
+	if len(token) != 0 {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
 
-	// создаем http клиент
-	client := &http.Client{}
 	response, err := client.Do(request)
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
 	defer func() {
-		err = response.Body.Close()
-		if err != nil {
-			logger.Infof("error when body closing %v", err)
+		if closeErr := response.Body.Close(); closeErr != nil {
+			logger.Infof("error when body closing %v", closeErr)
 		}
 	}()
 
-	if response.StatusCode != 200 {
-		return errors.New(response.Status)
+	span.SetAttributes(attribute.Int("http.response.status_code", response.StatusCode))
+	if response.StatusCode != http.StatusOK {
+		return statusError(response)
 	}
 	JSONdecode(response, logger)
 	return nil
 }
 
-func workerSM(jobs <-chan api.Metrics, endpoint, signKey, localIP string,
-	pubKey *rsa.PublicKey, logger zap.SugaredLogger, gRPCCli pb.MetricClient, enablegRPC bool,
+func workerSM(ctx context.Context, jobs <-chan api.Metrics, agentCfg config.AgentCfg,
 	errCh chan<- error, wg *sync.WaitGroup) {
-	var err error
-	ctx := context.Background()
 	defer wg.Done()
-	metric, ok := <-jobs
-	if !ok {
-		return
+	for metric := range jobs {
+		sendMetric(ctx, agentCfg, metric, errCh)
 	}
+}
 
-	retrybuilder := func() func() error {
-		return func() error {
-			switch {
-			case enablegRPC:
-				var pbMetric pb.AddMetricRequest
-				var response *pb.AddMetircResponse
-				pbMetric.Metric = &pb.Metrics{}
-
-				pbMetric.Metric.Id = metric.ID
-				pbMetric.Metric.Mtype = metric.MType
-
-				if metric.MType == api.Counter {
-					pbMetric.Metric.Delta = *metric.Delta
-				} else if metric.MType == api.Gauge {
-					pbMetric.Metric.Value = *metric.Value
-				}
-
-				response, err = gRPCCli.AddMetric(ctx, &pbMetric)
-				if err != nil {
-					logger.Infof("error when sm gRPC in internal/agent %v", err)
-				}
-				logger.Infoln(response.Metric.Id, response.Metric.Mtype,
-					response.Metric.Delta, response.Metric.Value)
-			default:
-				err = JSONSendMetrics(
-					fmt.Sprintf(config.UpdateAddress, endpoint),
-					signKey, localIP, metric, pubKey, logger)
-
-				if err != nil {
-					logger.Infof("error when sm in internal/agent %v", err)
-				}
-			}
-			return nil
-		}
-	}
-	err = utils.RetryFunc(retrybuilder)
+// функция отправки одной метрики с учетом в самодиагностике,
+// повторы выполняются по политике из конфигурации
+func sendMetric(ctx context.Context, agentCfg config.AgentCfg, metric api.Metrics, errCh chan<- error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "agent.SendMetric",
+		attribute.String("metric.id", metric.ID), attribute.String("metric.type", metric.MType))
+	err := deliver(ctx, agentCfg, metric)
+	tracing.End(span, err)
 	if err != nil {
+		agentCfg.Stats.SendFailed(err)
 		errCh <- fmt.Errorf("fail when sm in agent %w", err)
 		return
 	}
+	agentCfg.Stats.SendOK(time.Since(start))
 }
 
-// SendMetrics функция для отправки метрик
+// SendMetrics функция для отправки метрик. Метрики забираются из канала
+// сразу после сбора и агрегируются, раз в интервал отправки отправляется
+// один снимок всех метрик собранных за интервал.
 func SendMetrics(metrics <-chan api.Metrics, agentCfg config.AgentCfg,
 	errCh chan<- error, rwg *sync.WaitGroup) {
 	defer rwg.Done()
-	jobs := make(chan api.Metrics, agentCfg.RateLimit)
-	wg := sync.WaitGroup{}
+	window := aggregate.NewWindow()
+	agentCfg.Stats.SetQueue(window.Len)
 	shutdown := false
 
-	for !shutdown {
-
-		<-time.After(agentCfg.ReportTik)
-
-		for range agentCfg.RateLimit {
-			wg.Add(1)
-			go workerSM(jobs, agentCfg.Endpoint, agentCfg.SignKeyString, agentCfg.LocalIP,
-				agentCfg.PubKey, agentCfg.Logger, agentCfg.CligRPC,
-				agentCfg.EnablegRPC, errCh, &wg)
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for metric := range metrics {
+			window.Add(metric)
 		}
+	}()
 
-		for range agentCfg.RateLimit {
-			metric, ok := <-metrics
-			if !ok {
-				break
-			}
-			jobs <- metric
-		}
-		wg.Wait()
+	// отправка последнего снимка после остановки сбора ограничена временем
+	// на завершение, ожидание повторов прерывается вместе с контекстом
+	ctx, cancel := context.WithCancel(context.WithoutCancel(agentCfg.AgentSCtx))
+	defer cancel()
+	stop := context.AfterFunc(agentCfg.AgentSCtx, func() { time.AfterFunc(shutdownGrace, cancel) })
+	defer stop()
+
+	for !shutdown {
+		// конфигурация могла быть перечитана по SIGHUP
+		agentCfg = agentCfg.Current()
 
 		select {
+		case <-time.After(reportWindow(agentCfg)):
 		case <-agentCfg.AgentSCtx.Done():
+			// сбор остановлен, дожидаемся последних метрик
+			<-drained
 			agentCfg.Logger.Info("-=*** STOP SENDING METIRICS ***=-")
-			close(jobs)
 			shutdown = true
-		default:
 		}
+
+		sendBatch(ctx, window.Flush(agentCfg.Aggregation), agentCfg, errCh)
 	}
 }
 
-func sigMon(sig chan os.Signal, agentCtx context.Context,
-	agentStopCtx context.CancelFunc, logger zap.SugaredLogger) {
-	<-sig
-	stopWithTimer(agentCtx, agentStopCtx, logger)
+// функция возвращает интервал отправки, при нулевом интервале
+// метрики отправляются после каждого сбора
+func reportWindow(agentCfg config.AgentCfg) time.Duration {
+	return max(agentCfg.ReportTik, agentCfg.PollTik)
+}
+
+// функция отправляет снимок метрик не более чем в RateLimit потоков
+func sendBatch(ctx context.Context, batch []api.Metrics, agentCfg config.AgentCfg, errCh chan<- error) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, span := tracing.Start(ctx, "agent.SendMetrics",
+		attribute.Int("metrics.count", len(batch)))
+	defer span.End()
+	jobs := make(chan api.Metrics, agentCfg.RateLimit)
+	wg := sync.WaitGroup{}
+
+	for range min(agentCfg.RateLimit, len(batch)) {
+		wg.Add(1)
+		go workerSM(ctx, jobs, agentCfg, errCh, &wg)
+	}
+	for _, metric := range batch {
+		jobs <- metric
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// функция обрабатывает сигналы, SIGHUP перечитывает конфигурацию,
+// остальные сигналы останавливают агента
+func sigMon(agentCfg config.AgentCfg, runners *runnerGroup) {
+	for sig := range agentCfg.Sig {
+		if sig != syscall.SIGHUP {
+			stopWithTimer(agentCfg.AgentPCtx, agentCfg.AgentPStopCtx, agentCfg.Logger)
+			return
+		}
+		reloadCfg(agentCfg, runners)
+	}
+}
+
+// функция перечитывания конфигурации, при ошибке продолжает работать старая конфигурация
+func reloadCfg(agentCfg config.AgentCfg, runners *runnerGroup) {
+	oldCfg := agentCfg.Current()
+	newCfg, err := config.ReloadAgentCfg(agentCfg)
+	if err != nil {
+		agentCfg.Logger.Errorf("config reload rejected, keeping current config %v", err)
+		return
+	}
+	if !sameCollectors(oldCfg.Collectors, newCfg.Collectors) {
+		runners.restart(newCfg)
+	}
+	agentCfg.Logger.Infoln("CONFIG RELOADED",
+		"endpoints", len(newCfg.Endpoints),
+		"mode", newCfg.SendMode,
+		"poll", newCfg.PollInterval,
+		"report", newCfg.ReportInterval,
+		"ratelimit", newCfg.RateLimit,
+		"collectors", len(newCfg.Collectors))
+}
+
+func sameCollectors(a, b []collectors.Collector) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// группа фоновых сборщиков метрик, при перечитывании конфигурации
+// старые сборщики останавливаются и запускаются новые
+type runnerGroup struct {
+	stop context.CancelFunc
+	rwg  *sync.WaitGroup
+}
+
+// метод запускает сборщики которым нужна работа в фоне
+func (runners *runnerGroup) restart(agentCfg config.AgentCfg) {
+	if runners.stop != nil {
+		runners.stop()
+	}
+	ctx, stop := context.WithCancel(agentCfg.AgentPCtx)
+	runners.stop = stop
+	for _, collector := range agentCfg.Collectors {
+		runner, ok := collector.(collectors.Runner)
+		if !ok {
+			continue
+		}
+		runners.rwg.Add(1)
+		go func() {
+			defer runners.rwg.Done()
+			runner.Run(ctx)
+		}()
+	}
 }
 
 func stopWithTimer(agentCtx context.Context,
 	agentStopCtx context.CancelFunc, logger zap.SugaredLogger) {
 
 	// Shutdown signal with grace period of 30 seconds
-	shutdownCtx, cancel := context.WithTimeout(agentCtx, 30*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(agentCtx, shutdownGrace)
 	defer cancel()
 
 	go func() {
@@ -404,7 +537,25 @@ func RunAgent(agentCfg config.AgentCfg) error {
 	metrics := make(chan api.Metrics, numJobs)
 	rwg := &sync.WaitGroup{}
 
-	go sigMon(agentCfg.Sig, agentCfg.AgentPCtx, agentCfg.AgentPStopCtx, agentCfg.Logger)
+	// ошибки сборщиков и отправки учитываются в самодиагностике,
+	// канал читается до завершения агента чтобы не блокировать последнюю отправку
+	go func() {
+		for err := range errCh {
+			agentCfg.Logger.Errorf("agent error %v", err)
+			agentCfg.Stats.Error(err)
+		}
+	}()
+
+	// локальный сервер статуса
+	if len(agentCfg.StatusAddr) != 0 {
+		go serveStatus(agentCfg)
+	}
+
+	// запускаем сборщики которым нужна работа в фоне
+	runners := &runnerGroup{rwg: rwg}
+	runners.restart(agentCfg)
+
+	go sigMon(agentCfg, runners)
 
 	rwg.Add(1)
 	go CollectMetrics(&counter, agentCfg, metrics, errCh, rwg)
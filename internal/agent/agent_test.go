@@ -1,23 +1,31 @@
 package agent
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/netzen86/collectmetrics/config"
+	"github.com/netzen86/collectmetrics/internal/aggregate"
 	"github.com/netzen86/collectmetrics/internal/api"
 	"github.com/netzen86/collectmetrics/internal/logger"
+	"github.com/netzen86/collectmetrics/internal/telemetry"
+	"github.com/netzen86/collectmetrics/internal/utils"
 	"github.com/stretchr/testify/assert"
 )
 
 func BenchmarkSendMetrics(b *testing.B) {
 
-	testLogger, err := logger.Logger()
-	if err != nil {
-		b.Errorf("error when get agent logger %v", err)
-	}
+	testLogger := logger.Logger()
 
 	type args struct {
 		counter   *int64
@@ -74,10 +82,7 @@ func TestSendMetrics(t *testing.T) {
 }
 
 func TestCollectMetrics(t *testing.T) {
-	testLogger, err := logger.Logger()
-	if err != nil {
-		t.Errorf("error when get agent logger %v", err)
-	}
+	testLogger := logger.Logger()
 	// defer func() {
 	// 	err = testLogger.Sync()
 	// 	if err != nil {
@@ -141,12 +146,9 @@ func TestCollectMetrics(t *testing.T) {
 
 func ExampleCollectMetrics() {
 	// инициализация логгера
-	testLogger, err := logger.Logger()
-	if err != nil {
-		panic(err)
-	}
+	testLogger := logger.Logger()
 	defer func() {
-		err = testLogger.Sync()
+		_ = testLogger.Sync()
 	}()
 
 	// оъявляем структуру с полями необходимыми для работы функции CollectMetrics
@@ -161,3 +163,205 @@ func ExampleCollectMetrics() {
 	// запускаем функцию CollectMetrics
 	go CollectMetrics(new(int64), agentCfg, make(chan api.Metrics, 32), make(chan error), &wg)
 }
+
+func TestStatusHandlers(t *testing.T) {
+	testLogger := logger.Logger()
+	agentCfg := config.AgentCfg{
+		Logger:        testLogger,
+		Endpoint:      "localhost:8080",
+		SignKeyString: "secret",
+		PollTik:       time.Millisecond,
+		ReportTik:     time.Millisecond,
+		Stats:         telemetry.NewAgentStats(),
+	}
+
+	t.Run("healthz ok after start", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		healthzHandler(agentCfg)(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+
+	t.Run("status hides sign key", func(t *testing.T) {
+		agentCfg.Stats.SendOK(time.Millisecond)
+		recorder := httptest.NewRecorder()
+		statusHandler(agentCfg)(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "secret")
+
+		var status agentStatus
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+		assert.Equal(t, "***", status.Config.SignKey)
+		assert.Equal(t, int64(1), status.Stats.Sends)
+	})
+}
+
+func TestDeliver(t *testing.T) {
+	testLogger := logger.Logger()
+
+	newServer := func(status int, hits *int64) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(hits, 1)
+			w.WriteHeader(status)
+		}))
+	}
+	var downHits, upHits int64
+	down := newServer(http.StatusInternalServerError, &downHits)
+	defer down.Close()
+	up := newServer(http.StatusOK, &upHits)
+	defer up.Close()
+
+	newEndpoint := func(server *httptest.Server) config.Endpoint {
+		return config.Endpoint{
+			EndpointCfg: config.EndpointCfg{
+				Name:     server.URL,
+				Address:  strings.TrimPrefix(server.URL, "http://"),
+				Protocol: config.ProtoHTTP,
+			},
+			PubKey:     &rsa.PublicKey{N: big.NewInt(0), E: 0},
+			HTTPClient: server.Client(),
+			Health:     telemetry.NewEndpointHealth(1, time.Minute),
+		}
+	}
+	noRetry := utils.RetryPolicy{MaxAttempts: 1}
+	value := 1.5
+	metric := api.Metrics{ID: "test", MType: api.Gauge, Value: &value}
+
+	t.Run("failover skips failed endpoint", func(t *testing.T) {
+		agentCfg := config.AgentCfg{
+			Logger:    testLogger,
+			SendMode:  config.SendFailover,
+			Endpoints: []config.Endpoint{newEndpoint(down), newEndpoint(up)},
+			Retry:     noRetry,
+		}
+		assert.NoError(t, deliver(context.Background(), agentCfg, metric))
+		assert.NoError(t, deliver(context.Background(), agentCfg, metric))
+		// после ошибки сервер исключается из отправки
+		assert.Equal(t, int64(1), atomic.LoadInt64(&downHits))
+		assert.Equal(t, int64(2), atomic.LoadInt64(&upHits))
+		assert.Equal(t, telemetry.BreakerOpen, agentCfg.Endpoints[0].Health.State().State)
+	})
+
+	t.Run("fanout sends to all", func(t *testing.T) {
+		atomic.StoreInt64(&upHits, 0)
+		second := newEndpoint(up)
+		second.Name = "second"
+		agentCfg := config.AgentCfg{
+			Logger:    testLogger,
+			SendMode:  config.SendFanout,
+			Endpoints: []config.Endpoint{newEndpoint(up), second},
+			Retry:     noRetry,
+		}
+		assert.NoError(t, deliver(context.Background(), agentCfg, metric))
+		assert.Equal(t, int64(2), atomic.LoadInt64(&upHits))
+	})
+
+	t.Run("all endpoints failed", func(t *testing.T) {
+		agentCfg := config.AgentCfg{
+			Logger:    testLogger,
+			SendMode:  config.SendFanout,
+			Endpoints: []config.Endpoint{newEndpoint(down)},
+			Retry:     noRetry,
+		}
+		assert.Error(t, deliver(context.Background(), agentCfg, metric))
+	})
+
+	t.Run("client error not retried", func(t *testing.T) {
+		var hits int64
+		rejecting := newServer(http.StatusBadRequest, &hits)
+		defer rejecting.Close()
+		agentCfg := config.AgentCfg{
+			Logger:    testLogger,
+			SendMode:  config.SendFailover,
+			Endpoints: []config.Endpoint{newEndpoint(rejecting)},
+			Retry:     utils.RetryPolicy{MaxAttempts: 3, BaseDelay: 0.001},
+		}
+		err := deliver(context.Background(), agentCfg, metric)
+		assert.True(t, utils.IsPermanent(err))
+		assert.Equal(t, int64(1), atomic.LoadInt64(&hits))
+		// сервер ответил, выключатель не размыкается
+		assert.Equal(t, telemetry.BreakerClosed, agentCfg.Endpoints[0].Health.State().State)
+	})
+
+	t.Run("unavailable retried", func(t *testing.T) {
+		var hits int64
+		busy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt64(&hits, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer busy.Close()
+		endpoint := newEndpoint(busy)
+		endpoint.Health = telemetry.NewEndpointHealth(5, time.Minute)
+		agentCfg := config.AgentCfg{
+			Logger:    testLogger,
+			SendMode:  config.SendFailover,
+			Endpoints: []config.Endpoint{endpoint},
+			Retry:     utils.RetryPolicy{MaxAttempts: 3, BaseDelay: 0.001},
+			Stats:     telemetry.NewAgentStats(),
+		}
+		assert.NoError(t, deliver(context.Background(), agentCfg, metric))
+		assert.Equal(t, int64(3), atomic.LoadInt64(&hits))
+		assert.Equal(t, int64(2), agentCfg.Stats.Snapshot().Retries)
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 2*time.Second, retryAfter("2"))
+	assert.Equal(t, time.Duration(0), retryAfter(""))
+	assert.Equal(t, time.Duration(0), retryAfter("Wed, 21 Oct 2015 07:28:00 GMT"))
+	assert.Greater(t, retryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)), 30*time.Second)
+}
+
+func TestSendMetricsAggregates(t *testing.T) {
+	testLogger := logger.Logger()
+
+	received := make(map[string]api.Metrics)
+	var mx sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var metric api.Metrics
+		reader, err := gzip.NewReader(r.Body)
+		if assert.NoError(t, err) && assert.NoError(t, json.NewDecoder(reader).Decode(&metric)) {
+			mx.Lock()
+			received[metric.ID] = metric
+			mx.Unlock()
+		}
+	}))
+	defer server.Close()
+
+	agentSCtx, agentSStopCtx := context.WithCancel(context.Background())
+	agentCfg := config.AgentCfg{
+		Logger:    testLogger,
+		AgentSCtx: agentSCtx,
+		PollTik:   time.Hour,
+		RateLimit: 2,
+		SendMode:  config.SendFailover,
+		Aggregation: aggregate.Config{Rules: []aggregate.Rule{
+			{Metric: "CPU*", Functions: []string{aggregate.Last, aggregate.Max}},
+		}},
+		Endpoints: []config.Endpoint{{
+			EndpointCfg: config.EndpointCfg{Name: "test", Address: strings.TrimPrefix(server.URL, "http://")},
+			PubKey:      &rsa.PublicKey{N: big.NewInt(0), E: 0},
+			HTTPClient:  server.Client(),
+		}},
+	}
+
+	metrics := make(chan api.Metrics, 8)
+	for _, value := range []float64{10, 30, 20} {
+		metrics <- api.Metrics{ID: "CPUutilization1", MType: api.Gauge, Value: &value}
+	}
+	for range 2 {
+		delta := int64(1)
+		metrics <- api.Metrics{ID: config.PollCount, MType: api.Counter, Delta: &delta}
+	}
+	close(metrics)
+	agentSStopCtx()
+
+	rwg := &sync.WaitGroup{}
+	rwg.Add(1)
+	SendMetrics(metrics, agentCfg, make(chan error, 1), rwg)
+
+	assert.Len(t, received, 3)
+	assert.Equal(t, 20.0, *received["CPUutilization1"].Value)
+	assert.Equal(t, 30.0, *received["CPUutilization1_max"].Value)
+	assert.Equal(t, int64(2), *received[config.PollCount].Delta)
+}
@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/netzen86/collectmetrics/config"
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/auth"
+	"github.com/netzen86/collectmetrics/internal/utils"
+	pb "github.com/netzen86/collectmetrics/proto/server"
+)
+
+// ошибка когда выключатели всех серверов разомкнуты
+var errCircuitOpen = errors.New("circuit open")
+
+// функция отправляет метрику на серверы агента с повторами по политике agentCfg.Retry.
+// В режиме failover метрика отправляется на первый доступный сервер,
+// в режиме fanout на все доступные серверы и считается отправленной
+// если ее принял хотя бы один сервер.
+func deliver(ctx context.Context, agentCfg config.AgentCfg, metric api.Metrics) error {
+	if agentCfg.SendMode == config.SendFanout {
+		return fanout(ctx, agentCfg, metric)
+	}
+	return agentCfg.Retry.Retry(ctx, func(attempt int) error {
+		if attempt > 1 {
+			agentCfg.Stats.Retry()
+		}
+		return failover(ctx, agentCfg, metric)
+	})
+}
+
+func failover(ctx context.Context, agentCfg config.AgentCfg, metric api.Metrics) error {
+	var errs []error
+	for _, endpoint := range agentCfg.Endpoints {
+		if !endpoint.Health.Allow() {
+			continue
+		}
+		err := sendTo(ctx, agentCfg, endpoint, metric)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return joinSendErrors(errs)
+}
+
+// в режиме fanout повторы выполняются для каждого сервера отдельно,
+// чтобы не отправлять метрику повторно на серверы которые ее уже приняли
+func fanout(ctx context.Context, agentCfg config.AgentCfg, metric api.Metrics) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(agentCfg.Endpoints))
+	for i, endpoint := range agentCfg.Endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = agentCfg.Retry.Retry(ctx, func(attempt int) error {
+				if attempt > 1 {
+					agentCfg.Stats.Retry()
+				}
+				if !endpoint.Health.Allow() {
+					return utils.Permanent(fmt.Errorf("endpoint %s %w", endpoint.Name, errCircuitOpen))
+				}
+				return sendTo(ctx, agentCfg, endpoint, metric)
+			})
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return joinSendErrors(errs)
+}
+
+// функция объединяет ошибки отправки на несколько серверов.
+// Если есть повторяемые ошибки возвращаются только они, чтобы повтор состоялся,
+// если серверов для отправки нет, ошибка неповторяемая.
+func joinSendErrors(errs []error) error {
+	if len(errs) == 0 {
+		return utils.Permanent(fmt.Errorf("no endpoints for sending %w", errCircuitOpen))
+	}
+	var retryable []error
+	for _, err := range errs {
+		if !utils.IsPermanent(err) {
+			retryable = append(retryable, err)
+		}
+	}
+	if len(retryable) != 0 {
+		return errors.Join(retryable...)
+	}
+	return errors.Join(errs...)
+}
+
+// функция отправляет метрику на один сервер и учитывает результат в его состоянии
+func sendTo(ctx context.Context, agentCfg config.AgentCfg, endpoint config.Endpoint, metric api.Metrics) error {
+	var err error
+	switch endpoint.Protocol {
+	case config.ProtogRPC:
+		err = sendgRPC(ctx, agentCfg, endpoint, metric)
+	default:
+		err = sendJSON(ctx, endpoint.HTTPClient, endpoint.UpdateURL(), endpoint.Key,
+			endpoint.Token, agentCfg.LocalIP, metric, endpoint.PubKey, agentCfg.Logger)
+	}
+	switch {
+	case err == nil:
+		endpoint.Health.Success()
+		return nil
+	case utils.IsPermanent(err):
+		// сервер ответил, повтор не поможет
+		endpoint.Health.Responded(err)
+	default:
+		endpoint.Health.Failure(err)
+	}
+	err = fmt.Errorf("endpoint %s %w", endpoint.Name, err)
+	agentCfg.Logger.Infof("error when sm in internal/agent %v", err)
+	return err
+}
+
+// контекст трассировки передается серверу в метаданных перехватчиком клиента
+func sendgRPC(ctx context.Context, agentCfg config.AgentCfg, endpoint config.Endpoint, metric api.Metrics) error {
+	var pbMetric pb.AddMetricRequest
+	pbMetric.Metric = &pb.Metrics{}
+
+	pbMetric.Metric.Id = metric.ID
+	pbMetric.Metric.Mtype = metric.MType
+
+	if metric.MType == api.Counter {
+		pbMetric.Metric.Delta = *metric.Delta
+	} else if metric.MType == api.Gauge {
+		pbMetric.Metric.Value = *metric.Value
+	}
+
+	var header metadata.MD
+	opts := []grpc.CallOption{grpc.Header(&header)}
+	if len(endpoint.Token) != 0 {
+		opts = append(opts, grpc.PerRPCCredentials(auth.Credentials(endpoint.Token)))
+	}
+	response, err := endpoint.CligRPC.AddMetric(ctx, &pbMetric, opts...)
+	if err != nil {
+		return grpcError(fmt.Errorf("error when sm gRPC %w", err), header)
+	}
+	agentCfg.Logger.Infoln(response.Metric.Id, response.Metric.Mtype,
+		response.Metric.Delta, response.Metric.Value)
+	return nil
+}
+
+// функция определяет можно ли повторить запрос по коду ответа gRPC,
+// для ResourceExhausted учитывается заголовок retry-after
+func grpcError(err error, header metadata.MD) error {
+	switch status.Code(err) {
+	case codes.ResourceExhausted:
+		var after time.Duration
+		if values := header.Get("retry-after"); len(values) != 0 {
+			after = retryAfter(values[0])
+		}
+		return &utils.RetryAfterError{Err: err, After: after}
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted:
+		return err
+	default:
+		return utils.Permanent(err)
+	}
+}
+
+// функция определяет можно ли повторить запрос по коду ответа http:
+// повторяются 5xx, для 429 и 503 учитывается заголовок Retry-After,
+// остальные ошибки, например неверная подпись, не повторяются
+func statusError(response *http.Response) error {
+	err := errors.New(response.Status)
+	switch {
+	case response.StatusCode == http.StatusTooManyRequests,
+		response.StatusCode == http.StatusServiceUnavailable:
+		return &utils.RetryAfterError{Err: err, After: retryAfter(response.Header.Get("Retry-After"))}
+	case response.StatusCode >= http.StatusInternalServerError:
+		return err
+	default:
+		return utils.Permanent(err)
+	}
+}
+
+// функция разбирает заголовок Retry-After в секундах или в виде даты
+func retryAfter(header string) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/netzen86/collectmetrics/config"
+	"github.com/netzen86/collectmetrics/internal/logger"
+	"github.com/netzen86/collectmetrics/internal/telemetry"
+)
+
+// минимальный интервал без успешных отправок после которого агент считается нездоровым
+const minHealthWindow time.Duration = 30 * time.Second
+
+// структура ответа страницы статуса
+type agentStatus struct {
+	Endpoints []endpointStatus   `json:"endpoints"`
+	Config    agentStatusCfg     `json:"config"`
+	Stats     telemetry.Snapshot `json:"stats"`
+}
+
+// состояние сервера для отправки метрик
+type endpointStatus struct {
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Protocol string `json:"protocol"`
+	telemetry.EndpointState
+	TLS bool `json:"tls"`
+}
+
+// конфигурация агента без секретов
+type agentStatusCfg struct {
+	Endpoint       string   `json:"address"`
+	ConfigFile     string   `json:"config_file,omitempty"`
+	PublicKeyFile  string   `json:"crypto_key,omitempty"`
+	SignKey        string   `json:"key,omitempty"`
+	SendMode       string   `json:"send_mode"`
+	Collectors     []string `json:"collectors"`
+	PollInterval   int      `json:"poll_interval"`
+	ReportInterval int      `json:"report_interval"`
+	RateLimit      int      `json:"rate_limit"`
+	EnablegRPC     bool     `json:"grpc"`
+}
+
+// функция запускает локальный сервер с /healthz, /status и pprof
+func serveStatus(agentCfg config.AgentCfg) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthzHandler(agentCfg))
+	mux.HandleFunc("/status", statusHandler(agentCfg))
+	// GET возвращает уровень логирования, PUT изменяет его
+	mux.Handle("/log-level", logger.LevelHandler())
+	// pprof регистрируется в DefaultServeMux при импорте net/http/pprof
+	mux.Handle("/debug/pprof/", http.DefaultServeMux)
+
+	server := &http.Server{Addr: agentCfg.StatusAddr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-agentCfg.AgentSCtx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	agentCfg.Logger.Infof("status server listening on %s", agentCfg.StatusAddr)
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		agentCfg.Logger.Errorf("error when start status server %v", err)
+	}
+}
+
+// healthzHandler агент здоров если за последние несколько интервалов
+// отправки была хотя бы одна успешная отправка
+func healthzHandler(agentCfg config.AgentCfg) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := agentCfg.Current()
+		window := max(3*current.ReportTik, 3*current.PollTik, minHealthWindow)
+
+		last, started := current.Stats.LastSuccess()
+		if last.IsZero() {
+			last = started
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if time.Since(last) > window {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(map[string]string{"status": "no successful sends"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	}
+}
+
+// statusHandler возвращает текущую конфигурацию и счетчики агента
+func statusHandler(agentCfg config.AgentCfg) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := agentCfg.Current()
+		status := agentStatus{
+			Config: agentStatusCfg{
+				Endpoint:       current.Endpoint,
+				ConfigFile:     current.AgnFileCfg,
+				PublicKeyFile:  current.PublicKeyFilename,
+				Collectors:     make([]string, 0, len(current.Collectors)),
+				PollInterval:   current.PollInterval,
+				ReportInterval: current.ReportInterval,
+				RateLimit:      current.RateLimit,
+				SendMode:       current.SendMode,
+				EnablegRPC:     current.EnablegRPC,
+			},
+			Endpoints: make([]endpointStatus, 0, len(current.Endpoints)),
+			Stats:     current.Stats.Snapshot(),
+		}
+		if len(current.SignKeyString) != 0 {
+			status.Config.SignKey = "***"
+		}
+		for _, endpoint := range current.Endpoints {
+			status.Endpoints = append(status.Endpoints, endpointStatus{
+				Name:          endpoint.Name,
+				Address:       endpoint.Address,
+				Protocol:      endpoint.Protocol,
+				TLS:           endpoint.TLS != nil,
+				EndpointState: endpoint.Health.State(),
+			})
+		}
+		for _, collector := range current.Collectors {
+			status.Config.Collectors = append(status.Config.Collectors, collector.Name())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			current.Logger.Errorf("error when encode agent status %v", err)
+		}
+	}
+}
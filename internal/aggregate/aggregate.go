@@ -0,0 +1,225 @@
+// Package aggregate - пакет для агрегации метрик агента за интервал отправки.
+// Значения gauge накапливаются между отправками и сворачиваются в last, min, max,
+// avg и перцентили, приращения counter суммируются.
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+// функции агрегации значений gauge
+const (
+	Last  string = "last"
+	Min   string = "min"
+	Max   string = "max"
+	Avg   string = "avg"
+	Count string = "count"
+	// maxSamples максимальное число значений метрики хранимых для перцентилей
+	maxSamples int = 10000
+)
+
+// Config настройки агрегации метрик
+type Config struct {
+	// Default функции для метрик не попавших под правила, по умолчанию last
+	Default []string `json:"default,omitempty"`
+	// Rules правила для отдельных метрик, применяется первое подходящее
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// Rule правило агрегации, Metric - имя метрики или шаблон вида Heap*
+type Rule struct {
+	Metric    string   `json:"metric"`
+	Functions []string `json:"functions"`
+}
+
+// Validate метод проверяет шаблоны и имена функций агрегации
+func (cfg Config) Validate() error {
+	if err := validFunctions(cfg.Default); err != nil {
+		return fmt.Errorf("default %w", err)
+	}
+	for _, rule := range cfg.Rules {
+		if _, err := path.Match(rule.Metric, ""); err != nil || len(rule.Metric) == 0 {
+			return fmt.Errorf("wrong metric pattern %q", rule.Metric)
+		}
+		if len(rule.Functions) == 0 {
+			return fmt.Errorf("rule %s without functions", rule.Metric)
+		}
+		if err := validFunctions(rule.Functions); err != nil {
+			return fmt.Errorf("rule %s %w", rule.Metric, err)
+		}
+	}
+	return nil
+}
+
+// Functions метод возвращает функции агрегации для метрики
+func (cfg Config) Functions(name string) []string {
+	for _, rule := range cfg.Rules {
+		if ok, _ := path.Match(rule.Metric, name); ok {
+			return rule.Functions
+		}
+	}
+	if len(cfg.Default) != 0 {
+		return cfg.Default
+	}
+	return []string{Last}
+}
+
+func validFunctions(functions []string) error {
+	for _, function := range functions {
+		switch function {
+		case Last, Min, Max, Avg, Count:
+		default:
+			if _, err := percentile(function); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// функция разбирает перцентиль вида p95 или p99.9
+func percentile(function string) (float64, error) {
+	value, ok := strings.CutPrefix(function, "p")
+	if !ok {
+		return 0, fmt.Errorf("unknown aggregate function %s", function)
+	}
+	rank, err := strconv.ParseFloat(value, 64)
+	if err != nil || rank <= 0 || rank >= 100 {
+		return 0, fmt.Errorf("wrong percentile %s", function)
+	}
+	return rank, nil
+}
+
+// значения gauge за интервал
+type gaugeSeries struct {
+	samples []float64
+	last    float64
+	min     float64
+	max     float64
+	sum     float64
+	count   int
+}
+
+// Window накопитель метрик между отправками, безопасен для конкурентного использования
+type Window struct {
+	gauges   map[string]*gaugeSeries
+	counters map[string]int64
+	// порядок появления метрик для стабильного порядка отправки
+	order []api.Metrics
+	mx    sync.Mutex
+}
+
+// NewWindow функция создания накопителя метрик
+func NewWindow() *Window {
+	return &Window{
+		gauges:   make(map[string]*gaugeSeries),
+		counters: make(map[string]int64),
+	}
+}
+
+// Add метод добавляет значение метрики в текущий интервал
+func (window *Window) Add(metric api.Metrics) {
+	window.mx.Lock()
+	defer window.mx.Unlock()
+
+	switch {
+	case metric.MType == api.Gauge && metric.Value != nil:
+		series, ok := window.gauges[metric.ID]
+		if !ok {
+			series = &gaugeSeries{min: math.Inf(1), max: math.Inf(-1)}
+			window.gauges[metric.ID] = series
+			window.order = append(window.order, api.Metrics{ID: metric.ID, MType: api.Gauge})
+		}
+		value := *metric.Value
+		series.last = value
+		series.min = min(series.min, value)
+		series.max = max(series.max, value)
+		series.sum += value
+		series.count++
+		if len(series.samples) < maxSamples {
+			series.samples = append(series.samples, value)
+		}
+	case metric.MType == api.Counter && metric.Delta != nil:
+		if _, ok := window.counters[metric.ID]; !ok {
+			window.order = append(window.order, api.Metrics{ID: metric.ID, MType: api.Counter})
+		}
+		window.counters[metric.ID] += *metric.Delta
+	}
+}
+
+// Len метод возвращает число метрик ожидающих отправки
+func (window *Window) Len() int {
+	window.mx.Lock()
+	defer window.mx.Unlock()
+	return len(window.order)
+}
+
+// Flush метод сворачивает накопленные значения по правилам агрегации
+// и начинает новый интервал. Функция last отправляется под исходным именем,
+// остальные функции под именем с суффиксом, например Alloc_max или Alloc_p95.
+func (window *Window) Flush(cfg Config) []api.Metrics {
+	window.mx.Lock()
+	gauges, counters, order := window.gauges, window.counters, window.order
+	window.gauges = make(map[string]*gaugeSeries)
+	window.counters = make(map[string]int64)
+	window.order = nil
+	window.mx.Unlock()
+
+	metrics := make([]api.Metrics, 0, len(order))
+	for _, metric := range order {
+		if metric.MType == api.Counter {
+			delta := counters[metric.ID]
+			metrics = append(metrics, api.Metrics{ID: metric.ID, MType: api.Counter, Delta: &delta})
+			continue
+		}
+		series := gauges[metric.ID]
+		for _, function := range cfg.Functions(metric.ID) {
+			value, err := series.aggregate(function)
+			if err != nil {
+				continue
+			}
+			name := metric.ID
+			if function != Last {
+				name += "_" + strings.ReplaceAll(function, ".", "_")
+			}
+			metrics = append(metrics, api.Metrics{ID: name, MType: api.Gauge, Value: &value})
+		}
+	}
+	return metrics
+}
+
+func (series *gaugeSeries) aggregate(function string) (float64, error) {
+	switch function {
+	case Last:
+		return series.last, nil
+	case Min:
+		return series.min, nil
+	case Max:
+		return series.max, nil
+	case Avg:
+		return series.sum / float64(series.count), nil
+	case Count:
+		return float64(series.count), nil
+	}
+	rank, err := percentile(function)
+	if err != nil {
+		return 0, err
+	}
+	if len(series.samples) == 0 {
+		return 0, errors.New("no samples")
+	}
+	sorted := append([]float64(nil), series.samples...)
+	sort.Float64s(sorted)
+	// перцентиль по методу ближайшего ранга
+	idx := int(math.Ceil(rank/100*float64(len(sorted)))) - 1
+	return sorted[max(idx, 0)], nil
+}
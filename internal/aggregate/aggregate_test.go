@@ -0,0 +1,74 @@
+package aggregate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+func gauge(name string, value float64) api.Metrics {
+	return api.Metrics{ID: name, MType: api.Gauge, Value: &value}
+}
+
+func counter(name string, delta int64) api.Metrics {
+	return api.Metrics{ID: name, MType: api.Counter, Delta: &delta}
+}
+
+func TestWindowFlush(t *testing.T) {
+	cfg := Config{Rules: []Rule{
+		{Metric: "Heap*", Functions: []string{Last, Min, Max, Avg, "p50", "p99.9"}},
+	}}
+	window := NewWindow()
+	for _, value := range []float64{4, 1, 3, 2} {
+		window.Add(gauge("HeapAlloc", value))
+		window.Add(gauge("RandomValue", value))
+	}
+	window.Add(counter("PollCount", 2))
+	window.Add(counter("PollCount", 3))
+	assert.Equal(t, 3, window.Len())
+
+	got := make(map[string]api.Metrics)
+	for _, metric := range window.Flush(cfg) {
+		got[metric.ID] = metric
+	}
+	assert.Len(t, got, 8)
+	assert.Equal(t, 2.0, *got["HeapAlloc"].Value)
+	assert.Equal(t, 1.0, *got["HeapAlloc_min"].Value)
+	assert.Equal(t, 4.0, *got["HeapAlloc_max"].Value)
+	assert.Equal(t, 2.5, *got["HeapAlloc_avg"].Value)
+	assert.Equal(t, 2.0, *got["HeapAlloc_p50"].Value)
+	assert.Equal(t, 4.0, *got["HeapAlloc_p99_9"].Value)
+	// по умолчанию отправляется последнее значение
+	assert.Equal(t, 2.0, *got["RandomValue"].Value)
+	assert.Equal(t, int64(5), *got["PollCount"].Delta)
+
+	// после отправки начинается новый интервал
+	assert.Empty(t, window.Flush(cfg))
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "empty", cfg: Config{}},
+		{name: "valid", cfg: Config{Default: []string{Last, "p95"}, Rules: []Rule{{Metric: "CPU*", Functions: []string{Max}}}}},
+		{name: "unknown function", cfg: Config{Default: []string{"median"}}, wantErr: true},
+		{name: "wrong percentile", cfg: Config{Default: []string{"p100"}}, wantErr: true},
+		{name: "wrong pattern", cfg: Config{Rules: []Rule{{Metric: "[", Functions: []string{Max}}}}, wantErr: true},
+		{name: "without functions", cfg: Config{Rules: []Rule{{Metric: "Alloc"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
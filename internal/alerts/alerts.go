@@ -0,0 +1,147 @@
+// Package alerts - пакет правил оповещения о выходе метрик за пороговые значения
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+// интервал проверки правил по умолчанию в секундах
+const evalInterval float64 = 10
+
+// операции сравнения значения метрики с порогом
+const (
+	OpGreater      string = ">"
+	OpGreaterEqual string = ">="
+	OpLess         string = "<"
+	OpLessEqual    string = "<="
+	OpEqual        string = "=="
+	OpNotEqual     string = "!="
+)
+
+// состояния оповещения
+const (
+	StatePending  string = "pending"
+	StateFiring   string = "firing"
+	StateResolved string = "resolved"
+)
+
+// Config правила оповещения из файла
+type Config struct {
+	// Webhooks адреса на которые отправляются оповещения всех правил
+	Webhooks []string `json:"webhooks,omitempty"`
+	Rules    []Rule   `json:"rules"`
+	// Interval интервал проверки правил в секундах
+	Interval float64 `json:"interval,omitempty"`
+}
+
+// Rule правило оповещения: метрика Metric сравнивается с порогом Threshold,
+// оповещение срабатывает если условие выполняется не меньше For секунд
+type Rule struct {
+	Name   string `json:"name"`
+	Metric string `json:"metric"`
+	// Type тип метрики gauge или counter, если не задан проверяется метрика с любым типом
+	Type      string  `json:"type,omitempty"`
+	Op        string  `json:"op"`
+	Threshold float64 `json:"threshold"`
+	For       float64 `json:"for,omitempty"`
+}
+
+// LoadConfig функция читает правила оповещения из файла формата json
+func LoadConfig(filename string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Config{}, fmt.Errorf("error when read alerts file %w", err)
+	}
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return Config{}, fmt.Errorf("error when unmarshal alerts file %w", err)
+	}
+	err = cfg.Validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("error in alerts file %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate метод проверяет правила оповещения
+func (cfg Config) Validate() error {
+	if cfg.Interval < 0 {
+		return fmt.Errorf("interval must not be negative")
+	}
+	names := make(map[string]bool, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		if len(rule.Name) == 0 || len(rule.Metric) == 0 {
+			return fmt.Errorf("rule must have name and metric")
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate rule %s", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Type != "" && rule.Type != api.Gauge && rule.Type != api.Counter {
+			return fmt.Errorf("rule %s wrong metric type %s", rule.Name, rule.Type)
+		}
+		if _, err := compare(rule.Op, 0, 0); err != nil {
+			return fmt.Errorf("rule %s %w", rule.Name, err)
+		}
+		if rule.For < 0 {
+			return fmt.Errorf("rule %s for must not be negative", rule.Name)
+		}
+	}
+	return nil
+}
+
+// метод возвращает интервал проверки правил
+func (cfg Config) interval() time.Duration {
+	if cfg.Interval == 0 {
+		return time.Duration(evalInterval * float64(time.Second))
+	}
+	return time.Duration(cfg.Interval * float64(time.Second))
+}
+
+// метод возвращает время в течение которого условие должно выполняться
+func (rule Rule) forDuration() time.Duration {
+	return time.Duration(rule.For * float64(time.Second))
+}
+
+// метод проверяет условие правила для метрики
+func (rule Rule) match(metric api.Metrics) (float64, bool) {
+	if rule.Type != "" && rule.Type != metric.MType {
+		return 0, false
+	}
+	var value float64
+	switch {
+	case metric.Value != nil:
+		value = *metric.Value
+	case metric.Delta != nil:
+		value = float64(*metric.Delta)
+	default:
+		return 0, false
+	}
+	ok, _ := compare(rule.Op, value, rule.Threshold)
+	return value, ok
+}
+
+func compare(op string, value, threshold float64) (bool, error) {
+	switch op {
+	case OpGreater:
+		return value > threshold, nil
+	case OpGreaterEqual:
+		return value >= threshold, nil
+	case OpLess:
+		return value < threshold, nil
+	case OpLessEqual:
+		return value <= threshold, nil
+	case OpEqual:
+		return value == threshold, nil
+	case OpNotEqual:
+		return value != threshold, nil
+	default:
+		return false, fmt.Errorf("wrong comparison %q", op)
+	}
+}
@@ -0,0 +1,130 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/repositories/memstorage"
+)
+
+func TestEngine(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	ctx := context.Background()
+
+	var received []Alert
+	var mx sync.Mutex
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		if assert.NoError(t, json.NewDecoder(r.Body).Decode(&alert)) {
+			mx.Lock()
+			received = append(received, alert)
+			mx.Unlock()
+		}
+	}))
+	defer webhook.Close()
+
+	storage := memstorage.NewMemStorage()
+	cfg := Config{
+		Webhooks: []string{webhook.URL},
+		Rules: []Rule{
+			{Name: "high_cpu", Metric: "CPUutilization1", Op: OpGreater, Threshold: 90, For: 60},
+			{Name: "many_polls", Metric: "PollCount", Type: api.Counter, Op: OpGreaterEqual, Threshold: 10},
+		},
+	}
+	require.NoError(t, cfg.Validate())
+	engine := NewEngine(cfg, storage, logger)
+	now := time.Unix(1000, 0)
+	engine.now = func() time.Time { return now }
+
+	require.NoError(t, storage.UpdateParam(ctx, false, api.Gauge, "CPUutilization1", 95.0, logger))
+	require.NoError(t, storage.UpdateParam(ctx, false, api.Counter, "PollCount", int64(5), logger))
+	require.NoError(t, engine.Evaluate(ctx))
+	active := engine.Active()
+	require.Len(t, active, 1)
+	assert.Equal(t, StatePending, active[0].State)
+	assert.Empty(t, received)
+
+	// условие выполняется дольше for - оповещение срабатывает
+	now = now.Add(time.Minute)
+	require.NoError(t, storage.UpdateParam(ctx, false, api.Counter, "PollCount", int64(10), logger))
+	require.NoError(t, engine.Evaluate(ctx))
+	active = engine.Active()
+	require.Len(t, active, 2)
+	assert.Equal(t, StateFiring, active[0].State)
+	assert.Equal(t, 95.0, active[0].Value)
+	assert.Equal(t, StateFiring, active[1].State)
+	require.Len(t, received, 2)
+
+	// повторная проверка не отправляет оповещение еще раз
+	require.NoError(t, engine.Evaluate(ctx))
+	assert.Len(t, received, 2)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, storage.UpdateParam(ctx, false, api.Gauge, "CPUutilization1", 10.0, logger))
+	require.NoError(t, engine.Evaluate(ctx))
+	active = engine.Active()
+	require.Len(t, active, 1)
+	assert.Equal(t, "many_polls", active[0].Rule)
+	require.Len(t, received, 3)
+	assert.Equal(t, "high_cpu", received[2].Rule)
+	assert.Equal(t, StateResolved, received[2].State)
+	assert.Equal(t, now, received[2].ResolvedAt.In(now.Location()))
+}
+
+func TestPendingNotResolved(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	ctx := context.Background()
+	storage := memstorage.NewMemStorage()
+	engine := NewEngine(Config{Rules: []Rule{
+		{Name: "low_memory", Metric: "FreeMemory", Op: OpLess, Threshold: 100, For: 60},
+	}}, storage, logger)
+
+	require.NoError(t, engine.Evaluate(ctx))
+	assert.Empty(t, engine.Active())
+
+	require.NoError(t, storage.UpdateParam(ctx, false, api.Gauge, "FreeMemory", 50.0, logger))
+	require.NoError(t, engine.Evaluate(ctx))
+	assert.Len(t, engine.Active(), 1)
+
+	require.NoError(t, storage.UpdateParam(ctx, false, api.Gauge, "FreeMemory", 500.0, logger))
+	require.NoError(t, engine.Evaluate(ctx))
+	assert.Empty(t, engine.Active())
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+		return path
+	}
+
+	cfg, err := LoadConfig(write("alerts.json", `{
+		"interval": 5,
+		"webhooks": ["http://localhost:9000/hook"],
+		"rules": [{"name": "high_cpu", "metric": "CPUutilization1", "op": ">", "threshold": 90, "for": 60}]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, cfg.interval())
+	assert.Equal(t, time.Minute, cfg.Rules[0].forDuration())
+
+	_, err = LoadConfig(write("op.json", `{"rules": [{"name": "a", "metric": "m", "op": "=>"}]}`))
+	assert.Error(t, err)
+	_, err = LoadConfig(write("dup.json", `{"rules": [{"name": "a", "metric": "m", "op": ">"},
+		{"name": "a", "metric": "n", "op": "<"}]}`))
+	assert.Error(t, err)
+	_, err = LoadConfig(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
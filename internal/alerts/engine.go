@@ -0,0 +1,191 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/repositories"
+)
+
+// таймаут отправки оповещения на webhook
+const webhookTimeout = 5 * time.Second
+
+// Alert оповещение по правилу
+type Alert struct {
+	// ActiveAt время с которого выполняется условие правила
+	ActiveAt   time.Time `json:"active_at"`
+	FiredAt    time.Time `json:"fired_at,omitempty"`
+	ResolvedAt time.Time `json:"resolved_at,omitempty"`
+	Rule       string    `json:"rule"`
+	Metric     string    `json:"metric"`
+	State      string    `json:"state"`
+	Op         string    `json:"op"`
+	Threshold  float64   `json:"threshold"`
+	Value      float64   `json:"value"`
+}
+
+// Engine проверяет правила оповещения по метрикам из хранилища.
+// Условие правила переводит оповещение в состояние pending, если условие
+// выполняется For секунд оповещение переходит в firing, когда условие
+// перестает выполняться - в resolved. Переходы в firing и resolved
+// отправляются на webhook.
+type Engine struct {
+	storage repositories.Repo
+	client  *http.Client
+	alerts  map[string]*Alert
+	now     func() time.Time
+	logger  zap.SugaredLogger
+	cfg     Config
+	mx      sync.RWMutex
+}
+
+// NewEngine функция создания обработчика правил оповещения
+func NewEngine(cfg Config, storage repositories.Repo, logger zap.SugaredLogger) *Engine {
+	return &Engine{
+		storage: storage,
+		client:  &http.Client{Timeout: webhookTimeout},
+		alerts:  make(map[string]*Alert),
+		now:     time.Now,
+		logger:  logger,
+		cfg:     cfg,
+	}
+}
+
+// Run метод проверяет правила с интервалом из конфигурации до завершения контекста
+func (engine *Engine) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(engine.cfg.interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			engine.logger.Info("stop alerts evaluation")
+			return
+		case <-ticker.C:
+			err := engine.Evaluate(ctx)
+			if err != nil {
+				engine.logger.Warnf("error when evaluating alerts %v", err)
+			}
+		}
+	}
+}
+
+// Evaluate метод один раз проверяет все правила и отправляет оповещения
+func (engine *Engine) Evaluate(ctx context.Context) error {
+	metrics, err := engine.storage.GetAllMetrics(ctx, engine.logger)
+	if err != nil {
+		return fmt.Errorf("error when getting all metrics %w", err)
+	}
+
+	var notify []Alert
+	engine.mx.Lock()
+	now := engine.now()
+	for _, rule := range engine.cfg.Rules {
+		if alert, changed := engine.evaluateRule(rule, metrics.Metrics, now); changed {
+			notify = append(notify, alert)
+		}
+	}
+	engine.mx.Unlock()
+
+	for _, alert := range notify {
+		engine.notify(ctx, alert)
+	}
+	return nil
+}
+
+// метод обновляет состояние оповещения правила и сообщает
+// нужно ли отправить оповещение
+func (engine *Engine) evaluateRule(rule Rule, metrics map[string]api.Metrics,
+	now time.Time) (Alert, bool) {
+	var value float64
+	var active bool
+	if metric, ok := metrics[rule.Metric]; ok {
+		value, active = rule.match(metric)
+	}
+
+	alert, ok := engine.alerts[rule.Name]
+	switch {
+	case active && !ok:
+		alert = &Alert{
+			ActiveAt:  now,
+			Rule:      rule.Name,
+			Metric:    rule.Metric,
+			State:     StatePending,
+			Op:        rule.Op,
+			Threshold: rule.Threshold,
+		}
+		engine.alerts[rule.Name] = alert
+	case !active && !ok:
+		return Alert{}, false
+	case !active && alert.State == StatePending:
+		delete(engine.alerts, rule.Name)
+		return Alert{}, false
+	case !active:
+		delete(engine.alerts, rule.Name)
+		alert.State = StateResolved
+		alert.ResolvedAt = now
+		return *alert, true
+	}
+
+	alert.Value = value
+	if alert.State == StatePending && now.Sub(alert.ActiveAt) >= rule.forDuration() {
+		alert.State = StateFiring
+		alert.FiredAt = now
+		return *alert, true
+	}
+	return Alert{}, false
+}
+
+// метод отправляет оповещение на все webhook, ошибки пишутся в лог
+func (engine *Engine) notify(ctx context.Context, alert Alert) {
+	engine.logger.Infoln("alert", alert.Rule, alert.State, "metric", alert.Metric, "value", alert.Value)
+	body, err := json.Marshal(alert)
+	if err != nil {
+		engine.logger.Warnf("error when marshal alert %v", err)
+		return
+	}
+	for _, url := range engine.cfg.Webhooks {
+		err = engine.send(ctx, url, body)
+		if err != nil {
+			engine.logger.Warnf("error when sending alert %s to %s %v", alert.Rule, url, err)
+		}
+	}
+}
+
+func (engine *Engine) send(ctx context.Context, url string, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error when create request %w", err)
+	}
+	request.Header.Set("Content-Type", api.Js)
+	response, err := engine.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook response %s", response.Status)
+	}
+	return nil
+}
+
+// Active метод возвращает оповещения в состояниях pending и firing
+func (engine *Engine) Active() []Alert {
+	engine.mx.RLock()
+	defer engine.mx.RUnlock()
+	alerts := make([]Alert, 0, len(engine.alerts))
+	for _, alert := range engine.alerts {
+		alerts = append(alerts, *alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Rule < alerts[j].Rule })
+	return alerts
+}
@@ -1,17 +1,18 @@
 // Package api - пакет содержит общие константы и структуры общие для сервера и агента
 package api
 
+import "strings"
+
 // константы с типом контернта, и типом метрик
 const (
-	Th           string = "text"
-	HTML         string = "text/html"
-	Js           string = "application/json"
-	Gz           string = "gzip"
-	CryptRSA     string = "CryptRSA"
-	TemplatePath string = "/web/template/metrics.html"
-	Gauge        string = "gauge"
-	Counter      string = "counter"
-	ACLHeader    string = "X-Real-IP"
+	Th        string = "text"
+	HTML      string = "text/html"
+	Js        string = "application/json"
+	Gz        string = "gzip"
+	CryptRSA  string = "CryptRSA"
+	Gauge     string = "gauge"
+	Counter   string = "counter"
+	ACLHeader string = "X-Real-IP"
 )
 
 // Metrics структура для передачи метрик
@@ -22,6 +23,32 @@ type Metrics struct {
 	MType string   `json:"type"`
 }
 
+// NewGauge функция для создания метрики типа gauge
+func NewGauge(name string, value float64) Metrics {
+	return Metrics{ID: name, MType: Gauge, Value: &value}
+}
+
+// NewCounter функция для создания метрики типа counter
+func NewCounter(name string, delta int64) Metrics {
+	return Metrics{ID: name, MType: Counter, Delta: &delta}
+}
+
+// SanitizeName функция заменяет в имени метрики все символы
+// кроме латинских букв, цифр и подчеркивания на подчеркивание
+func SanitizeName(name string) string {
+	var sb strings.Builder
+	sb.Grow(len(name))
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
 // MetricsMap структура для передачи метрик между функциями
 type MetricsMap struct {
 	Metrics map[string]Metrics
@@ -0,0 +1,101 @@
+// Package audit - пакет журнала аудита изменений метрик. Каждое принятое
+// изменение записывается с клиентом, способом передачи, старым и новым значением.
+package audit
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// способы передачи метрик на сервер
+const (
+	TransportURI      string = "http-uri"
+	TransportJSON     string = "http-json"
+	TransportGRPC     string = "grpc"
+	TransportOTLP     string = "otlp"
+	TransportInflux   string = "influx"
+	TransportGraphite string = "graphite"
+	// TransportRestore загрузка метрик из файла при запуске сервера
+	TransportRestore string = "restore"
+)
+
+// Entry запись журнала аудита, для counter заполняются поля Delta, для gauge поля Value.
+// Старое значение отсутствует если метрики не было в хранилище
+type Entry struct {
+	Time      time.Time `json:"time"`
+	OldDelta  *int64    `json:"old_delta,omitempty"`
+	NewDelta  *int64    `json:"new_delta,omitempty"`
+	OldValue  *float64  `json:"old_value,omitempty"`
+	NewValue  *float64  `json:"new_value,omitempty"`
+	Client    string    `json:"client,omitempty"`
+	Agent     string    `json:"agent,omitempty"`
+	Transport string    `json:"transport"`
+	Endpoint  string    `json:"endpoint,omitempty"`
+	MType     string    `json:"type"`
+	ID        string    `json:"id"`
+	Signed    bool      `json:"signed"`
+	Encrypted bool      `json:"encrypted"`
+}
+
+// Request сведения о запросе изменяющем метрики
+type Request struct {
+	// Client IP адрес соединения
+	Client string
+	// Agent адрес агента из заголовка X-Real-IP
+	Agent string
+	// Transport способ передачи
+	Transport string
+	// Endpoint путь запроса http, метод gRPC или файл
+	Endpoint  string
+	Signed    bool
+	Encrypted bool
+}
+
+type requestKey struct{}
+
+// WithRequest функция сохраняет сведения о запросе в контексте,
+// изменения метрик без них не попадают в журнал
+func WithRequest(ctx context.Context, request Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, request)
+}
+
+// RequestFrom функция возвращает сведения о запросе из контекста
+func RequestFrom(ctx context.Context) (Request, bool) {
+	request, ok := ctx.Value(requestKey{}).(Request)
+	return request, ok
+}
+
+// Filter условия выборки записей журнала, пустые поля не ограничивают выборку
+type Filter struct {
+	Since     time.Time
+	Until     time.Time
+	Client    string
+	Transport string
+	MType     string
+	ID        string
+	// Limit число последних подходящих записей
+	Limit int
+}
+
+// метод проверяет подходит ли запись под условия
+func (filter Filter) match(entry Entry) bool {
+	switch {
+	case !filter.Since.IsZero() && entry.Time.Before(filter.Since),
+		!filter.Until.IsZero() && entry.Time.After(filter.Until),
+		len(filter.Client) != 0 && filter.Client != entry.Client && filter.Client != entry.Agent,
+		len(filter.Transport) != 0 && filter.Transport != entry.Transport,
+		len(filter.MType) != 0 && filter.MType != entry.MType,
+		len(filter.ID) != 0 && filter.ID != entry.ID:
+		return false
+	}
+	return true
+}
+
+// Log журнал аудита, записи только добавляются
+type Log interface {
+	io.Closer
+	Append(ctx context.Context, entry Entry) error
+	// Query возвращает подходящие записи в порядке записи
+	Query(ctx context.Context, filter Filter) ([]Entry, error)
+}
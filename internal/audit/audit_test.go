@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/repositories/memstorage"
+)
+
+func TestFileLog(t *testing.T) {
+	ctx := context.Background()
+	name := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := NewFileLog(name)
+	require.NoError(t, err)
+
+	start := time.Now().UTC()
+	for i, id := range []string{"Alloc", "PollCount", "Alloc"} {
+		require.NoError(t, log.Append(ctx, Entry{
+			Time: start.Add(time.Duration(i) * time.Second), Transport: TransportJSON, MType: api.Gauge, ID: id}))
+	}
+	require.NoError(t, log.Close())
+
+	// после повторного открытия записи дописываются в конец
+	log, err = NewFileLog(name)
+	require.NoError(t, err)
+	defer log.Close()
+	require.NoError(t, log.Append(ctx, Entry{Time: start.Add(3 * time.Second), Transport: TransportGRPC,
+		MType: api.Counter, ID: "PollCount", Client: "10.0.0.1"}))
+
+	entries, err := log.Query(ctx, Filter{})
+	require.NoError(t, err)
+	assert.Len(t, entries, 4)
+
+	entries, err = log.Query(ctx, Filter{ID: "Alloc", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, start.Add(2*time.Second), entries[0].Time)
+
+	entries, err = log.Query(ctx, Filter{Client: "10.0.0.1", Since: start.Add(time.Second)})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, TransportGRPC, entries[0].Transport)
+}
+
+func TestStorage(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	log, err := NewFileLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+	require.NoError(t, err)
+	defer log.Close()
+	storage := NewStorage(memstorage.NewMemStorage(), log)
+
+	// изменения без сведений о запросе не записываются
+	require.NoError(t, storage.UpdateParam(context.Background(), false, api.Counter, "PollCount", int64(2), *logger))
+
+	ctx := WithRequest(context.Background(), Request{Client: "127.0.0.1", Agent: "10.0.0.5",
+		Transport: TransportJSON, Endpoint: "/updates/", Signed: true})
+	require.NoError(t, storage.UpdateParam(ctx, false, api.Counter, "PollCount", int64(3), *logger))
+	require.NoError(t, storage.UpdateParam(ctx, false, api.Gauge, "Alloc", 1.5, *logger))
+	require.Error(t, storage.UpdateParam(ctx, false, "wrong", "Alloc", 1.5, *logger))
+
+	entries, err := log.Query(ctx, Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, int64(2), *entries[0].OldDelta)
+	assert.Equal(t, int64(5), *entries[0].NewDelta)
+	assert.Equal(t, "10.0.0.5", entries[0].Agent)
+	assert.True(t, entries[0].Signed)
+	assert.Nil(t, entries[1].OldValue)
+	assert.Equal(t, 1.5, *entries[1].NewValue)
+}
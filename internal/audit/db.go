@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DBLog журнал аудита в таблице audit базы данных хранилища, записи только вставляются
+type DBLog struct {
+	db *sql.DB
+}
+
+// NewDBLog функция создает таблицу журнала аудита если ее нет
+func NewDBLog(ctx context.Context, db *sql.DB) (*DBLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	stmt := `CREATE TABLE IF NOT EXISTS audit
+	("id" BIGSERIAL PRIMARY KEY, "time" TIMESTAMPTZ NOT NULL, "client" TEXT, "agent" TEXT,
+	"transport" TEXT, "endpoint" TEXT, "type" TEXT, "name" TEXT,
+	"old_delta" BIGINT, "new_delta" BIGINT, "old_value" FLOAT8, "new_value" FLOAT8,
+	"signed" BOOLEAN, "encrypted" BOOLEAN)`
+	_, err := db.ExecContext(ctx, stmt)
+	if err != nil {
+		return nil, fmt.Errorf("create table error - %w", err)
+	}
+	return &DBLog{db: db}, nil
+}
+
+// Append метод вставляет запись в таблицу
+func (log *DBLog) Append(ctx context.Context, entry Entry) error {
+	stmt := `
+	INSERT INTO audit (time, client, agent, transport, endpoint, type, name,
+	  old_delta, new_delta, old_value, new_value, signed, encrypted)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+	_, err := log.db.ExecContext(ctx, stmt, entry.Time, entry.Client, entry.Agent, entry.Transport,
+		entry.Endpoint, entry.MType, entry.ID, entry.OldDelta, entry.NewDelta, entry.OldValue,
+		entry.NewValue, entry.Signed, entry.Encrypted)
+	if err != nil {
+		return fmt.Errorf("insert in table error - %w", err)
+	}
+	return nil
+}
+
+// Query метод выбирает последние подходящие записи из таблицы
+func (log *DBLog) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	var where []string
+	var args []interface{}
+	cond := func(expr string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, expr+" $"+strconv.Itoa(len(args)))
+	}
+	if !filter.Since.IsZero() {
+		cond("time >=", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		cond("time <=", filter.Until)
+	}
+	if len(filter.Client) != 0 {
+		args = append(args, filter.Client)
+		where = append(where, fmt.Sprintf("(client = $%d OR agent = $%d)", len(args), len(args)))
+	}
+	if len(filter.Transport) != 0 {
+		cond("transport =", filter.Transport)
+	}
+	if len(filter.MType) != 0 {
+		cond("type =", filter.MType)
+	}
+	if len(filter.ID) != 0 {
+		cond("name =", filter.ID)
+	}
+
+	smtp := `SELECT time, client, agent, transport, endpoint, type, name,
+	old_delta, new_delta, old_value, new_value, signed, encrypted FROM audit`
+	if len(where) != 0 {
+		smtp += " WHERE " + strings.Join(where, " AND ")
+	}
+	smtp += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		smtp += " LIMIT " + strconv.Itoa(filter.Limit)
+	}
+
+	rows, err := log.db.QueryContext(ctx, smtp, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error when execute select %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		err = rows.Scan(&entry.Time, &entry.Client, &entry.Agent, &entry.Transport, &entry.Endpoint,
+			&entry.MType, &entry.ID, &entry.OldDelta, &entry.NewDelta, &entry.OldValue,
+			&entry.NewValue, &entry.Signed, &entry.Encrypted)
+		if err != nil {
+			return nil, fmt.Errorf("error scan %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("errors rows %w", err)
+	}
+
+	// записи выбраны от новых к старым
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// Close метод ничего не делает, соединением с базой данных владеет хранилище
+func (log *DBLog) Close() error {
+	return nil
+}
@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// максимальная длина строки журнала
+const maxLine = 64 * 1024
+
+// FileLog журнал аудита в файле JSONL, файл открывается только на дозапись
+type FileLog struct {
+	file *os.File
+	name string
+	mx   sync.Mutex
+}
+
+// NewFileLog функция открывает файл журнала аудита
+func NewFileLog(name string) (*FileLog, error) {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error when open audit file %w", err)
+	}
+	return &FileLog{file: file, name: name}, nil
+}
+
+// Append метод дописывает запись в файл одной строкой
+func (log *FileLog) Append(ctx context.Context, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error when marshal audit entry %w", err)
+	}
+	log.mx.Lock()
+	defer log.mx.Unlock()
+	_, err = log.file.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("error when write audit entry %w", err)
+	}
+	return nil
+}
+
+// Query метод читает файл и возвращает последние подходящие записи
+func (log *FileLog) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	log.mx.Lock()
+	defer log.mx.Unlock()
+
+	file, err := os.Open(log.name)
+	if err != nil {
+		return nil, fmt.Errorf("error when open audit file %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, maxLine), maxLine)
+	for line := 1; scanner.Scan(); line++ {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		var entry Entry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("error when decode audit line %d %w", line, err)
+		}
+		if !filter.match(entry) {
+			continue
+		}
+		entries = append(entries, entry)
+		if filter.Limit > 0 && len(entries) > filter.Limit {
+			entries = entries[1:]
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error when read audit file %w", err)
+	}
+	return entries, nil
+}
+
+// Close метод закрывает файл журнала
+func (log *FileLog) Close() error {
+	log.mx.Lock()
+	defer log.mx.Unlock()
+	return log.file.Close()
+}
@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/repositories"
+)
+
+// Storage хранилище записывающее в журнал аудита изменения метрик,
+// сведения о запросе берутся из контекста
+type Storage struct {
+	repositories.Repo
+	log Log
+	// чтение старого значения, обновление и чтение нового выполняются вместе
+	mx sync.Mutex
+}
+
+// NewStorage функция оборачивает хранилище для записи изменений в журнал аудита
+func NewStorage(storage repositories.Repo, log Log) *Storage {
+	return &Storage{Repo: storage, log: log}
+}
+
+// Unwrap метод возвращает обернутое хранилище
+func (storage *Storage) Unwrap() repositories.Repo {
+	return storage.Repo
+}
+
+// UpdateParam метод обновляет метрику и записывает изменение в журнал,
+// ошибка записи в журнал не отменяет обновление
+func (storage *Storage) UpdateParam(ctx context.Context, cntSummed bool, metricType, metricName string,
+	metricValue interface{}, srvlog zap.SugaredLogger) error {
+	request, ok := RequestFrom(ctx)
+	if !ok {
+		return storage.Repo.UpdateParam(ctx, cntSummed, metricType, metricName, metricValue, srvlog)
+	}
+
+	storage.mx.Lock()
+	entry := Entry{
+		Client:    request.Client,
+		Agent:     request.Agent,
+		Transport: request.Transport,
+		Endpoint:  request.Endpoint,
+		MType:     metricType,
+		ID:        metricName,
+		Signed:    request.Signed,
+		Encrypted: request.Encrypted,
+	}
+	entry.OldDelta, entry.OldValue = storage.value(ctx, metricType, metricName, srvlog)
+	err := storage.Repo.UpdateParam(ctx, cntSummed, metricType, metricName, metricValue, srvlog)
+	if err != nil {
+		storage.mx.Unlock()
+		return err
+	}
+	entry.NewDelta, entry.NewValue = storage.value(ctx, metricType, metricName, srvlog)
+	storage.mx.Unlock()
+
+	entry.Time = time.Now().UTC()
+	if err = storage.log.Append(ctx, entry); err != nil {
+		srvlog.Errorf("error when append audit entry %v", err)
+	}
+	return nil
+}
+
+// метод возвращает текущее значение метрики, nil если метрики нет в хранилище
+func (storage *Storage) value(ctx context.Context, metricType, metricName string,
+	srvlog zap.SugaredLogger) (*int64, *float64) {
+	switch metricType {
+	case api.Counter:
+		delta, err := storage.Repo.GetCounterMetric(ctx, metricName, srvlog)
+		if err != nil {
+			return nil, nil
+		}
+		return &delta, nil
+	case api.Gauge:
+		value, err := storage.Repo.GetGaugeMetric(ctx, metricName, srvlog)
+		if err != nil {
+			return nil, nil
+		}
+		return nil, &value
+	}
+	return nil, nil
+}
@@ -0,0 +1,121 @@
+// Package auth - пакет проверки доступа к серверу по токенам. Токен дает роли
+// read, write или admin и может быть ограничен префиксами имен метрик.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Role роль токена
+type Role string
+
+// роли токенов, admin дает все права
+const (
+	RoleRead  Role = "read"
+	RoleWrite Role = "write"
+	RoleAdmin Role = "admin"
+)
+
+// схема заголовка Authorization
+const bearerScheme = "Bearer "
+
+var (
+	// ErrUnauthenticated ошибка отсутствующего или неизвестного токена
+	ErrUnauthenticated = errors.New("missing or unknown token")
+	// ErrNotFound ошибка отзыва неизвестного токена
+	ErrNotFound = errors.New("token not found")
+)
+
+// ParseRole функция проверяет имя роли
+func ParseRole(name string) (Role, error) {
+	switch role := Role(name); role {
+	case RoleRead, RoleWrite, RoleAdmin:
+		return role, nil
+	}
+	return "", fmt.Errorf("unknown role %q", name)
+}
+
+// Token описание токена, сам токен не хранится, только его хэш
+type Token struct {
+	Created  time.Time `json:"created"`
+	ID       string    `json:"id"`
+	Name     string    `json:"name,omitempty"`
+	Hash     string    `json:"hash,omitempty"`
+	Roles    []Role    `json:"roles"`
+	Prefixes []string  `json:"prefixes,omitempty"`
+}
+
+// HasRole метод проверяет есть ли у токена роль, admin дает любую роль
+func (token Token) HasRole(role Role) bool {
+	for _, r := range token.Roles {
+		if r == role || r == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsMetric метод проверяет доступ к метрике по префиксам имени,
+// без префиксов доступны все метрики
+func (token Token) AllowsMetric(name string) bool {
+	if len(token.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range token.Prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForbiddenError ошибка доступа к метрике вне префиксов токена
+type ForbiddenError struct {
+	Metric string
+}
+
+func (e *ForbiddenError) Error() string {
+	return fmt.Sprintf("metric %s is not allowed for token", e.Metric)
+}
+
+// BearerToken функция возвращает токен из значения заголовка Authorization
+func BearerToken(header string) (string, bool) {
+	if len(header) <= len(bearerScheme) || !strings.EqualFold(header[:len(bearerScheme)], bearerScheme) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(bearerScheme):]), true
+}
+
+type tokenKey struct{}
+
+// WithToken функция сохраняет проверенный токен в контексте запроса
+func WithToken(ctx context.Context, token Token) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// TokenFrom функция возвращает токен из контекста
+func TokenFrom(ctx context.Context) (Token, bool) {
+	token, ok := ctx.Value(tokenKey{}).(Token)
+	return token, ok
+}
+
+// AllowedMetric функция проверяет доступ токена из контекста к метрике,
+// если токена в контексте нет проверка не действует
+func AllowedMetric(ctx context.Context, name string) bool {
+	token, ok := TokenFrom(ctx)
+	return !ok || token.AllowsMetric(name)
+}
+
+// CheckMetrics функция проверяет доступ токена из контекста ко всем метрикам
+func CheckMetrics(ctx context.Context, names ...string) error {
+	for _, name := range names {
+		if !AllowedMetric(ctx, name) {
+			return &ForbiddenError{Metric: name}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	store, err := NewStore("", "")
+	require.NoError(t, err)
+	assert.Nil(t, store)
+
+	file := filepath.Join(t.TempDir(), "tokens.json")
+	store, err = NewStore(file, "admin-secret")
+	require.NoError(t, err)
+
+	admin, err := store.Authenticate("admin-secret")
+	require.NoError(t, err)
+	assert.True(t, admin.HasRole(RoleWrite))
+
+	secret, token, err := store.Create("agent", []Role{RoleWrite}, []string{"cpu_"})
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, token.Hash)
+	_, _, err = store.Create("bad", []Role{"owner"}, nil)
+	assert.Error(t, err)
+
+	// токены загружаются из файла, начальный токен администратора не сохраняется
+	store, err = NewStore(file, "")
+	require.NoError(t, err)
+	_, err = store.Authenticate("admin-secret")
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	loaded, err := store.Authenticate(secret)
+	require.NoError(t, err)
+	assert.Equal(t, token.ID, loaded.ID)
+	assert.True(t, loaded.HasRole(RoleWrite))
+	assert.False(t, loaded.HasRole(RoleRead))
+	require.Len(t, store.List(), 1)
+	assert.Empty(t, store.List()[0].Hash)
+
+	require.NoError(t, store.Revoke(token.ID))
+	assert.ErrorIs(t, store.Revoke(token.ID), ErrNotFound)
+	_, err = store.Authenticate(secret)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+}
+
+func TestCheckMetrics(t *testing.T) {
+	// без токена в контексте доступны все метрики
+	require.NoError(t, CheckMetrics(context.Background(), "Alloc"))
+
+	ctx := WithToken(context.Background(), Token{Roles: []Role{RoleRead}, Prefixes: []string{"cpu_", "mem_"}})
+	assert.True(t, AllowedMetric(ctx, "mem_used"))
+	assert.NoError(t, CheckMetrics(ctx, "cpu_idle", "mem_used"))
+	var forbidden *ForbiddenError
+	require.ErrorAs(t, CheckMetrics(ctx, "cpu_idle", "Alloc"), &forbidden)
+	assert.Equal(t, "Alloc", forbidden.Metric)
+
+	secret, ok := BearerToken("bearer abc")
+	assert.True(t, ok)
+	assert.Equal(t, "abc", secret)
+	_, ok = BearerToken("Basic abc")
+	assert.False(t, ok)
+}
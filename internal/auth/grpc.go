@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"context"
+)
+
+// ключ метаданных gRPC с токеном, аналог заголовка Authorization
+const MetadataKey = "authorization"
+
+// Credentials токен для вызовов gRPC, передается в метаданных authorization
+type Credentials string
+
+// GetRequestMetadata метод добавляет токен в метаданные вызова
+func (token Credentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{MetadataKey: bearerScheme + string(token)}, nil
+}
+
+// RequireTransportSecurity метод разрешает передачу токена без TLS,
+// как и остальные вызовы агента
+func (token Credentials) RequireTransportSecurity() bool {
+	return false
+}
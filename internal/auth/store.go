@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// длина токена и его идентификатора в байтах
+const (
+	tokenBytes int = 32
+	idBytes    int = 8
+)
+
+// Store хранилище хэшей токенов с сохранением в файл. Методы безопасны для nil,
+// nil хранилище означает что проверка доступа отключена.
+type Store struct {
+	// хэши токенов по идентификатору
+	tokens map[string]Token
+	file   string
+	// хэш начального токена администратора, не сохраняется в файл
+	bootstrap string
+	mx        sync.RWMutex
+}
+
+// NewStore функция загружает токены из файла и добавляет начальный токен администратора,
+// если файл и токен не заданы возвращается nil
+func NewStore(file, adminToken string) (*Store, error) {
+	if len(file) == 0 && len(adminToken) == 0 {
+		return nil, nil
+	}
+	store := &Store{tokens: make(map[string]Token), file: file}
+	if len(adminToken) != 0 {
+		store.bootstrap = HashToken(adminToken)
+	}
+	if len(file) == 0 {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error when read tokens file %w", err)
+	}
+	var tokens []Token
+	if err = json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("error when unmarshal tokens %w", err)
+	}
+	for _, token := range tokens {
+		if len(token.ID) == 0 || len(token.Hash) == 0 {
+			return nil, fmt.Errorf("token without id or hash in %s", file)
+		}
+		for _, role := range token.Roles {
+			if _, err = ParseRole(string(role)); err != nil {
+				return nil, fmt.Errorf("token %s %w", token.ID, err)
+			}
+		}
+		store.tokens[token.ID] = token
+	}
+	return store, nil
+}
+
+// HashToken функция возвращает хэш токена в hex
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// функция возвращает случайную строку в hex
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error when generate random bytes %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Authenticate метод возвращает описание токена по его значению
+func (store *Store) Authenticate(token string) (Token, error) {
+	if store == nil {
+		return Token{}, ErrUnauthenticated
+	}
+	hash := HashToken(token)
+	if len(store.bootstrap) != 0 && hash == store.bootstrap {
+		return Token{ID: "bootstrap", Roles: []Role{RoleAdmin}}, nil
+	}
+	store.mx.RLock()
+	defer store.mx.RUnlock()
+	for _, known := range store.tokens {
+		if known.Hash == hash {
+			return known, nil
+		}
+	}
+	return Token{}, ErrUnauthenticated
+}
+
+// Create метод создает токен с ролями и префиксами метрик, значение токена
+// возвращается только здесь, в хранилище остается хэш
+func (store *Store) Create(name string, roles []Role, prefixes []string) (string, Token, error) {
+	if store == nil {
+		return "", Token{}, errors.New("token store disabled")
+	}
+	if len(roles) == 0 {
+		return "", Token{}, errors.New("token needs at least one role")
+	}
+	for _, role := range roles {
+		if _, err := ParseRole(string(role)); err != nil {
+			return "", Token{}, err
+		}
+	}
+	secret, err := randomHex(tokenBytes)
+	if err != nil {
+		return "", Token{}, err
+	}
+	id, err := randomHex(idBytes)
+	if err != nil {
+		return "", Token{}, err
+	}
+	token := Token{
+		Created:  time.Now().UTC(),
+		ID:       id,
+		Name:     name,
+		Hash:     HashToken(secret),
+		Roles:    roles,
+		Prefixes: prefixes,
+	}
+
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	store.tokens[id] = token
+	if err = store.save(); err != nil {
+		delete(store.tokens, id)
+		return "", Token{}, err
+	}
+	return secret, token, nil
+}
+
+// Revoke метод удаляет токен по идентификатору
+func (store *Store) Revoke(id string) error {
+	if store == nil {
+		return ErrNotFound
+	}
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	token, ok := store.tokens[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(store.tokens, id)
+	if err := store.save(); err != nil {
+		store.tokens[id] = token
+		return err
+	}
+	return nil
+}
+
+// List метод возвращает токены без хэшей в порядке создания
+func (store *Store) List() []Token {
+	tokens := []Token{}
+	if store == nil {
+		return tokens
+	}
+	store.mx.RLock()
+	for _, token := range store.tokens {
+		token.Hash = ""
+		tokens = append(tokens, token)
+	}
+	store.mx.RUnlock()
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Created.Before(tokens[j].Created) })
+	return tokens
+}
+
+// метод сохраняет токены в файл через временный файл, вызывается под блокировкой
+func (store *Store) save() error {
+	if len(store.file) == 0 {
+		return nil
+	}
+	tokens := make([]Token, 0, len(store.tokens))
+	for _, token := range store.tokens {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Created.Before(tokens[j].Created) })
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error when marshal tokens %w", err)
+	}
+	tmp := store.file + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error when write tokens file %w", err)
+	}
+	if err = os.Rename(tmp, store.file); err != nil {
+		return fmt.Errorf("error when rename tokens file %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,440 @@
+// Package cfgload - пакет загрузки конфигурации по тегам полей структуры.
+// Поле связывается с флагом, переменной окружения и ключом файла конфигурации тегами:
+//
+//	flag       имя флага, для pflag через запятую короткое имя: flag:"endpoint,a"
+//	env        имя переменной окружения
+//	file       ключ в файле конфигурации, по умолчанию имя из тега json
+//	DefVal     значение по умолчанию
+//	usage      описание флага
+//	secret     "true" - значение скрывается при печати конфигурации
+//	min, max   допустимые границы числа
+//	oneof      допустимые значения через запятую
+//	unit       "s" - целое число секунд, можно задать и длительностью, например 1m
+//	empty      "true" - пустая переменная окружения тоже применяется
+//	configfile "true" - поле с путем к файлу конфигурации
+//
+// Значения применяются в порядке возрастания приоритета: DefVal, файл конфигурации
+// в формате JSON или YAML (по расширению .yaml и .yml), флаги, переменные окружения.
+// Поле-структура, у полей которой есть теги flag или env, является секцией файла
+// и разбирается по полям. Остальные поля-структуры, срезы и словари задаются
+// только в файле конфигурации целиком.
+package cfgload
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Source источник значения поля
+type Source int
+
+// источники значений в порядке возрастания приоритета
+const (
+	SourceDefault Source = iota
+	SourceFile
+	SourceFlag
+	SourceEnv
+)
+
+var (
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshaler   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	durationType    = reflect.TypeOf(time.Duration(0))
+)
+
+// описание поля конфигурации
+type field struct {
+	typ reflect.Type
+	// индексы поля для reflect.Value.FieldByIndex
+	index []int
+	// путь ключа в файле конфигурации, пустой если поле не задается в файле
+	key        []string
+	oneof      []string
+	name       string
+	flag       string
+	short      string
+	env        string
+	def        string
+	usage      string
+	min        string
+	max        string
+	scalar     bool
+	secret     bool
+	seconds    bool
+	emptyEnv   bool
+	configFile bool
+}
+
+// Loader загрузчик конфигурации для одного типа структуры
+type Loader struct {
+	typ reflect.Type
+	// поля заданные флагами, файл конфигурации их не меняет
+	flagged map[string]bool
+	// источники значений полей при последней загрузке
+	sources map[string]Source
+	fields  []*field
+}
+
+// New функция разбирает теги структуры, cfg - указатель на структуру конфигурации
+func New(cfg any) (*Loader, error) {
+	typ := reflect.TypeOf(cfg)
+	if typ == nil || typ.Kind() != reflect.Pointer || typ.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config must be pointer to struct, got %T", cfg)
+	}
+	loader := &Loader{
+		typ:     typ.Elem(),
+		flagged: make(map[string]bool),
+		sources: make(map[string]Source),
+	}
+	err := loader.collect(typ.Elem(), nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	flags := make(map[string]string)
+	envs := make(map[string]string)
+	for _, f := range loader.fields {
+		for _, name := range []string{f.flag, f.short} {
+			if len(name) == 0 {
+				continue
+			}
+			if other, ok := flags[name]; ok {
+				return nil, fmt.Errorf("flag %s used by %s and %s", name, other, f.name)
+			}
+			flags[name] = f.name
+		}
+		if len(f.env) == 0 {
+			continue
+		}
+		if other, ok := envs[f.env]; ok {
+			return nil, fmt.Errorf("env %s used by %s and %s", f.env, other, f.name)
+		}
+		envs[f.env] = f.name
+	}
+	return loader, nil
+}
+
+// метод собирает поля структуры, поля секций собираются рекурсивно
+func (loader *Loader) collect(typ reflect.Type, index []int, key []string, prefix string) error {
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		f := &field{
+			typ:        sf.Type,
+			index:      append(append([]int(nil), index...), i),
+			name:       prefix + sf.Name,
+			env:        sf.Tag.Get("env"),
+			def:        sf.Tag.Get("DefVal"),
+			usage:      sf.Tag.Get("usage"),
+			min:        sf.Tag.Get("min"),
+			max:        sf.Tag.Get("max"),
+			scalar:     isScalar(sf.Type),
+			secret:     sf.Tag.Get("secret") == "true",
+			seconds:    sf.Tag.Get("unit") == "s",
+			emptyEnv:   sf.Tag.Get("empty") == "true",
+			configFile: sf.Tag.Get("configfile") == "true",
+		}
+		f.flag, f.short, _ = strings.Cut(sf.Tag.Get("flag"), ",")
+		if oneof := sf.Tag.Get("oneof"); len(oneof) != 0 {
+			f.oneof = strings.Split(oneof, ",")
+		}
+		if name := fileKey(sf); len(name) != 0 {
+			f.key = append(append([]string(nil), key...), name)
+		}
+
+		if sf.Type.Kind() == reflect.Struct && !f.scalar && hasBindings(sf.Type) {
+			err := loader.collect(sf.Type, f.index, f.key, f.name+".")
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if len(f.flag) == 0 && len(f.env) == 0 && len(f.key) == 0 {
+			continue
+		}
+		if !f.scalar && (len(f.flag) != 0 || len(f.env) != 0 || len(f.def) != 0) {
+			return fmt.Errorf("field %s of type %s can be set only in config file", f.name, f.typ)
+		}
+		for _, bound := range []string{f.min, f.max} {
+			if _, err := strconv.ParseFloat(bound, 64); len(bound) != 0 && err != nil {
+				return fmt.Errorf("field %s wrong bound %q", f.name, bound)
+			}
+		}
+		loader.fields = append(loader.fields, f)
+	}
+	return nil
+}
+
+// функция возвращает ключ поля в файле конфигурации из тегов file или json
+func fileKey(sf reflect.StructField) string {
+	name, ok := sf.Tag.Lookup("file")
+	if !ok {
+		name, _, _ = strings.Cut(sf.Tag.Get("json"), ",")
+	}
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// функция проверяет есть ли в структуре поля с флагами или переменными окружения
+func hasBindings(typ reflect.Type) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if len(sf.Tag.Get("flag")) != 0 || len(sf.Tag.Get("env")) != 0 {
+			return true
+		}
+		if sf.Type.Kind() == reflect.Struct && !isScalar(sf.Type) && hasBindings(sf.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// функция проверяет задается ли значение типа одной строкой
+func isScalar(typ reflect.Type) bool {
+	if reflect.PointerTo(typ).Implements(textUnmarshaler) {
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// метод возвращает имя поля для сообщений: ключ файла, флаг или имя в структуре
+func (f *field) title() string {
+	switch {
+	case len(f.key) != 0:
+		return strings.Join(f.key, ".")
+	case len(f.flag) != 0:
+		return f.flag
+	}
+	return f.name
+}
+
+// метод устанавливает значение поля из строки
+func (f *field) set(target reflect.Value, text string) error {
+	if unmarshaler, ok := target.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(text))
+	}
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(text)
+	case reflect.Bool:
+		value, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("wrong bool %q", text)
+		}
+		target.SetBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err := f.parseInt(target.Type(), text)
+		if err != nil {
+			return err
+		}
+		if target.OverflowInt(value) {
+			return fmt.Errorf("value %q out of range", text)
+		}
+		target.SetInt(value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err := strconv.ParseUint(text, 10, 64)
+		if err != nil || target.OverflowUint(value) {
+			return fmt.Errorf("wrong unsigned number %q", text)
+		}
+		target.SetUint(value)
+	case reflect.Float32, reflect.Float64:
+		value, err := strconv.ParseFloat(text, target.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("wrong number %q", text)
+		}
+		target.SetFloat(value)
+	default:
+		return fmt.Errorf("unsupported type %s", target.Type())
+	}
+	return nil
+}
+
+// метод разбирает целое число, секунды и time.Duration можно задать длительностью
+func (f *field) parseInt(typ reflect.Type, text string) (int64, error) {
+	if typ == durationType {
+		value, err := time.ParseDuration(text)
+		if err != nil {
+			return 0, fmt.Errorf("wrong duration %q", text)
+		}
+		return int64(value), nil
+	}
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err == nil {
+		return value, nil
+	}
+	if f.seconds {
+		duration, err := time.ParseDuration(text)
+		if err == nil {
+			return int64(duration / time.Second), nil
+		}
+	}
+	return 0, fmt.Errorf("wrong number %q", text)
+}
+
+// функция возвращает значение поля строкой
+func format(value reflect.Value) string {
+	if value.Type().Implements(textMarshaler) {
+		text, err := value.Interface().(encoding.TextMarshaler).MarshalText()
+		if err == nil {
+			return string(text)
+		}
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+// метод проверяет что cfg указатель на структуру загрузчика
+func (loader *Loader) value(cfg any) (reflect.Value, error) {
+	value := reflect.ValueOf(cfg)
+	if value.Kind() != reflect.Pointer || value.IsNil() || value.Elem().Type() != loader.typ {
+		return reflect.Value{}, fmt.Errorf("config must be *%s, got %T", loader.typ, cfg)
+	}
+	return value.Elem(), nil
+}
+
+// Defaults метод устанавливает значения по умолчанию из тегов DefVal
+func (loader *Loader) Defaults(cfg any) error {
+	value, err := loader.value(cfg)
+	if err != nil {
+		return err
+	}
+	for _, f := range loader.fields {
+		if len(f.def) == 0 {
+			continue
+		}
+		err = f.set(value.FieldByIndex(f.index), f.def)
+		if err != nil {
+			return fmt.Errorf("error when set default %s %w", f.title(), err)
+		}
+	}
+	return nil
+}
+
+// Load метод применяет к значениям флагов файл конфигурации и переменные окружения
+// и проверяет значения. Файл не меняет поля заданные флагами.
+// Метод можно вызывать повторно для перечитывания конфигурации.
+func (loader *Loader) Load(cfg any) error {
+	value, err := loader.value(cfg)
+	if err != nil {
+		return err
+	}
+	clear(loader.sources)
+	for name := range loader.flagged {
+		loader.sources[name] = SourceFlag
+	}
+
+	if name := loader.configFile(value); len(name) != 0 {
+		err = loader.loadFile(value, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// переменные окружения имеют наивысший приоритет
+	for _, f := range loader.fields {
+		if len(f.env) == 0 {
+			continue
+		}
+		text, ok := os.LookupEnv(f.env)
+		if !ok || (len(text) == 0 && !f.emptyEnv) {
+			continue
+		}
+		err = f.set(value.FieldByIndex(f.index), text)
+		if err != nil {
+			return fmt.Errorf("error when parse env %s %w", f.env, err)
+		}
+		loader.sources[f.name] = SourceEnv
+	}
+
+	return loader.validate(value)
+}
+
+// метод возвращает путь к файлу конфигурации из переменной окружения или поля
+func (loader *Loader) configFile(value reflect.Value) string {
+	for _, f := range loader.fields {
+		if !f.configFile {
+			continue
+		}
+		if name := os.Getenv(f.env); len(f.env) != 0 && len(name) != 0 {
+			return name
+		}
+		return format(value.FieldByIndex(f.index))
+	}
+	return ""
+}
+
+// Validate метод проверяет значения по тегам min, max и oneof
+func (loader *Loader) Validate(cfg any) error {
+	value, err := loader.value(cfg)
+	if err != nil {
+		return err
+	}
+	return loader.validate(value)
+}
+
+func (loader *Loader) validate(value reflect.Value) error {
+	var errs []error
+	for _, f := range loader.fields {
+		target := value.FieldByIndex(f.index)
+		if len(f.oneof) != 0 {
+			text := format(target)
+			found := false
+			for _, allowed := range f.oneof {
+				found = found || text == allowed
+			}
+			if !found {
+				errs = append(errs, fmt.Errorf("%s must be one of %s, got %q",
+					f.title(), strings.Join(f.oneof, ", "), text))
+			}
+		}
+		if len(f.min) == 0 && len(f.max) == 0 {
+			continue
+		}
+		number, ok := toFloat(target)
+		if !ok {
+			continue
+		}
+		if lower, _ := strconv.ParseFloat(f.min, 64); len(f.min) != 0 && number < lower {
+			errs = append(errs, fmt.Errorf("%s must not be less than %s, got %s", f.title(), f.min, format(target)))
+		}
+		if upper, _ := strconv.ParseFloat(f.max, 64); len(f.max) != 0 && number > upper {
+			errs = append(errs, fmt.Errorf("%s must not be greater than %s, got %s", f.title(), f.max, format(target)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// функция возвращает числовое значение поля
+func toFloat(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
+
+// Source метод возвращает источник значения поля при последней загрузке,
+// name - имя поля в структуре, для полей секций через точку: Log.Level
+func (loader *Loader) Source(name string) Source {
+	return loader.sources[name]
+}
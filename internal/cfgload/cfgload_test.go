@@ -0,0 +1,286 @@
+package cfgload
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSampling struct {
+	Initial int `json:"initial,omitempty" flag:"sampling" env:"TEST_SAMPLING"`
+}
+
+type testSection struct {
+	Level    string       `json:"level,omitempty" flag:"level" env:"TEST_LEVEL" DefVal:"info"`
+	Sampling testSampling `json:"sampling,omitempty"`
+}
+
+type testTarget struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret,omitempty" secret:"true"`
+}
+
+type testCfg struct {
+	Subnet   netip.Prefix `flag:"t" env:"TEST_SUBNET" file:"subnet"`
+	Section  testSection  `file:"section"`
+	Targets  []testTarget `file:"targets"`
+	Config   string       `flag:"config" env:"TEST_CONFIG" configfile:"true"`
+	Address  string       `flag:"address,a" env:"TEST_ADDRESS" file:"address" DefVal:"localhost:8080"`
+	Key      string       `flag:"k" env:"TEST_KEY" file:"key" secret:"true"`
+	Mode     string       `flag:"mode" env:"TEST_MODE" file:"mode" DefVal:"failover" oneof:"failover,fanout"`
+	Status   string       `env:"TEST_STATUS" file:"status" DefVal:"localhost:8081" empty:"true"`
+	Rate     float64      `flag:"rate" env:"TEST_RATE" file:"rate" min:"0"`
+	Interval int          `flag:"i" env:"TEST_INTERVAL" file:"interval" DefVal:"300" unit:"s" min:"0"`
+	Limit    int          `flag:"l" env:"TEST_LIMIT" file:"limit" DefVal:"5" min:"1" max:"32"`
+	Restore  bool         `flag:"r" env:"TEST_RESTORE" file:"restore" DefVal:"true"`
+	Generate bool         `flag:"generate,g"`
+}
+
+// функция очищает переменные окружения тестовой конфигурации
+func clearEnv(t *testing.T) {
+	for _, env := range []string{"TEST_SAMPLING", "TEST_LEVEL", "TEST_SUBNET", "TEST_CONFIG", "TEST_ADDRESS",
+		"TEST_KEY", "TEST_MODE", "TEST_RATE", "TEST_INTERVAL", "TEST_LIMIT", "TEST_RESTORE"} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("TEST_STATUS", "")
+	require.NoError(t, os.Unsetenv("TEST_STATUS"))
+}
+
+func writeFile(t *testing.T, name, data string) string {
+	name = filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(name, []byte(data), 0644))
+	return name
+}
+
+func TestLoad(t *testing.T) {
+	clearEnv(t)
+
+	t.Run("defaults", func(t *testing.T) {
+		var cfg testCfg
+		loader, err := New(&cfg)
+		require.NoError(t, err)
+		require.NoError(t, loader.Defaults(&cfg))
+		require.NoError(t, loader.Load(&cfg))
+		assert.Equal(t, "localhost:8080", cfg.Address)
+		assert.Equal(t, 300, cfg.Interval)
+		assert.Equal(t, 5, cfg.Limit)
+		assert.True(t, cfg.Restore)
+		assert.Equal(t, "info", cfg.Section.Level)
+		assert.Equal(t, SourceDefault, loader.Source("Address"))
+	})
+
+	t.Run("precedence", func(t *testing.T) {
+		file := writeFile(t, "cfg.json", `{"address":"file:1","interval":"1m","limit":7,"restore":false,
+			"mode":"fanout","subnet":"10.0.0.0/8","section":{"level":"warn","sampling":{"initial":10}},
+			"targets":[{"name":"one","secret":"s"}]}`)
+		var cfg testCfg
+		loader, err := New(&cfg)
+		require.NoError(t, err)
+		require.NoError(t, loader.Defaults(&cfg))
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		require.NoError(t, loader.BindFlags(flags, &cfg))
+		require.NoError(t, flags.Parse([]string{"-config", file, "-a", "flag:2", "-l", "9", "-i", "300"}))
+		t.Setenv("TEST_LIMIT", "11")
+
+		require.NoError(t, loader.Load(&cfg))
+		// флаг важнее файла, даже если совпадает со значением по умолчанию
+		assert.Equal(t, "flag:2", cfg.Address)
+		assert.Equal(t, 300, cfg.Interval)
+		assert.Equal(t, SourceFlag, loader.Source("Interval"))
+		// переменная окружения важнее флага
+		assert.Equal(t, 11, cfg.Limit)
+		assert.Equal(t, SourceEnv, loader.Source("Limit"))
+		// файл важнее значения по умолчанию
+		assert.False(t, cfg.Restore)
+		assert.Equal(t, "fanout", cfg.Mode)
+		assert.Equal(t, netip.MustParsePrefix("10.0.0.0/8"), cfg.Subnet)
+		assert.Equal(t, "warn", cfg.Section.Level)
+		assert.Equal(t, 10, cfg.Section.Sampling.Initial)
+		assert.Equal(t, SourceFile, loader.Source("Section.Level"))
+		assert.Equal(t, []testTarget{{Name: "one", Secret: "s"}}, cfg.Targets)
+	})
+
+	t.Run("reload keeps flags", func(t *testing.T) {
+		file := writeFile(t, "cfg.json", `{"address":"file:1","interval":10}`)
+		var cfg testCfg
+		loader, err := New(&cfg)
+		require.NoError(t, err)
+		require.NoError(t, loader.Defaults(&cfg))
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		require.NoError(t, loader.BindPFlags(flags, &cfg))
+		require.NoError(t, flags.Parse([]string{"--config", file, "-a", "flag:2", "-g"}))
+		assert.True(t, cfg.Generate)
+		snapshot := cfg
+
+		require.NoError(t, os.WriteFile(file, []byte(`{"address":"file:3","interval":20}`), 0644))
+		require.NoError(t, loader.Load(&snapshot))
+		assert.Equal(t, "flag:2", snapshot.Address)
+		assert.Equal(t, 20, snapshot.Interval)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		file := writeFile(t, "cfg.yaml", "address: yaml:1\ninterval: 2s\nrate: 1.5\nsection:\n  level: debug\n")
+		var cfg testCfg
+		loader, err := New(&cfg)
+		require.NoError(t, err)
+		require.NoError(t, loader.Defaults(&cfg))
+		cfg.Config = file
+		require.NoError(t, loader.Load(&cfg))
+		assert.Equal(t, "yaml:1", cfg.Address)
+		assert.Equal(t, 2, cfg.Interval)
+		assert.Equal(t, 1.5, cfg.Rate)
+		assert.Equal(t, "debug", cfg.Section.Level)
+	})
+
+	t.Run("config file from env", func(t *testing.T) {
+		file := writeFile(t, "cfg.json", `{"address":"file:1"}`)
+		t.Setenv("TEST_CONFIG", file)
+		var cfg testCfg
+		loader, err := New(&cfg)
+		require.NoError(t, err)
+		require.NoError(t, loader.Defaults(&cfg))
+		require.NoError(t, loader.Load(&cfg))
+		assert.Equal(t, "file:1", cfg.Address)
+	})
+
+	t.Run("empty env", func(t *testing.T) {
+		t.Setenv("TEST_ADDRESS", "")
+		t.Setenv("TEST_STATUS", "")
+		var cfg testCfg
+		loader, err := New(&cfg)
+		require.NoError(t, err)
+		require.NoError(t, loader.Defaults(&cfg))
+		require.NoError(t, loader.Load(&cfg))
+		assert.Equal(t, "localhost:8080", cfg.Address)
+		assert.Empty(t, cfg.Status)
+	})
+
+	t.Run("wrong values", func(t *testing.T) {
+		for name, env := range map[string][2]string{
+			"bool":     {"TEST_RESTORE", "yes please"},
+			"number":   {"TEST_INTERVAL", "often"},
+			"prefix":   {"TEST_SUBNET", "10.0.0.0"},
+			"min":      {"TEST_RATE", "-1"},
+			"max":      {"TEST_LIMIT", "33"},
+			"oneof":    {"TEST_MODE", "broadcast"},
+			"overflow": {"TEST_LIMIT", "99999999999999999999"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				t.Setenv(env[0], env[1])
+				var cfg testCfg
+				loader, err := New(&cfg)
+				require.NoError(t, err)
+				require.NoError(t, loader.Defaults(&cfg))
+				assert.Error(t, loader.Load(&cfg))
+			})
+		}
+		file := writeFile(t, "cfg.json", `{"address":`)
+		var cfg testCfg
+		loader, err := New(&cfg)
+		require.NoError(t, err)
+		cfg.Config = file
+		assert.Error(t, loader.Load(&cfg))
+	})
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(testCfg{})
+	assert.Error(t, err)
+
+	_, err = New(&struct {
+		A string `flag:"a"`
+		B string `flag:"b,a"`
+	}{})
+	assert.Error(t, err)
+
+	_, err = New(&struct {
+		A []string `env:"A"`
+	}{})
+	assert.Error(t, err)
+
+	var cfg testCfg
+	loader, err := New(&cfg)
+	require.NoError(t, err)
+	var other struct{}
+	assert.Error(t, loader.Load(&other))
+}
+
+func TestPrint(t *testing.T) {
+	clearEnv(t)
+	var cfg testCfg
+	loader, err := New(&cfg)
+	require.NoError(t, err)
+	require.NoError(t, loader.Defaults(&cfg))
+	cfg.Key = "sign"
+	cfg.Subnet = netip.MustParsePrefix("10.0.0.0/8")
+	cfg.Targets = []testTarget{{Name: "one", Secret: "s"}, {Name: "two"}}
+
+	var buf bytes.Buffer
+	require.NoError(t, loader.Print(&buf, &cfg))
+	assert.NotContains(t, buf.String(), "sign")
+
+	var printed map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &printed))
+	assert.Equal(t, "***", printed["key"])
+	assert.Equal(t, "localhost:8080", printed["address"])
+	assert.Equal(t, "10.0.0.0/8", printed["subnet"])
+	assert.Equal(t, float64(300), printed["interval"])
+	assert.Equal(t, false, printed["generate"])
+	assert.Equal(t, map[string]any{"level": "info", "sampling": map[string]any{"initial": float64(0)}}, printed["section"])
+	assert.Equal(t, []any{
+		map[string]any{"name": "one", "secret": "***"},
+		map[string]any{"name": "two"},
+	}, printed["targets"])
+
+	// напечатанная конфигурация читается как файл конфигурации
+	file := writeFile(t, "printed.json", buf.String())
+	var loaded testCfg
+	loaded.Config = file
+	loader, err = New(&loaded)
+	require.NoError(t, err)
+	require.NoError(t, loader.Load(&loaded))
+	assert.Equal(t, cfg.Subnet, loaded.Subnet)
+	assert.Equal(t, cfg.Interval, loaded.Interval)
+}
+
+func TestPrintNestedSecrets(t *testing.T) {
+	type tls struct {
+		CertFile string `json:"cert_file"`
+		Password string `json:"password,omitempty" secret:"true"`
+	}
+	type endpoint struct {
+		TLS     *tls   `json:"tls,omitempty"`
+		Address string `json:"address"`
+		Key     string `json:"key,omitempty" secret:"true"`
+	}
+	var cfg struct {
+		Endpoints []endpoint `file:"endpoints"`
+	}
+	cfg.Endpoints = []endpoint{
+		{Address: "a:1", Key: "EPKEY", TLS: &tls{CertFile: "/cert.pem", Password: "TLSPASS"}},
+		{Address: "b:2"},
+	}
+	loader, err := New(&cfg)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, loader.Print(&buf, &cfg))
+	assert.NotContains(t, buf.String(), "EPKEY")
+	assert.NotContains(t, buf.String(), "TLSPASS")
+
+	var printed map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &printed))
+	assert.Equal(t, []any{
+		map[string]any{"address": "a:1", "key": "***",
+			"tls": map[string]any{"cert_file": "/cert.pem", "password": "***"}},
+		map[string]any{"address": "b:2"},
+	}, printed["endpoints"])
+}
@@ -0,0 +1,105 @@
+package cfgload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// метод применяет значения из файла конфигурации к полям не заданным флагами
+func (loader *Loader) loadFile(value reflect.Value, name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("error when read config file %w", err)
+	}
+	var values map[string]any
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&values)
+	}
+	if err != nil {
+		return fmt.Errorf("error when unmarshal config file %w", err)
+	}
+
+	for _, f := range loader.fields {
+		if len(f.key) == 0 || loader.flagged[f.name] {
+			continue
+		}
+		raw, ok := lookup(values, f.key)
+		if !ok {
+			continue
+		}
+		err = f.decode(value.FieldByIndex(f.index), raw)
+		if err != nil {
+			return fmt.Errorf("error when parse %s from config file %w", f.title(), err)
+		}
+		loader.sources[f.name] = SourceFile
+	}
+	return nil
+}
+
+// функция возвращает значение по пути ключа во вложенных секциях файла
+func lookup(values map[string]any, key []string) (any, bool) {
+	for i, name := range key {
+		raw, ok := values[name]
+		if !ok {
+			return nil, false
+		}
+		if i == len(key)-1 {
+			return raw, true
+		}
+		values, ok = raw.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// метод записывает в поле значение из файла, поля-структуры и срезы
+// разбираются по тегам json
+func (f *field) decode(target reflect.Value, raw any) error {
+	if raw == nil {
+		target.Set(reflect.Zero(f.typ))
+		return nil
+	}
+	if !f.scalar {
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		decoded := reflect.New(f.typ)
+		err = json.Unmarshal(data, decoded.Interface())
+		if err != nil {
+			return err
+		}
+		target.Set(decoded.Elem())
+		return nil
+	}
+
+	var text string
+	switch v := raw.(type) {
+	case string:
+		text = v
+	case json.Number:
+		text = v.String()
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool, int, int64, uint64:
+		text = fmt.Sprint(v)
+	default:
+		return fmt.Errorf("wrong value type %T", raw)
+	}
+	return f.set(target, text)
+}
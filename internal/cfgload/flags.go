@@ -0,0 +1,88 @@
+package cfgload
+
+import (
+	"flag"
+	"reflect"
+
+	"github.com/spf13/pflag"
+)
+
+// значение флага, записывает разобранную строку в поле конфигурации
+type flagValue struct {
+	loader *Loader
+	field  *field
+	target reflect.Value
+}
+
+func (value *flagValue) String() string {
+	// flag.PrintDefaults вызывает метод у нулевого значения
+	if value == nil || !value.target.IsValid() {
+		return ""
+	}
+	return format(value.target)
+}
+
+func (value *flagValue) Set(text string) error {
+	err := value.field.set(value.target, text)
+	if err != nil {
+		return err
+	}
+	value.loader.flagged[value.field.name] = true
+	return nil
+}
+
+// Type метод нужен pflag для подсказки
+func (value *flagValue) Type() string {
+	if value.field.typ.Kind() == reflect.Bool {
+		return "bool"
+	}
+	if value.field.scalar && reflect.PointerTo(value.field.typ).Implements(textUnmarshaler) {
+		return "string"
+	}
+	return value.field.typ.Kind().String()
+}
+
+// IsBoolFlag метод позволяет задать логический флаг без значения
+func (value *flagValue) IsBoolFlag() bool {
+	return value.field.typ.Kind() == reflect.Bool
+}
+
+// BindFlags метод определяет флаги полей в flag.FlagSet, для короткого имени
+// определяется отдельный флаг. Значения по умолчанию берутся из текущих значений полей,
+// поэтому метод вызывается после Defaults
+func (loader *Loader) BindFlags(flags *flag.FlagSet, cfg any) error {
+	value, err := loader.value(cfg)
+	if err != nil {
+		return err
+	}
+	for _, f := range loader.fields {
+		if len(f.flag) == 0 {
+			continue
+		}
+		fv := &flagValue{loader: loader, field: f, target: value.FieldByIndex(f.index)}
+		flags.Var(fv, f.flag, f.usage)
+		if len(f.short) != 0 {
+			flags.Var(fv, f.short, f.usage)
+		}
+	}
+	return nil
+}
+
+// BindPFlags метод определяет флаги полей в pflag.FlagSet
+func (loader *Loader) BindPFlags(flags *pflag.FlagSet, cfg any) error {
+	value, err := loader.value(cfg)
+	if err != nil {
+		return err
+	}
+	for _, f := range loader.fields {
+		if len(f.flag) == 0 {
+			continue
+		}
+		fv := &flagValue{loader: loader, field: f, target: value.FieldByIndex(f.index)}
+		pf := flags.VarPF(fv, f.flag, f.short, f.usage)
+		if fv.IsBoolFlag() {
+			pf.NoOptDefVal = "true"
+		}
+	}
+	return nil
+}
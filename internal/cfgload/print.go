@@ -0,0 +1,126 @@
+package cfgload
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// значение скрытого секрета
+const redacted string = "***"
+
+var jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// Print метод печатает действующую конфигурацию в формате JSON с ключами
+// файла конфигурации (для полей без ключа - имя флага). Значения полей с тегом
+// secret, в том числе во вложенных структурах, заменяются на ***
+func (loader *Loader) Print(w io.Writer, cfg any) error {
+	value, err := loader.value(cfg)
+	if err != nil {
+		return err
+	}
+	out := make(map[string]any)
+	for _, f := range loader.fields {
+		target := value.FieldByIndex(f.index)
+		if !f.scalar && target.IsZero() {
+			continue
+		}
+		key := f.key
+		if len(key) == 0 {
+			key = []string{f.title()}
+		}
+		section := out
+		for _, name := range key[:len(key)-1] {
+			next, ok := section[name].(map[string]any)
+			if !ok {
+				next = make(map[string]any)
+				section[name] = next
+			}
+			section = next
+		}
+		section[key[len(key)-1]] = plain(target, f.secret)
+	}
+
+	data, err := json.MarshalIndent(out, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error when marshal config %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// функция возвращает значение для печати, структуры преобразуются в словари
+// по тегам json, чтобы скрыть вложенные секреты
+func plain(value reflect.Value, secret bool) any {
+	if secret {
+		if value.IsZero() {
+			return value.Interface()
+		}
+		return redacted
+	}
+	if value.Type().Implements(jsonMarshaler) || value.Type().Implements(textMarshaler) {
+		return value.Interface()
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return plain(value.Elem(), false)
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return nil
+		}
+		items := make([]any, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			items = append(items, plain(value.Index(i), false))
+		}
+		return items
+	case reflect.Map:
+		if value.IsNil() {
+			return nil
+		}
+		items := make(map[string]any, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			items[fmt.Sprint(iter.Key().Interface())] = plain(iter.Value(), false)
+		}
+		return items
+	case reflect.Struct:
+		items := make(map[string]any)
+		plainStruct(value, items)
+		return items
+	}
+	return value.Interface()
+}
+
+// функция записывает поля структуры в словарь, поля встроенных структур без
+// имени в json поднимаются на уровень структуры, как в encoding/json
+func plainStruct(value reflect.Value, items map[string]any) {
+	typ := value.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		field := value.Field(i)
+		if sf.Anonymous && len(name) == 0 && field.Kind() == reflect.Struct {
+			plainStruct(field, items)
+			continue
+		}
+		if strings.Contains(opts, "omitempty") && field.IsZero() {
+			continue
+		}
+		if len(name) == 0 {
+			name = sf.Name
+		}
+		items[name] = plain(field, sf.Tag.Get("secret") == "true")
+	}
+}
@@ -0,0 +1,191 @@
+// Package clientlimit - пакет ограничения частоты запросов и числа метрик от клиентов сервера
+package clientlimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// время после которого забываются токены неактивного клиента
+const idleTimeout = 10 * time.Minute
+
+// ErrTooManyMetrics ошибка превышения числа различных метрик клиента
+var ErrTooManyMetrics = errors.New("too many distinct metrics")
+
+// Config настройки ограничений для одного клиента
+type Config struct {
+	// Rate число запросов в секунду, 0 - без ограничения
+	Rate float64
+	// Burst число запросов которое можно выполнить разом, по умолчанию Rate
+	Burst int
+	// MaxMetrics число различных метрик, 0 - без ограничения
+	MaxMetrics int
+	// MetricsTTL время после которого забываются метрики неактивного клиента, 0 - не забываются
+	MetricsTTL time.Duration
+}
+
+// Limiter ограничитель запросов по алгоритму token bucket и числа
+// различных метрик для каждого клиента. Методы безопасны для nil.
+type Limiter struct {
+	lastCleanup time.Time
+	clients     map[string]*client
+	// различные метрики клиентов учитываются отдельно от токенов
+	// и не забываются вместе с ними
+	metrics map[string]*metricSet
+	now     func() time.Time
+	cfg     Config
+	mx      sync.Mutex
+}
+
+type client struct {
+	lastSeen time.Time
+	// время последнего пополнения токенов
+	refilled time.Time
+	tokens   float64
+}
+
+type metricSet struct {
+	lastSeen time.Time
+	names    map[string]struct{}
+}
+
+// NewLimiter функция создания ограничителя, если ограничения
+// не заданы возвращается nil
+func NewLimiter(cfg Config) *Limiter {
+	if cfg.Rate <= 0 && cfg.MaxMetrics <= 0 {
+		return nil
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = max(1, int(math.Ceil(cfg.Rate)))
+	}
+	return &Limiter{
+		clients: make(map[string]*client),
+		metrics: make(map[string]*metricSet),
+		now:     time.Now,
+		cfg:     cfg,
+	}
+}
+
+// метод удаляет токены неактивных клиентов и их метрики если задан MetricsTTL
+func (limiter *Limiter) cleanup(now time.Time) {
+	if now.Sub(limiter.lastCleanup) <= idleTimeout {
+		return
+	}
+	for k, c := range limiter.clients {
+		if now.Sub(c.lastSeen) > idleTimeout {
+			delete(limiter.clients, k)
+		}
+	}
+	for k, set := range limiter.metrics {
+		if limiter.expired(set, now) {
+			delete(limiter.metrics, k)
+		}
+	}
+	limiter.lastCleanup = now
+}
+
+func (limiter *Limiter) expired(set *metricSet, now time.Time) bool {
+	return limiter.cfg.MetricsTTL > 0 && now.Sub(set.lastSeen) > limiter.cfg.MetricsTTL
+}
+
+// метод возвращает клиента, создает нового
+func (limiter *Limiter) client(key string, now time.Time) *client {
+	limiter.cleanup(now)
+	c, ok := limiter.clients[key]
+	if !ok {
+		c = &client{tokens: float64(limiter.cfg.Burst), refilled: now}
+		limiter.clients[key] = c
+	}
+	c.lastSeen = now
+	return c
+}
+
+// Allow метод расходует токен клиента. Если токенов нет возвращается false
+// и время через которое появится следующий токен.
+func (limiter *Limiter) Allow(key string) (bool, time.Duration) {
+	if limiter == nil || limiter.cfg.Rate <= 0 {
+		return true, 0
+	}
+	limiter.mx.Lock()
+	defer limiter.mx.Unlock()
+
+	now := limiter.now()
+	c := limiter.client(key, now)
+	c.tokens = min(float64(limiter.cfg.Burst),
+		c.tokens+now.Sub(c.refilled).Seconds()*limiter.cfg.Rate)
+	c.refilled = now
+	if c.tokens < 1 {
+		wait := (1 - c.tokens) / limiter.cfg.Rate
+		return false, time.Duration(wait * float64(time.Second))
+	}
+	c.tokens--
+	return true, 0
+}
+
+// AllowMetrics метод проверяет что новые метрики клиента не превышают
+// ограничение числа различных метрик. Метрики учитываются только если
+// все они помещаются в ограничение.
+func (limiter *Limiter) AllowMetrics(key string, names ...string) error {
+	if limiter == nil || limiter.cfg.MaxMetrics <= 0 {
+		return nil
+	}
+	limiter.mx.Lock()
+	defer limiter.mx.Unlock()
+
+	now := limiter.now()
+	limiter.cleanup(now)
+	set, ok := limiter.metrics[key]
+	if !ok || limiter.expired(set, now) {
+		set = &metricSet{names: make(map[string]struct{})}
+		limiter.metrics[key] = set
+	}
+	set.lastSeen = now
+	var added []string
+	for _, name := range names {
+		if _, ok := set.names[name]; ok {
+			continue
+		}
+		if len(set.names) >= limiter.cfg.MaxMetrics {
+			for _, name := range added {
+				delete(set.names, name)
+			}
+			return ErrTooManyMetrics
+		}
+		set.names[name] = struct{}{}
+		added = append(added, name)
+	}
+	return nil
+}
+
+// RetryAfter функция возвращает значение заголовка Retry-After в целых секундах
+func RetryAfter(wait time.Duration) int {
+	return max(1, int(math.Ceil(wait.Seconds())))
+}
+
+type clientKey struct{}
+
+type quota struct {
+	limiter *Limiter
+	key     string
+}
+
+// WithClient функция сохраняет в контексте клиента запроса для проверки числа метрик
+func WithClient(ctx context.Context, limiter *Limiter, key string) context.Context {
+	if limiter == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, clientKey{}, quota{limiter: limiter, key: key})
+}
+
+// CheckMetrics функция проверяет число метрик клиента сохраненного в контексте,
+// если клиента в контексте нет ограничение не действует
+func CheckMetrics(ctx context.Context, names ...string) error {
+	q, ok := ctx.Value(clientKey{}).(quota)
+	if !ok {
+		return nil
+	}
+	return q.limiter.AllowMetrics(q.key, names...)
+}
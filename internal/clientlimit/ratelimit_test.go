@@ -0,0 +1,92 @@
+package clientlimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewLimiter(Config{Rate: 2, Burst: 2})
+	limiter.now = func() time.Time { return now }
+
+	ok, _ := limiter.Allow("10.0.0.1")
+	assert.True(t, ok)
+	ok, _ = limiter.Allow("10.0.0.1")
+	assert.True(t, ok)
+	ok, wait := limiter.Allow("10.0.0.1")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+	assert.Equal(t, 1, RetryAfter(wait))
+
+	// у другого клиента свои токены
+	ok, _ = limiter.Allow("10.0.0.2")
+	assert.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = limiter.Allow("10.0.0.1")
+	assert.True(t, ok)
+	ok, _ = limiter.Allow("10.0.0.1")
+	assert.False(t, ok)
+
+	// неактивные клиенты забываются
+	now = now.Add(2 * idleTimeout)
+	ok, _ = limiter.Allow("10.0.0.1")
+	assert.True(t, ok)
+	assert.Len(t, limiter.clients, 1)
+}
+
+func TestLimiterAllowMetrics(t *testing.T) {
+	limiter := NewLimiter(Config{MaxMetrics: 2})
+
+	assert.NoError(t, limiter.AllowMetrics("agent", "gauge/Alloc"))
+	// пакет не помещается в ограничение и не учитывается целиком
+	assert.ErrorIs(t, limiter.AllowMetrics("agent", "gauge/Alloc", "gauge/Sys", "gauge/Frees"), ErrTooManyMetrics)
+	assert.NoError(t, limiter.AllowMetrics("agent", "gauge/Alloc", "gauge/Sys"))
+	assert.NoError(t, limiter.AllowMetrics("agent", "gauge/Sys"))
+	assert.ErrorIs(t, limiter.AllowMetrics("agent", "gauge/Frees"), ErrTooManyMetrics)
+	assert.NoError(t, limiter.AllowMetrics("other", "gauge/Frees"))
+
+	// без ограничения частоты запросы не ограничиваются
+	ok, _ := limiter.Allow("agent")
+	assert.True(t, ok)
+
+	ctx := WithClient(context.Background(), limiter, "agent")
+	assert.ErrorIs(t, CheckMetrics(ctx, "counter/PollCount"), ErrTooManyMetrics)
+	assert.NoError(t, CheckMetrics(context.Background(), "counter/PollCount"))
+}
+
+func TestLimiterMetricsTTL(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewLimiter(Config{Rate: 1, MaxMetrics: 1})
+	limiter.now = func() time.Time { return now }
+
+	// метрики не забываются вместе с токенами неактивного клиента
+	assert.NoError(t, limiter.AllowMetrics("agent", "gauge/Alloc"))
+	now = now.Add(2 * idleTimeout)
+	ok, _ := limiter.Allow("agent")
+	assert.True(t, ok)
+	assert.ErrorIs(t, limiter.AllowMetrics("agent", "gauge/Sys"), ErrTooManyMetrics)
+
+	limiter = NewLimiter(Config{MaxMetrics: 1, MetricsTTL: time.Hour})
+	limiter.now = func() time.Time { return now }
+	assert.NoError(t, limiter.AllowMetrics("agent", "gauge/Alloc"))
+	now = now.Add(30 * time.Minute)
+	assert.ErrorIs(t, limiter.AllowMetrics("agent", "gauge/Sys"), ErrTooManyMetrics)
+	// с MetricsTTL метрики забываются после заданного времени неактивности
+	now = now.Add(2 * time.Hour)
+	assert.NoError(t, limiter.AllowMetrics("agent", "gauge/Sys"))
+	assert.Len(t, limiter.metrics, 1)
+}
+
+func TestNilLimiter(t *testing.T) {
+	limiter := NewLimiter(Config{})
+	assert.Nil(t, limiter)
+	ok, _ := limiter.Allow("agent")
+	assert.True(t, ok)
+	assert.NoError(t, limiter.AllowMetrics("agent", "gauge/Alloc"))
+	assert.NoError(t, CheckMetrics(WithClient(context.Background(), limiter, "agent"), "gauge/Alloc"))
+}
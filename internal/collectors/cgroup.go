@@ -0,0 +1,374 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+// константы сборщика метрик cgroup
+const (
+	cgroupRoot     string = "/sys/fs/cgroup"
+	cgroupProcFile string = "/proc/self/cgroup"
+	// значения лимитов больше этого в cgroup v1 означают отсутствие лимита
+	cgroupV1Unlimited uint64 = 1 << 62
+)
+
+// каталоги контроллеров cgroup v1, cpu и cpuacct часто смонтированы вместе
+var cgroupV1Mounts = map[string][]string{
+	"memory":  {"memory"},
+	"cpu":     {"cpu", "cpu,cpuacct", "cpuacct,cpu"},
+	"cpuacct": {"cpuacct", "cpu,cpuacct", "cpuacct,cpu"},
+	"pids":    {"pids"},
+}
+
+// CgroupConfig настройки сборщика метрик контейнера из cgroup
+type CgroupConfig struct {
+	// Root точка монтирования cgroup, по умолчанию /sys/fs/cgroup
+	Root string `json:"root,omitempty"`
+	// Path путь cgroup относительно точки монтирования,
+	// по умолчанию берется из /proc/self/cgroup
+	Path    string `json:"path,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+// CgroupCollector сборщик метрик памяти, CPU и процессов контейнера,
+// версия cgroup определяется автоматически
+type CgroupCollector struct {
+	lastRun time.Time
+	// каталоги контроллеров, для cgroup v2 все контроллеры в одном каталоге
+	dirs map[string]string
+	// значения счетчиков с предыдущего опроса
+	last    map[string]uint64
+	version int
+	mx      sync.Mutex
+}
+
+// NewCgroupCollector функция создания сборщика, возвращает ошибку если cgroup не найдена
+func NewCgroupCollector(cfg CgroupConfig) (*CgroupCollector, error) {
+	if len(cfg.Root) == 0 {
+		cfg.Root = cgroupRoot
+	}
+	procPaths := readProcCgroup(cgroupProcFile)
+	collector := &CgroupCollector{dirs: make(map[string]string), last: make(map[string]uint64)}
+
+	// в cgroup v2 в корне есть список контроллеров
+	if _, err := os.Stat(filepath.Join(cfg.Root, "cgroup.controllers")); err == nil {
+		collector.version = 2
+		dir := cgroupDir(cfg.Root, cfg.Path, procPaths[""])
+		for _, controller := range []string{"memory", "cpu", "cpuacct", "pids"} {
+			collector.dirs[controller] = dir
+		}
+		return collector, nil
+	}
+
+	collector.version = 1
+	for controller, mounts := range cgroupV1Mounts {
+		for _, mount := range mounts {
+			base := filepath.Join(cfg.Root, mount)
+			if _, err := os.Stat(base); err == nil {
+				collector.dirs[controller] = cgroupDir(base, cfg.Path, procPaths[controller])
+				break
+			}
+		}
+	}
+	if len(collector.dirs) == 0 {
+		return nil, fmt.Errorf("cgroup not found in %s", cfg.Root)
+	}
+	return collector, nil
+}
+
+// функция выбирает каталог cgroup процесса, если его нет в точке монтирования
+// (например внутри контейнера с отдельным пространством имен cgroup) используется корень
+func cgroupDir(root, path, procPath string) string {
+	for _, candidate := range []string{path, procPath} {
+		if len(candidate) == 0 {
+			continue
+		}
+		dir := filepath.Join(root, candidate)
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return root
+}
+
+// функция читает пути cgroup процесса, для cgroup v2 ключ пустой
+func readProcCgroup(procFile string) map[string]string {
+	paths := make(map[string]string)
+	file, err := os.Open(procFile)
+	if err != nil {
+		return paths
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// формат строки hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if len(parts[1]) == 0 {
+			paths[""] = parts[2]
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+	return paths
+}
+
+// Name метод возвращает имя сборщика
+func (collector *CgroupCollector) Name() string {
+	return "cgroup"
+}
+
+// Version метод возвращает найденную версию cgroup
+func (collector *CgroupCollector) Version() int {
+	return collector.version
+}
+
+// Collect метод читает файлы cgroup, отсутствующие файлы пропускаются
+func (collector *CgroupCollector) Collect(ctx context.Context) ([]api.Metrics, error) {
+	stat, errs := collector.read()
+
+	collector.mx.Lock()
+	defer collector.mx.Unlock()
+	now := time.Now()
+
+	var metrics []api.Metrics
+	if stat.memUsage != nil {
+		metrics = append(metrics, api.NewGauge("cgroup_memory_usage_bytes", float64(*stat.memUsage)))
+	}
+	if stat.memLimit != nil {
+		metrics = append(metrics, api.NewGauge("cgroup_memory_limit_bytes", float64(*stat.memLimit)))
+		if stat.memUsage != nil && *stat.memLimit != 0 {
+			metrics = append(metrics, api.NewGauge("cgroup_memory_usage_percent",
+				float64(*stat.memUsage)/float64(*stat.memLimit)*100))
+		}
+	}
+	if stat.cpuUsage != nil {
+		prev, ok := collector.last["cpu_usage"]
+		delta := collector.delta("cpu_usage", *stat.cpuUsage)
+		metrics = append(metrics, api.NewCounter("cgroup_cpu_usage_usec", delta))
+		var percent float64
+		elapsed := now.Sub(collector.lastRun).Microseconds()
+		if ok && *stat.cpuUsage >= prev && !collector.lastRun.IsZero() && elapsed > 0 {
+			percent = float64(delta) / float64(elapsed) * 100
+		}
+		metrics = append(metrics, api.NewGauge("cgroup_cpu_usage_percent", percent))
+	}
+	if stat.cpuLimit != nil {
+		metrics = append(metrics, api.NewGauge("cgroup_cpu_limit_cores", *stat.cpuLimit))
+	}
+	for _, counter := range []struct {
+		value *uint64
+		name  string
+	}{
+		{stat.periods, "cgroup_cpu_periods"},
+		{stat.throttled, "cgroup_cpu_throttled_periods"},
+		{stat.throttledUsec, "cgroup_cpu_throttled_usec"},
+	} {
+		if counter.value != nil {
+			metrics = append(metrics, api.NewCounter(counter.name, collector.delta(counter.name, *counter.value)))
+		}
+	}
+	if stat.pids != nil {
+		metrics = append(metrics, api.NewGauge("cgroup_pids_current", float64(*stat.pids)))
+	}
+	if stat.pidsLimit != nil {
+		metrics = append(metrics, api.NewGauge("cgroup_pids_limit", float64(*stat.pidsLimit)))
+	}
+	collector.lastRun = now
+	return metrics, errors.Join(errs...)
+}
+
+// метод вычисляет приращение счетчика, при первом опросе приращение равно нулю
+func (collector *CgroupCollector) delta(name string, value uint64) int64 {
+	prev, ok := collector.last[name]
+	collector.last[name] = value
+	switch {
+	case !ok:
+		return 0
+	case value < prev:
+		// cgroup была пересоздана
+		return int64(value)
+	default:
+		return int64(value - prev)
+	}
+}
+
+// значения прочитанные из файлов cgroup, nil если файла нет.
+// Лимиты равны нулю если не заданы.
+type cgroupStat struct {
+	memUsage      *uint64
+	memLimit      *uint64
+	cpuUsage      *uint64
+	cpuLimit      *float64
+	periods       *uint64
+	throttled     *uint64
+	throttledUsec *uint64
+	pids          *uint64
+	pidsLimit     *uint64
+}
+
+func (collector *CgroupCollector) read() (cgroupStat, []error) {
+	var stat cgroupStat
+	var errs []error
+	addErr := func(err error) {
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	keep := func(value *uint64, err error) *uint64 {
+		addErr(err)
+		return value
+	}
+	file := func(controller, name string) string {
+		dir, ok := collector.dirs[controller]
+		if !ok {
+			return ""
+		}
+		return filepath.Join(dir, name)
+	}
+
+	if collector.version == 2 {
+		stat.memUsage = keep(readCgroupUint(file("memory", "memory.current")))
+		stat.memLimit = keep(readCgroupUint(file("memory", "memory.max")))
+		cpuStat, err := readCgroupKV(file("cpu", "cpu.stat"))
+		addErr(err)
+		stat.cpuUsage = cpuStat["usage_usec"]
+		stat.periods = cpuStat["nr_periods"]
+		stat.throttled = cpuStat["nr_throttled"]
+		stat.throttledUsec = cpuStat["throttled_usec"]
+		stat.cpuLimit, err = readCPUMax(file("cpu", "cpu.max"))
+		addErr(err)
+		stat.pids = keep(readCgroupUint(file("pids", "pids.current")))
+		stat.pidsLimit = keep(readCgroupUint(file("pids", "pids.max")))
+		return stat, errs
+	}
+
+	stat.memUsage = keep(readCgroupUint(file("memory", "memory.usage_in_bytes")))
+	stat.memLimit = keep(readCgroupUint(file("memory", "memory.limit_in_bytes")))
+	if stat.memLimit != nil && *stat.memLimit >= cgroupV1Unlimited {
+		*stat.memLimit = 0
+	}
+	if usageNs := keep(readCgroupUint(file("cpuacct", "cpuacct.usage"))); usageNs != nil {
+		usec := *usageNs / 1000
+		stat.cpuUsage = &usec
+	}
+	cpuStat, err := readCgroupKV(file("cpu", "cpu.stat"))
+	addErr(err)
+	stat.periods = cpuStat["nr_periods"]
+	stat.throttled = cpuStat["nr_throttled"]
+	if throttledNs := cpuStat["throttled_time"]; throttledNs != nil {
+		usec := *throttledNs / 1000
+		stat.throttledUsec = &usec
+	}
+	stat.cpuLimit, err = readCFSQuota(file("cpu", "cpu.cfs_quota_us"), file("cpu", "cpu.cfs_period_us"))
+	addErr(err)
+	stat.pids = keep(readCgroupUint(file("pids", "pids.current")))
+	stat.pidsLimit = keep(readCgroupUint(file("pids", "pids.max")))
+	return stat, errs
+}
+
+func readCgroupFile(path string) (string, error) {
+	if len(path) == 0 {
+		return "", os.ErrNotExist
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// функция читает число из файла, значение max означает отсутствие лимита и равно нулю
+func readCgroupUint(path string) (*uint64, error) {
+	data, err := readCgroupFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var value uint64
+	if data != "max" {
+		value, err = strconv.ParseUint(data, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error when parse %s %w", path, err)
+		}
+	}
+	return &value, nil
+}
+
+// функция читает файл из строк вида key value
+func readCgroupKV(path string) (map[string]*uint64, error) {
+	values := make(map[string]*uint64)
+	data, err := readCgroupFile(path)
+	if err != nil {
+		return values, err
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[fields[0]] = &value
+	}
+	return values, nil
+}
+
+// функция читает лимит CPU cgroup v2 в формате "quota period" или "max period"
+func readCPUMax(path string) (*float64, error) {
+	data, err := readCgroupFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cores float64
+	fields := strings.Fields(data)
+	if len(fields) == 2 && fields[0] != "max" {
+		quota, errQuota := strconv.ParseFloat(fields[0], 64)
+		period, errPeriod := strconv.ParseFloat(fields[1], 64)
+		if errQuota != nil || errPeriod != nil || period == 0 {
+			return nil, fmt.Errorf("error when parse %s %q", path, data)
+		}
+		cores = quota / period
+	}
+	return &cores, nil
+}
+
+// функция читает лимит CPU cgroup v1, квота -1 означает отсутствие лимита
+func readCFSQuota(quotaPath, periodPath string) (*float64, error) {
+	quotaData, err := readCgroupFile(quotaPath)
+	if err != nil {
+		return nil, err
+	}
+	var cores float64
+	quota, err := strconv.ParseInt(quotaData, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error when parse %s %w", quotaPath, err)
+	}
+	if quota > 0 {
+		period, err := readCgroupUint(periodPath)
+		if err != nil {
+			return nil, err
+		}
+		if *period != 0 {
+			cores = float64(quota) / float64(*period)
+		}
+	}
+	return &cores, nil
+}
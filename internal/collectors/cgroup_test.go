@@ -0,0 +1,94 @@
+package collectors
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+	}
+}
+
+func TestCgroupCollectorV2(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"cgroup.controllers": "cpu memory pids\n",
+		"memory.current":     "268435456\n",
+		"memory.max":         "536870912\n",
+		"cpu.stat":           "usage_usec 1000000\nnr_periods 10\nnr_throttled 2\nthrottled_usec 5000\n",
+		"cpu.max":            "150000 100000\n",
+		"pids.current":       "12\n",
+		"pids.max":           "max\n",
+	})
+
+	collector, err := NewCgroupCollector(CgroupConfig{Root: root, Enabled: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, collector.Version())
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	got := metricsByID(metrics)
+	assert.Equal(t, 268435456.0, *got["cgroup_memory_usage_bytes"].Value)
+	assert.Equal(t, 536870912.0, *got["cgroup_memory_limit_bytes"].Value)
+	assert.Equal(t, 50.0, *got["cgroup_memory_usage_percent"].Value)
+	assert.Equal(t, 1.5, *got["cgroup_cpu_limit_cores"].Value)
+	assert.Equal(t, 12.0, *got["cgroup_pids_current"].Value)
+	assert.Equal(t, 0.0, *got["cgroup_pids_limit"].Value)
+	// при первом опросе счетчики только запоминаются
+	assert.Equal(t, int64(0), *got["cgroup_cpu_usage_usec"].Delta)
+
+	writeFiles(t, root, map[string]string{
+		"cpu.stat": "usage_usec 1500000\nnr_periods 15\nnr_throttled 5\nthrottled_usec 8000\n",
+	})
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	got = metricsByID(metrics)
+	assert.Equal(t, int64(500000), *got["cgroup_cpu_usage_usec"].Delta)
+	assert.Equal(t, int64(5), *got["cgroup_cpu_periods"].Delta)
+	assert.Equal(t, int64(3), *got["cgroup_cpu_throttled_periods"].Delta)
+	assert.Equal(t, int64(3000), *got["cgroup_cpu_throttled_usec"].Delta)
+	assert.Greater(t, *got["cgroup_cpu_usage_percent"].Value, 0.0)
+}
+
+func TestCgroupCollectorV1(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"memory/memory.usage_in_bytes":  "1048576\n",
+		"memory/memory.limit_in_bytes":  "9223372036854771712\n",
+		"cpu,cpuacct/cpuacct.usage":     "2000000000\n",
+		"cpu,cpuacct/cpu.stat":          "nr_periods 4\nnr_throttled 1\nthrottled_time 3000000\n",
+		"cpu,cpuacct/cpu.cfs_quota_us":  "50000\n",
+		"cpu,cpuacct/cpu.cfs_period_us": "100000\n",
+	})
+
+	collector, err := NewCgroupCollector(CgroupConfig{Root: root, Enabled: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, collector.Version())
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	got := metricsByID(metrics)
+	assert.Equal(t, 1048576.0, *got["cgroup_memory_usage_bytes"].Value)
+	// лимит не задан
+	assert.Equal(t, 0.0, *got["cgroup_memory_limit_bytes"].Value)
+	assert.NotContains(t, got, "cgroup_memory_usage_percent")
+	assert.Equal(t, 0.5, *got["cgroup_cpu_limit_cores"].Value)
+	assert.Contains(t, got, "cgroup_cpu_throttled_usec")
+	// контроллер pids не смонтирован
+	assert.NotContains(t, got, "cgroup_pids_current")
+}
+
+func TestCgroupCollectorNotFound(t *testing.T) {
+	_, err := NewCgroupCollector(CgroupConfig{Root: t.TempDir(), Enabled: true})
+	assert.Error(t, err)
+}
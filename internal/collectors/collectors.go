@@ -0,0 +1,59 @@
+// Package collectors - пакет содержит дополнительные сборщики метрик агента
+package collectors
+
+import (
+	"context"
+	"sync"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+// Collector интерфейс дополнительного сборщика метрик
+type Collector interface {
+	// Name имя сборщика, используется в логах
+	Name() string
+	// Collect возвращает метрики собранные за один опрос
+	Collect(ctx context.Context) ([]api.Metrics, error)
+}
+
+// Runner интерфейс сборщика которому нужна работа в фоне между опросами,
+// метод Run блокируется до отмены контекста
+type Runner interface {
+	Run(ctx context.Context)
+}
+
+// буфер для накопления метрик фоновых сборщиков между опросами,
+// значение gauge заменяется последним, приращения counter суммируются
+type buffer struct {
+	metrics map[string]api.Metrics
+	mx      sync.Mutex
+}
+
+func newBuffer() *buffer {
+	return &buffer{metrics: make(map[string]api.Metrics)}
+}
+
+func (buf *buffer) add(metrics ...api.Metrics) {
+	buf.mx.Lock()
+	defer buf.mx.Unlock()
+	for _, metric := range metrics {
+		key := metric.MType + "/" + metric.ID
+		prev, ok := buf.metrics[key]
+		if ok && metric.MType == api.Counter {
+			metric = api.NewCounter(metric.ID, *prev.Delta+*metric.Delta)
+		}
+		buf.metrics[key] = metric
+	}
+}
+
+// метод возвращает накопленные метрики и очищает буфер
+func (buf *buffer) drain() []api.Metrics {
+	buf.mx.Lock()
+	defer buf.mx.Unlock()
+	metrics := make([]api.Metrics, 0, len(buf.metrics))
+	for key, metric := range buf.metrics {
+		metrics = append(metrics, metric)
+		delete(buf.metrics, key)
+	}
+	return metrics
+}
@@ -0,0 +1,252 @@
+package collectors
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+// константы используемые сборщиком метрик внешних команд
+const (
+	FormatLines     string        = "lines"
+	FormatJSON      string        = "json"
+	execInterval    time.Duration = 10
+	execTimeout     time.Duration = 5
+	execWaitDelay   time.Duration = time.Second
+	execStderrLimit int           = 256
+)
+
+// ExecCommand описание внешней команды, вывод которой превращается в метрики.
+// Формат lines - строки вида "name type value", формат json - массив api.Metrics
+type ExecCommand struct {
+	// Name имя команды, используется в префиксе служебных метрик exec_<name>_
+	Name string `json:"name"`
+	// Format формат вывода lines или json, по умолчанию определяется по первому символу вывода
+	Format string `json:"format,omitempty"`
+	// Prefix префикс имен метрик полученных от команды
+	Prefix string `json:"prefix,omitempty"`
+	// Command команда и ее аргументы, запускается без shell
+	Command []string `json:"command"`
+	// Interval интервал запуска в секундах
+	Interval int `json:"interval,omitempty"`
+	// Timeout таймаут выполнения в секундах
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// ExecCollector сборщик метрик из вывода внешних команд,
+// каждая команда запускается в фоне со своим интервалом
+type ExecCollector struct {
+	pending  *buffer
+	errs     []error
+	commands []ExecCommand
+	mx       sync.Mutex
+}
+
+// NewExecCollector функция создания сборщика метрик внешних команд
+func NewExecCollector(commands []ExecCommand) (*ExecCollector, error) {
+	collector := &ExecCollector{pending: newBuffer()}
+	for _, command := range commands {
+		if len(command.Name) == 0 {
+			return nil, errors.New("exec command without name")
+		}
+		if len(command.Command) == 0 {
+			return nil, fmt.Errorf("exec command %s is empty", command.Name)
+		}
+		if len(command.Format) != 0 && command.Format != FormatLines && command.Format != FormatJSON {
+			return nil, fmt.Errorf("exec command %s unknown format %s", command.Name, command.Format)
+		}
+		if command.Interval <= 0 {
+			command.Interval = int(execInterval)
+		}
+		if command.Timeout <= 0 {
+			command.Timeout = int(execTimeout)
+		}
+		if command.Timeout > command.Interval {
+			return nil, fmt.Errorf("exec command %s timeout greater than interval", command.Name)
+		}
+		collector.commands = append(collector.commands, command)
+	}
+	return collector, nil
+}
+
+// Name метод возвращает имя сборщика
+func (collector *ExecCollector) Name() string {
+	return "exec"
+}
+
+// Collect метод возвращает метрики и ошибки команд накопленные с предыдущего опроса
+func (collector *ExecCollector) Collect(ctx context.Context) ([]api.Metrics, error) {
+	collector.mx.Lock()
+	err := errors.Join(collector.errs...)
+	collector.errs = nil
+	collector.mx.Unlock()
+	return collector.pending.drain(), err
+}
+
+// Run метод запускает каждую команду в отдельной горутине со своим интервалом
+func (collector *ExecCollector) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for _, command := range collector.commands {
+		wg.Add(1)
+		go func(command ExecCommand) {
+			defer wg.Done()
+			ticker := time.NewTicker(time.Duration(command.Interval) * time.Second)
+			defer ticker.Stop()
+			for {
+				metrics, err := collector.run(ctx, command)
+				if ctx.Err() != nil {
+					// агент останавливается, результат прерванной команды не нужен
+					return
+				}
+				collector.pending.add(metrics...)
+				if err != nil {
+					collector.mx.Lock()
+					collector.errs = append(collector.errs, err)
+					collector.mx.Unlock()
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(command)
+	}
+	wg.Wait()
+}
+
+// метод запускает команду один раз и возвращает ее метрики вместе со служебными:
+// exec_<name>_up, exec_<name>_duration, exec_<name>_failures и exec_<name>_timeouts
+func (collector *ExecCollector) run(ctx context.Context, command ExecCommand) ([]api.Metrics, error) {
+	var stdout, stderr bytes.Buffer
+	var metrics []api.Metrics
+	var failures, timeouts int64
+	var runErr error
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(command.Timeout)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command.Command[0], command.Command[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = execWaitDelay
+
+	start := time.Now()
+	err := cmd.Run()
+	duration := time.Since(start)
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		timeouts = 1
+		failures = 1
+		runErr = fmt.Errorf("exec command %s timed out after %ds", command.Name, command.Timeout)
+	case err != nil:
+		failures = 1
+		runErr = fmt.Errorf("exec command %s failed %w: %s", command.Name, err, limitStderr(stderr.String()))
+	default:
+		metrics, err = parseExecOutput(stdout.Bytes(), command.Format)
+		if err != nil {
+			failures = 1
+			runErr = fmt.Errorf("exec command %s wrong output %w", command.Name, err)
+		}
+		for i := range metrics {
+			metrics[i].ID = api.SanitizeName(command.Prefix + metrics[i].ID)
+		}
+	}
+
+	up := float64(1)
+	if failures != 0 {
+		up = 0
+	}
+	prefix := api.SanitizeName("exec_" + command.Name + "_")
+	return append(metrics,
+		api.NewGauge(prefix+"up", up),
+		api.NewGauge(prefix+"duration", duration.Seconds()),
+		api.NewCounter(prefix+"failures", failures),
+		api.NewCounter(prefix+"timeouts", timeouts),
+	), runErr
+}
+
+// функция обрезает вывод stderr для сообщения об ошибке
+func limitStderr(stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if len(stderr) > execStderrLimit {
+		return stderr[:execStderrLimit] + "..."
+	}
+	return stderr
+}
+
+// функция разбирает вывод команды в формате lines или json
+func parseExecOutput(output []byte, format string) ([]api.Metrics, error) {
+	trimmed := bytes.TrimSpace(output)
+	if len(format) == 0 {
+		format = FormatLines
+		if bytes.HasPrefix(trimmed, []byte("[")) {
+			format = FormatJSON
+		}
+	}
+	if format == FormatJSON {
+		return parseExecJSON(trimmed)
+	}
+	return parseExecLines(trimmed)
+}
+
+func parseExecJSON(output []byte) ([]api.Metrics, error) {
+	var metrics []api.Metrics
+	if err := json.Unmarshal(output, &metrics); err != nil {
+		return nil, fmt.Errorf("error when unmarshal exec output %w", err)
+	}
+	for _, metric := range metrics {
+		switch {
+		case len(metric.ID) == 0:
+			return nil, errors.New("metric without id")
+		case metric.MType == api.Gauge && metric.Value != nil:
+		case metric.MType == api.Counter && metric.Delta != nil:
+		default:
+			return nil, fmt.Errorf("metric %s wrong type or empty value", metric.ID)
+		}
+	}
+	return metrics, nil
+}
+
+func parseExecLines(output []byte) ([]api.Metrics, error) {
+	var metrics []api.Metrics
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d must be \"name type value\"", lineNum)
+		}
+		switch fields[1] {
+		case api.Gauge:
+			value, err := strconv.ParseFloat(fields[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d wrong gauge value %w", lineNum, err)
+			}
+			metrics = append(metrics, api.NewGauge(fields[0], value))
+		case api.Counter:
+			delta, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d wrong counter value %w", lineNum, err)
+			}
+			metrics = append(metrics, api.NewCounter(fields[0], delta))
+		default:
+			return nil, fmt.Errorf("line %d wrong metric type %s", lineNum, fields[1])
+		}
+	}
+	return metrics, scanner.Err()
+}
@@ -0,0 +1,67 @@
+package collectors
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExecOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		format  string
+		want    int
+		wantErr bool
+	}{
+		{name: "lines", output: "# comment\nqueue gauge 1.5\n\nerrors counter 3\n", want: 2},
+		{name: "json detected", output: `[{"id":"queue","type":"gauge","value":2}]`, want: 1},
+		{name: "empty output", output: "", want: 0},
+		{name: "wrong type", output: "queue histogram 1", wantErr: true},
+		{name: "wrong field count", output: "queue gauge", wantErr: true},
+		{name: "float counter", output: "errors counter 1.5", wantErr: true},
+		{name: "json without value", output: `[{"id":"queue","type":"gauge"}]`, wantErr: true},
+		{name: "lines forced as json", output: "queue gauge 1", format: FormatJSON, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := parseExecOutput([]byte(tt.output), tt.format)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, metrics, tt.want)
+		})
+	}
+}
+
+func TestExecCollectorRun(t *testing.T) {
+	collector, err := NewExecCollector([]ExecCommand{
+		{Name: "ok", Command: []string{"sh", "-c", "echo 'queue gauge 7'"}, Prefix: "job_"},
+		{Name: "fail", Command: []string{"sh", "-c", "echo boom >&2; exit 3"}},
+		{Name: "slow", Command: []string{"sleep", "5"}, Timeout: 1},
+	})
+	require.NoError(t, err)
+
+	for _, command := range collector.commands {
+		metrics, err := collector.run(context.Background(), command)
+		collector.pending.add(metrics...)
+		if command.Name == "ok" {
+			assert.NoError(t, err)
+		} else {
+			assert.Error(t, err)
+		}
+	}
+
+	got := metricsByID(collector.pending.drain())
+	assert.Equal(t, float64(7), *got["job_queue"].Value)
+	assert.Equal(t, float64(1), *got["exec_ok_up"].Value)
+	assert.Equal(t, float64(0), *got["exec_fail_up"].Value)
+	assert.Equal(t, int64(1), *got["exec_fail_failures"].Delta)
+	assert.Equal(t, int64(0), *got["exec_fail_timeouts"].Delta)
+	assert.Equal(t, float64(0), *got["exec_slow_up"].Value)
+	assert.Equal(t, int64(1), *got["exec_slow_timeouts"].Delta)
+}
@@ -0,0 +1,389 @@
+package collectors
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+// константы используемые сборщиком метрик из лог файлов
+const (
+	tailInterval       time.Duration = 1
+	tailReadChunk      int           = 64 << 10
+	tailMaxLine        int           = 1 << 20
+	tailFingerprintLen int64         = 64
+)
+
+// LogTailConfig настройки сборщика метрик из лог файлов
+type LogTailConfig struct {
+	// StateFile файл для сохранения позиций чтения между перезапусками агента
+	StateFile string `json:"state_file,omitempty"`
+	// Files отслеживаемые файлы
+	Files []LogFile `json:"files"`
+}
+
+// LogFile отслеживаемый лог файл и правила для его строк
+type LogFile struct {
+	Path  string    `json:"path"`
+	Rules []LogRule `json:"rules"`
+}
+
+// LogRule правило превращающее совпадение регулярного выражения в метрику.
+// В имени метрики можно использовать именованные группы в виде ${group}
+type LogRule struct {
+	// Metric имя метрики, например errors_${service}
+	Metric string `json:"metric"`
+	// Regexp регулярное выражение для строки лога
+	Regexp string `json:"regexp"`
+	// Type тип метрики counter или gauge
+	Type string `json:"type"`
+	// Value имя группы со значением, обязательно для gauge,
+	// для counter по умолчанию каждое совпадение увеличивает счетчик на 1
+	Value string `json:"value,omitempty"`
+}
+
+// LogTailer сборщик метрик из строк лог файлов, переживает ротацию и обрезание файлов
+type LogTailer struct {
+	pending   *buffer
+	stateFile string
+	files     []*tailedFile
+	errs      []error
+	mx        sync.Mutex
+}
+
+type logRule struct {
+	re *regexp.Regexp
+	LogRule
+	valueIdx int
+}
+
+type tailedFile struct {
+	file   *os.File
+	path   string
+	rules  []logRule
+	offset int64
+	// пропускается окончание строки длиннее tailMaxLine
+	skipping bool
+}
+
+// позиция чтения файла сохраняемая между перезапусками
+type tailState struct {
+	Fingerprint string `json:"fingerprint"`
+	Offset      int64  `json:"offset"`
+}
+
+// NewLogTailer функция создания сборщика, позиции чтения восстанавливаются из файла состояния
+func NewLogTailer(cfg LogTailConfig) (*LogTailer, error) {
+	tailer := &LogTailer{pending: newBuffer(), stateFile: cfg.StateFile}
+
+	state, err := loadTailState(cfg.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, logFile := range cfg.Files {
+		if len(logFile.Path) == 0 {
+			return nil, errors.New("log file without path")
+		}
+		tailed := &tailedFile{path: logFile.Path}
+		for _, rule := range logFile.Rules {
+			compiled, err := compileLogRule(rule)
+			if err != nil {
+				return nil, fmt.Errorf("log file %s %w", logFile.Path, err)
+			}
+			tailed.rules = append(tailed.rules, compiled)
+		}
+		tailed.openAt(state[logFile.Path])
+		tailer.files = append(tailer.files, tailed)
+	}
+	return tailer, nil
+}
+
+func compileLogRule(rule LogRule) (logRule, error) {
+	compiled := logRule{LogRule: rule, valueIdx: -1}
+	if len(rule.Metric) == 0 {
+		return logRule{}, errors.New("rule without metric name")
+	}
+	if rule.Type != api.Counter && rule.Type != api.Gauge {
+		return logRule{}, fmt.Errorf("rule %s wrong metric type %s", rule.Metric, rule.Type)
+	}
+	re, err := regexp.Compile(rule.Regexp)
+	if err != nil {
+		return logRule{}, fmt.Errorf("rule %s wrong regexp %w", rule.Metric, err)
+	}
+	compiled.re = re
+	if len(rule.Value) != 0 {
+		compiled.valueIdx = re.SubexpIndex(rule.Value)
+		if compiled.valueIdx < 0 {
+			return logRule{}, fmt.Errorf("rule %s regexp has no group %s", rule.Metric, rule.Value)
+		}
+	}
+	if rule.Type == api.Gauge && compiled.valueIdx < 0 {
+		return logRule{}, fmt.Errorf("gauge rule %s requires value group", rule.Metric)
+	}
+	return compiled, nil
+}
+
+// Name метод возвращает имя сборщика
+func (tailer *LogTailer) Name() string {
+	return "logtail"
+}
+
+// Collect метод возвращает метрики и ошибки накопленные с предыдущего опроса
+func (tailer *LogTailer) Collect(ctx context.Context) ([]api.Metrics, error) {
+	tailer.mx.Lock()
+	err := errors.Join(tailer.errs...)
+	tailer.errs = nil
+	tailer.mx.Unlock()
+	return tailer.pending.drain(), err
+}
+
+// Run метод периодически дочитывает файлы и сохраняет позиции чтения
+func (tailer *LogTailer) Run(ctx context.Context) {
+	ticker := time.NewTicker(tailInterval * time.Second)
+	defer ticker.Stop()
+	defer tailer.close()
+	for {
+		tailer.poll()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// метод дочитывает все файлы один раз
+func (tailer *LogTailer) poll() {
+	var errs []error
+	for _, tailed := range tailer.files {
+		metrics, err := tailed.poll()
+		tailer.pending.add(metrics...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error when tail %s %w", tailed.path, err))
+		}
+	}
+	if err := tailer.saveState(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) != 0 {
+		tailer.mx.Lock()
+		tailer.errs = append(tailer.errs, errs...)
+		tailer.mx.Unlock()
+	}
+}
+
+func (tailer *LogTailer) close() {
+	for _, tailed := range tailer.files {
+		if tailed.file != nil {
+			_ = tailed.file.Close()
+			tailed.file = nil
+		}
+	}
+}
+
+// метод открывает файл при старте агента, если сохраненная позиция
+// относится к этому же файлу чтение продолжается с нее, иначе с конца файла
+func (tailed *tailedFile) openAt(state tailState) {
+	file, err := os.Open(tailed.path)
+	if err != nil {
+		// файл появится позже и будет прочитан с начала
+		return
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return
+	}
+	tailed.file = file
+	tailed.offset = info.Size()
+	if len(state.Fingerprint) != 0 && state.Offset <= info.Size() &&
+		fingerprint(file, state.Offset) == state.Fingerprint {
+		tailed.offset = state.Offset
+	}
+}
+
+// метод дочитывает новые строки, обрабатывает ротацию и обрезание файла
+func (tailed *tailedFile) poll() ([]api.Metrics, error) {
+	var metrics []api.Metrics
+
+	info, err := os.Stat(tailed.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if tailed.file != nil {
+		openedInfo, statErr := tailed.file.Stat()
+		rotated := err != nil || statErr != nil || !os.SameFile(info, openedInfo)
+		if rotated {
+			// дочитываем старый файл и переключаемся на новый
+			metrics, err = tailed.readLines()
+			_ = tailed.file.Close()
+			tailed.file = nil
+			tailed.offset = 0
+			if err != nil {
+				return metrics, err
+			}
+		} else if openedInfo.Size() < tailed.offset {
+			// файл обрезан
+			tailed.offset = 0
+			tailed.skipping = false
+		}
+	}
+
+	if tailed.file == nil {
+		file, err := os.Open(tailed.path)
+		if errors.Is(err, os.ErrNotExist) {
+			return metrics, nil
+		}
+		if err != nil {
+			return metrics, err
+		}
+		tailed.file = file
+		tailed.offset = 0
+		tailed.skipping = false
+	}
+
+	newMetrics, err := tailed.readLines()
+	return append(metrics, newMetrics...), err
+}
+
+// метод читает полные строки начиная с текущей позиции. Строки длиннее
+// tailMaxLine отбрасываются целиком, позиция чтения переносится за них.
+func (tailed *tailedFile) readLines() ([]api.Metrics, error) {
+	var metrics []api.Metrics
+	chunk := make([]byte, tailReadChunk)
+	var partial []byte
+
+	for {
+		n, err := tailed.file.ReadAt(chunk, tailed.offset+int64(len(partial)))
+		data := append(partial, chunk[:n]...)
+		last := bytes.LastIndexByte(data, '\n')
+		if last >= 0 {
+			lines := bytes.Split(data[:last], []byte("\n"))
+			if tailed.skipping {
+				lines = lines[1:]
+				tailed.skipping = false
+			}
+			for _, line := range lines {
+				metrics = append(metrics, tailed.match(string(bytes.TrimRight(line, "\r")))...)
+			}
+			tailed.offset += int64(last + 1)
+			partial = append([]byte(nil), data[last+1:]...)
+		} else {
+			partial = data
+		}
+		if len(partial) > tailMaxLine {
+			tailed.offset += int64(len(partial))
+			partial = nil
+			tailed.skipping = true
+		}
+		if errors.Is(err, io.EOF) || n == 0 {
+			break
+		}
+		if err != nil {
+			return metrics, err
+		}
+	}
+	return metrics, nil
+}
+
+// метод применяет правила к строке
+func (tailed *tailedFile) match(line string) []api.Metrics {
+	var metrics []api.Metrics
+	for _, rule := range tailed.rules {
+		idx := rule.re.FindStringSubmatchIndex(line)
+		if idx == nil {
+			continue
+		}
+		name := api.SanitizeName(string(rule.re.ExpandString(nil, rule.Metric, line, idx)))
+
+		var value string
+		if rule.valueIdx >= 0 && idx[2*rule.valueIdx] >= 0 {
+			value = line[idx[2*rule.valueIdx]:idx[2*rule.valueIdx+1]]
+		}
+		switch {
+		case rule.Type == api.Gauge:
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			metrics = append(metrics, api.NewGauge(name, parsed))
+		case rule.valueIdx >= 0:
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			metrics = append(metrics, api.NewCounter(name, parsed))
+		default:
+			metrics = append(metrics, api.NewCounter(name, 1))
+		}
+	}
+	return metrics
+}
+
+// функция считает отпечаток начала файла до позиции чтения, по нему
+// определяется что сохраненная позиция относится к тому же файлу
+func fingerprint(file *os.File, offset int64) string {
+	head := make([]byte, min(offset, tailFingerprintLen))
+	if _, err := file.ReadAt(head, 0); err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(head)
+	return hex.EncodeToString(sum[:])
+}
+
+func loadTailState(stateFile string) (map[string]tailState, error) {
+	state := make(map[string]tailState)
+	if len(stateFile) == 0 {
+		return state, nil
+	}
+	data, err := os.ReadFile(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error when read tail state %w", err)
+	}
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("error when unmarshal tail state %w", err)
+	}
+	return state, nil
+}
+
+// метод сохраняет позиции чтения, файл пишется через временный чтобы не потерять состояние
+func (tailer *LogTailer) saveState() error {
+	if len(tailer.stateFile) == 0 {
+		return nil
+	}
+	state := make(map[string]tailState, len(tailer.files))
+	for _, tailed := range tailer.files {
+		if tailed.file != nil {
+			state[tailed.path] = tailState{Fingerprint: fingerprint(tailed.file, tailed.offset), Offset: tailed.offset}
+		}
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error when marshal tail state %w", err)
+	}
+	tmpFile := tailer.stateFile + "tmp"
+	if err = os.WriteFile(tmpFile, data, 0644); err != nil {
+		return fmt.Errorf("error when write tail state %w", err)
+	}
+	if err = os.Rename(tmpFile, tailer.stateFile); err != nil {
+		return fmt.Errorf("error when save tail state %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package collectors
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+func appendLines(t *testing.T, path, lines string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(lines)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+}
+
+func TestLogTailer(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	cfg := LogTailConfig{
+		StateFile: filepath.Join(dir, "state.json"),
+		Files: []LogFile{{
+			Path: logPath,
+			Rules: []LogRule{
+				{Metric: "errors_${service}", Regexp: `ERROR service=(?P<service>\w+)`, Type: api.Counter},
+				{Metric: "latency", Regexp: `latency=(?P<ms>[0-9.]+)ms`, Type: api.Gauge, Value: "ms"},
+			},
+		}},
+	}
+
+	// строки записанные до первого запуска агента не учитываются
+	appendLines(t, logPath, "ERROR service=old\n")
+
+	tailer, err := NewLogTailer(cfg)
+	require.NoError(t, err)
+
+	collect := func() map[string]api.Metrics {
+		tailer.poll()
+		metrics, err := tailer.Collect(context.Background())
+		require.NoError(t, err)
+		return metricsByID(metrics)
+	}
+
+	t.Run("new lines", func(t *testing.T) {
+		appendLines(t, logPath, "ERROR service=api\nERROR service=api\nlatency=12.5ms\nERROR service=")
+		got := collect()
+		assert.Equal(t, int64(2), *got["errors_api"].Delta)
+		assert.Equal(t, 12.5, *got["latency"].Value)
+		assert.NotContains(t, got, "errors_old")
+	})
+
+	t.Run("partial line completed", func(t *testing.T) {
+		appendLines(t, logPath, "db\n")
+		got := collect()
+		assert.Equal(t, int64(1), *got["errors_db"].Delta)
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		appendLines(t, logPath, "ERROR service=api\n")
+		require.NoError(t, os.Rename(logPath, logPath+".1"))
+		appendLines(t, logPath, "ERROR service=api\n")
+		got := collect()
+		assert.Equal(t, int64(2), *got["errors_api"].Delta)
+	})
+
+	t.Run("truncation", func(t *testing.T) {
+		require.NoError(t, os.Truncate(logPath, 0))
+		appendLines(t, logPath, "ERROR service=db\n")
+		got := collect()
+		assert.Equal(t, int64(1), *got["errors_db"].Delta)
+	})
+
+	t.Run("long line dropped", func(t *testing.T) {
+		long := "ERROR service=long " + strings.Repeat("x", 2*tailMaxLine)
+		appendLines(t, logPath, "ERROR service=api\n"+long[:tailMaxLine])
+		got := collect()
+		assert.Equal(t, int64(1), *got["errors_api"].Delta)
+
+		// окончание длинной строки тоже отбрасывается
+		appendLines(t, logPath, long[tailMaxLine:]+"\nERROR service=api\n")
+		got = collect()
+		assert.Equal(t, int64(1), *got["errors_api"].Delta)
+		assert.NotContains(t, got, "errors_long")
+		info, err := os.Stat(logPath)
+		require.NoError(t, err)
+		assert.Equal(t, info.Size(), tailer.files[0].offset)
+	})
+
+	t.Run("restart does not recount", func(t *testing.T) {
+		tailer.close()
+		appendLines(t, logPath, "ERROR service=web\n")
+
+		tailer, err = NewLogTailer(cfg)
+		require.NoError(t, err)
+		got := collect()
+		assert.Equal(t, int64(1), *got["errors_web"].Delta)
+		assert.NotContains(t, got, "errors_db")
+	})
+}
+
+func TestCompileLogRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule LogRule
+	}{
+		{name: "without metric", rule: LogRule{Regexp: "x", Type: api.Counter}},
+		{name: "wrong type", rule: LogRule{Metric: "m", Regexp: "x", Type: "histogram"}},
+		{name: "bad regexp", rule: LogRule{Metric: "m", Regexp: "(", Type: api.Counter}},
+		{name: "gauge without value", rule: LogRule{Metric: "m", Regexp: "x", Type: api.Gauge}},
+		{name: "unknown group", rule: LogRule{Metric: "m", Regexp: "(?P<a>x)", Type: api.Gauge, Value: "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileLogRule(tt.rule)
+			assert.Error(t, err)
+		})
+	}
+}
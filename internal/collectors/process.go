@@ -0,0 +1,240 @@
+package collectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+// ProcessTarget описание отслеживаемого процесса,
+// процесс ищется по pid файлу, имени или регулярному выражению для командной строки
+type ProcessTarget struct {
+	// Name имя цели, используется в префиксе имен метрик proc_<name>_
+	Name string `json:"name"`
+	// PidFile путь к файлу с pid процесса
+	PidFile string `json:"pid_file,omitempty"`
+	// Process точное имя процесса
+	Process string `json:"process,omitempty"`
+	// Cmdline регулярное выражение для командной строки процесса
+	Cmdline string `json:"cmdline,omitempty"`
+}
+
+// ProcessCollector сборщик метрик отслеживаемых процессов
+type ProcessCollector struct {
+	// процессы с предыдущего опроса, нужны для вычисления загрузки CPU
+	procs   map[int32]*trackedProc
+	targets []processTarget
+	mx      sync.Mutex
+}
+
+type processTarget struct {
+	cmdline *regexp.Regexp
+	ProcessTarget
+}
+
+type trackedProc struct {
+	proc       *process.Process
+	createTime int64
+}
+
+// агрегированные значения по всем процессам цели
+type procStat struct {
+	cpuPercent float64
+	rss        uint64
+	uptime     time.Duration
+	fds        int64
+	threads    int64
+	count      int64
+}
+
+// NewProcessCollector функция создания сборщика метрик процессов
+func NewProcessCollector(targets []ProcessTarget) (*ProcessCollector, error) {
+	collector := &ProcessCollector{procs: make(map[int32]*trackedProc)}
+	for _, target := range targets {
+		if len(target.Name) == 0 {
+			return nil, errors.New("process target without name")
+		}
+		var selectors int
+		for _, selector := range []string{target.PidFile, target.Process, target.Cmdline} {
+			if len(selector) != 0 {
+				selectors++
+			}
+		}
+		if selectors != 1 {
+			return nil, fmt.Errorf("process target %s must have one of pid_file, process or cmdline", target.Name)
+		}
+		compiled := processTarget{ProcessTarget: target}
+		if len(target.Cmdline) != 0 {
+			var err error
+			compiled.cmdline, err = regexp.Compile(target.Cmdline)
+			if err != nil {
+				return nil, fmt.Errorf("error when compile cmdline regexp for %s %w", target.Name, err)
+			}
+		}
+		collector.targets = append(collector.targets, compiled)
+	}
+	return collector, nil
+}
+
+// Name метод возвращает имя сборщика
+func (collector *ProcessCollector) Name() string {
+	return "process"
+}
+
+// Collect метод собирает метрики по всем целям, если под цель попадает
+// несколько процессов их значения суммируются, uptime берется у самого старого
+func (collector *ProcessCollector) Collect(ctx context.Context) ([]api.Metrics, error) {
+	var metrics []api.Metrics
+	var errs []error
+
+	collector.mx.Lock()
+	defer collector.mx.Unlock()
+
+	var all []*process.Process
+	seen := make(map[int32]bool)
+
+	for _, target := range collector.targets {
+		var pids []int32
+		var err error
+
+		if len(target.PidFile) != 0 {
+			pids, err = pidFromFile(target.PidFile)
+		} else {
+			if all == nil {
+				all, err = process.ProcessesWithContext(ctx)
+			}
+			if err == nil {
+				pids = matchProcesses(ctx, all, target)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error when find process %s %w", target.Name, err))
+		}
+
+		var stat procStat
+		for _, pid := range pids {
+			proc, ok := collector.tracked(ctx, pid)
+			if !ok {
+				continue
+			}
+			if stat.add(ctx, proc) {
+				seen[pid] = true
+			}
+		}
+
+		prefix := api.SanitizeName("proc_" + target.Name + "_")
+		metrics = append(metrics,
+			api.NewGauge(prefix+"count", float64(stat.count)),
+			api.NewGauge(prefix+"cpu_percent", stat.cpuPercent),
+			api.NewGauge(prefix+"rss", float64(stat.rss)),
+			api.NewGauge(prefix+"num_fds", float64(stat.fds)),
+			api.NewGauge(prefix+"num_threads", float64(stat.threads)),
+			api.NewGauge(prefix+"uptime", stat.uptime.Seconds()),
+		)
+	}
+
+	// забываем процессы которые завершились или больше не подходят под цели
+	for pid := range collector.procs {
+		if !seen[pid] {
+			delete(collector.procs, pid)
+		}
+	}
+	return metrics, errors.Join(errs...)
+}
+
+// метод возвращает процесс из кэша, если pid был переиспользован
+// другим процессом то в кэш записывается новый процесс
+func (collector *ProcessCollector) tracked(ctx context.Context, pid int32) (*process.Process, bool) {
+	proc, err := process.NewProcessWithContext(ctx, pid)
+	if err != nil {
+		return nil, false
+	}
+	createTime, err := proc.CreateTimeWithContext(ctx)
+	if err != nil {
+		return nil, false
+	}
+	cached, ok := collector.procs[pid]
+	if ok && cached.createTime == createTime {
+		return cached.proc, true
+	}
+	collector.procs[pid] = &trackedProc{proc: proc, createTime: createTime}
+	return proc, true
+}
+
+// метод добавляет значения процесса к агрегированным значениям,
+// возвращает false если процесс завершился во время опроса
+func (stat *procStat) add(ctx context.Context, proc *process.Process) bool {
+	memInfo, err := proc.MemoryInfoWithContext(ctx)
+	if err != nil {
+		return false
+	}
+	cpuPercent, err := proc.PercentWithContext(ctx, 0)
+	if err != nil {
+		return false
+	}
+	createTime, err := proc.CreateTimeWithContext(ctx)
+	if err != nil {
+		return false
+	}
+
+	stat.count++
+	stat.cpuPercent += cpuPercent
+	stat.rss += memInfo.RSS
+	uptime := time.Since(time.UnixMilli(createTime))
+	if uptime > stat.uptime {
+		stat.uptime = uptime
+	}
+	// количество дескрипторов и потоков доступно не на всех платформах
+	if fds, err := proc.NumFDsWithContext(ctx); err == nil {
+		stat.fds += int64(fds)
+	}
+	if threads, err := proc.NumThreadsWithContext(ctx); err == nil {
+		stat.threads += int64(threads)
+	}
+	return true
+}
+
+// функция читает pid из файла, если файла нет то процесс считается не запущенным
+func pidFromFile(pidFile string) ([]int32, error) {
+	data, err := os.ReadFile(pidFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error when read pid file %w", err)
+	}
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("wrong pid in file %s %w", pidFile, err)
+	}
+	return []int32{int32(pid)}, nil
+}
+
+// функция возвращает pid процессов подходящих под имя или командную строку
+func matchProcesses(ctx context.Context, all []*process.Process, target processTarget) []int32 {
+	var pids []int32
+	for _, proc := range all {
+		if target.cmdline != nil {
+			cmdline, err := proc.CmdlineWithContext(ctx)
+			if err == nil && target.cmdline.MatchString(cmdline) {
+				pids = append(pids, proc.Pid)
+			}
+			continue
+		}
+		name, err := proc.NameWithContext(ctx)
+		if err == nil && name == target.Process {
+			pids = append(pids, proc.Pid)
+		}
+	}
+	return pids
+}
@@ -0,0 +1,65 @@
+package collectors
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessCollector(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "self.pid")
+	require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644))
+
+	collector, err := NewProcessCollector([]ProcessTarget{
+		{Name: "self", PidFile: pidFile},
+		{Name: "missing", PidFile: filepath.Join(t.TempDir(), "missing.pid")},
+		{Name: "nomatch", Cmdline: "^no-such-process-[0-9]+$"},
+	})
+	require.NoError(t, err)
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	got := metricsByID(metrics)
+
+	t.Run("tracked process", func(t *testing.T) {
+		assert.Equal(t, float64(1), *got["proc_self_count"].Value)
+		assert.Greater(t, *got["proc_self_rss"].Value, float64(0))
+		assert.Greater(t, *got["proc_self_num_threads"].Value, float64(0))
+	})
+
+	t.Run("absent processes", func(t *testing.T) {
+		assert.Equal(t, float64(0), *got["proc_missing_count"].Value)
+		assert.Equal(t, float64(0), *got["proc_nomatch_count"].Value)
+	})
+
+	t.Run("process disappeared", func(t *testing.T) {
+		require.NoError(t, os.Remove(pidFile))
+		metrics, err = collector.Collect(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, float64(0), *metricsByID(metrics)["proc_self_count"].Value)
+		assert.Empty(t, collector.procs)
+	})
+}
+
+func TestNewProcessCollectorValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		target ProcessTarget
+	}{
+		{name: "without name", target: ProcessTarget{Process: "sshd"}},
+		{name: "without selector", target: ProcessTarget{Name: "sshd"}},
+		{name: "two selectors", target: ProcessTarget{Name: "sshd", Process: "sshd", Cmdline: "sshd"}},
+		{name: "bad regexp", target: ProcessTarget{Name: "sshd", Cmdline: "("}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewProcessCollector([]ProcessTarget{tt.target})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package collectors
+
+import (
+	"context"
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"strings"
+	"sync"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+// перцентили отправляемые для гистограмм runtime/metrics
+var runtimeQuantiles = []struct {
+	suffix string
+	rank   float64
+}{
+	{"_p50", 0.5},
+	{"_p90", 0.9},
+	{"_p99", 0.99},
+}
+
+// RuntimeConfig настройки сборщика метрик среды выполнения Go
+type RuntimeConfig struct {
+	Enabled bool `json:"enabled"`
+	// MemStats отправлять также метрики с именами runtime.MemStats (Alloc, HeapAlloc и т.д.)
+	MemStats bool `json:"memstats,omitempty"`
+}
+
+// RuntimeCollector сборщик метрик из пакета runtime/metrics, в отличие от
+// runtime.ReadMemStats не останавливает выполнение программы.
+// Имена метрик получаются из имен runtime/metrics с префиксом go,
+// например /gc/heap/allocs:bytes - go_gc_heap_allocs_bytes.
+type RuntimeCollector struct {
+	samples []metrics.Sample
+	names   map[string]string
+	// накопительные метрики определяются по описанию runtime/metrics
+	cumulative map[string]bool
+	// накопительные значения с предыдущего опроса
+	lastUint map[string]uint64
+	lastHist map[string][]uint64
+	memStats bool
+	mx       sync.Mutex
+}
+
+// NewRuntimeCollector функция создания сборщика для всех поддерживаемых метрик
+func NewRuntimeCollector(cfg RuntimeConfig) *RuntimeCollector {
+	collector := &RuntimeCollector{
+		names:      make(map[string]string),
+		cumulative: make(map[string]bool),
+		lastUint:   make(map[string]uint64),
+		lastHist:   make(map[string][]uint64),
+		memStats:   cfg.MemStats,
+	}
+	for _, desc := range metrics.All() {
+		if desc.Kind == metrics.KindBad {
+			continue
+		}
+		collector.samples = append(collector.samples, metrics.Sample{Name: desc.Name})
+		collector.names[desc.Name] = RuntimeMetricName(desc.Name)
+		collector.cumulative[desc.Name] = desc.Cumulative
+	}
+	return collector
+}
+
+// RuntimeMetricName функция преобразует имя runtime/metrics в имя метрики агента
+func RuntimeMetricName(name string) string {
+	return "go" + api.SanitizeName(strings.ReplaceAll(name, ":", "/"))
+}
+
+// Name метод возвращает имя сборщика
+func (collector *RuntimeCollector) Name() string {
+	return "runtime"
+}
+
+// Collect метод читает метрики среды выполнения.
+// Накопительные целые значения отправляются как counter с приращением с предыдущего опроса,
+// остальные как gauge. Для гистограмм отправляется число событий и перцентили
+// распределения событий с предыдущего опроса.
+func (collector *RuntimeCollector) Collect(ctx context.Context) ([]api.Metrics, error) {
+	collector.mx.Lock()
+	defer collector.mx.Unlock()
+
+	metrics.Read(collector.samples)
+	values := make(map[string]float64, len(collector.samples))
+	result := make([]api.Metrics, 0, len(collector.samples))
+
+	for _, sample := range collector.samples {
+		name := collector.names[sample.Name]
+		switch sample.Value.Kind() {
+		case metrics.KindUint64:
+			value := sample.Value.Uint64()
+			values[sample.Name] = float64(value)
+			if collector.cumulative[sample.Name] {
+				result = append(result, api.NewCounter(name, collector.delta(sample.Name, value)))
+				continue
+			}
+			result = append(result, api.NewGauge(name, float64(value)))
+		case metrics.KindFloat64:
+			value := sample.Value.Float64()
+			values[sample.Name] = value
+			result = append(result, api.NewGauge(name, value))
+		case metrics.KindFloat64Histogram:
+			result = append(result, collector.histogram(sample.Name, name, sample.Value.Float64Histogram())...)
+		}
+	}
+
+	if collector.memStats {
+		result = append(result, memStatsCompat(values)...)
+	}
+	return result, nil
+}
+
+// метод вычисляет приращение счетчика, при первом опросе приращение равно нулю
+func (collector *RuntimeCollector) delta(name string, value uint64) int64 {
+	prev, ok := collector.lastUint[name]
+	collector.lastUint[name] = value
+	if !ok || value < prev {
+		return 0
+	}
+	return int64(value - prev)
+}
+
+// метод возвращает число событий гистограммы и перцентили событий с предыдущего опроса
+func (collector *RuntimeCollector) histogram(key, name string, hist *metrics.Float64Histogram) []api.Metrics {
+	prev := collector.lastHist[key]
+	counts := make([]uint64, len(hist.Counts))
+	var total, prevTotal uint64
+	for i, count := range hist.Counts {
+		total += count
+		counts[i] = count
+		if len(prev) == len(hist.Counts) && count >= prev[i] {
+			counts[i] = count - prev[i]
+		}
+	}
+	for _, count := range prev {
+		prevTotal += count
+	}
+	collector.lastHist[key] = append([]uint64(nil), hist.Counts...)
+
+	var delta int64
+	if prev != nil && total >= prevTotal {
+		delta = int64(total - prevTotal)
+	}
+	result := []api.Metrics{api.NewCounter(name+"_count", delta)}
+	// при первом опросе распределение считается по всем событиям с запуска
+	if prev != nil && delta == 0 {
+		return result
+	}
+	for _, quantile := range runtimeQuantiles {
+		result = append(result, api.NewGauge(name+quantile.suffix, histQuantile(counts, hist.Buckets, quantile.rank)))
+	}
+	return result
+}
+
+// функция возвращает перцентиль гистограммы по границам корзин,
+// для открытой сверху корзины используется ее нижняя граница
+func histQuantile(counts []uint64, buckets []float64, rank float64) float64 {
+	var total uint64
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	target := uint64(math.Ceil(rank * float64(total)))
+	var seen uint64
+	for i, count := range counts {
+		seen += count
+		if seen >= target {
+			upper := buckets[i+1]
+			if math.IsInf(upper, 1) {
+				return buckets[i]
+			}
+			return upper
+		}
+	}
+	return buckets[len(buckets)-1]
+}
+
+// функция вычисляет значения с именами runtime.MemStats из метрик runtime/metrics,
+// соответствие описано в документации пакета runtime/metrics
+func memStatsCompat(values map[string]float64) []api.Metrics {
+	v := func(names ...string) float64 {
+		var sum float64
+		for _, name := range names {
+			sum += values[name]
+		}
+		return sum
+	}
+	const (
+		heapObjects  = "/memory/classes/heap/objects:bytes"
+		heapUnused   = "/memory/classes/heap/unused:bytes"
+		heapFree     = "/memory/classes/heap/free:bytes"
+		heapReleased = "/memory/classes/heap/released:bytes"
+		heapStacks   = "/memory/classes/heap/stacks:bytes"
+		mspanInuse   = "/memory/classes/metadata/mspan/inuse:bytes"
+		mcacheInuse  = "/memory/classes/metadata/mcache/inuse:bytes"
+	)
+
+	var gcStats debug.GCStats
+	debug.ReadGCStats(&gcStats)
+	var lastGC float64
+	if !gcStats.LastGC.IsZero() {
+		lastGC = float64(gcStats.LastGC.UnixNano())
+	}
+	var gcCPUFraction float64
+	if total := v("/cpu/classes/total:cpu-seconds"); total != 0 {
+		gcCPUFraction = v("/cpu/classes/gc/total:cpu-seconds") / total
+	}
+
+	return []api.Metrics{
+		api.NewGauge("Alloc", v(heapObjects)),
+		api.NewGauge("BuckHashSys", v("/memory/classes/profiling/buckets:bytes")),
+		api.NewGauge("Frees", v("/gc/heap/frees:objects", "/gc/heap/tiny/allocs:objects")),
+		api.NewGauge("GCCPUFraction", gcCPUFraction),
+		api.NewGauge("GCSys", v("/memory/classes/metadata/other:bytes")),
+		api.NewGauge("HeapAlloc", v(heapObjects)),
+		api.NewGauge("HeapIdle", v(heapReleased, heapFree)),
+		api.NewGauge("HeapInuse", v(heapObjects, heapUnused)),
+		api.NewGauge("HeapObjects", v("/gc/heap/objects:objects")),
+		api.NewGauge("HeapReleased", v(heapReleased)),
+		api.NewGauge("HeapSys", v(heapObjects, heapUnused, heapFree, heapReleased)),
+		api.NewGauge("LastGC", lastGC),
+		api.NewGauge("Lookups", 0),
+		api.NewGauge("MCacheInuse", v(mcacheInuse)),
+		api.NewGauge("MCacheSys", v(mcacheInuse, "/memory/classes/metadata/mcache/free:bytes")),
+		api.NewGauge("MSpanInuse", v(mspanInuse)),
+		api.NewGauge("MSpanSys", v(mspanInuse, "/memory/classes/metadata/mspan/free:bytes")),
+		api.NewGauge("Mallocs", v("/gc/heap/allocs:objects", "/gc/heap/tiny/allocs:objects")),
+		api.NewGauge("NextGC", v("/gc/heap/goal:bytes")),
+		api.NewGauge("NumForcedGC", v("/gc/cycles/forced:gc-cycles")),
+		api.NewGauge("NumGC", v("/gc/cycles/total:gc-cycles")),
+		api.NewGauge("OtherSys", v("/memory/classes/other:bytes")),
+		api.NewGauge("PauseTotalNs", float64(gcStats.PauseTotal.Nanoseconds())),
+		api.NewGauge("StackInuse", v(heapStacks)),
+		api.NewGauge("StackSys", v(heapStacks, "/memory/classes/os-stacks:bytes")),
+		api.NewGauge("Sys", v("/memory/classes/total:bytes")),
+		api.NewGauge("TotalAlloc", v("/gc/heap/allocs:bytes")),
+	}
+}
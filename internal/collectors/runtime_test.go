@@ -0,0 +1,57 @@
+package collectors
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+func TestRuntimeMetricName(t *testing.T) {
+	assert.Equal(t, "go_gc_heap_allocs_bytes", RuntimeMetricName("/gc/heap/allocs:bytes"))
+	assert.Equal(t, "go_cpu_classes_gc_total_cpu_seconds", RuntimeMetricName("/cpu/classes/gc/total:cpu-seconds"))
+}
+
+func TestRuntimeCollector(t *testing.T) {
+	collector := NewRuntimeCollector(RuntimeConfig{Enabled: true, MemStats: true})
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	got := metricsByID(metrics)
+	assert.Equal(t, api.Gauge, got["go_sched_goroutines_goroutines"].MType)
+	assert.Equal(t, api.Counter, got["go_gc_heap_allocs_bytes"].MType)
+	assert.Equal(t, int64(0), *got["go_gc_heap_allocs_bytes"].Delta)
+	assert.Contains(t, got, "go_sched_latencies_seconds_p99")
+	// имена runtime.MemStats для совместимости
+	for _, name := range []string{"Alloc", "HeapAlloc", "TotalAlloc", "NumGC", "Sys"} {
+		assert.Equal(t, api.Gauge, got[name].MType, name)
+	}
+
+	buf := make([][]byte, 0, 100)
+	for range 100 {
+		buf = append(buf, make([]byte, 1024))
+	}
+	runtime.KeepAlive(buf)
+	runtime.GC()
+
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	got = metricsByID(metrics)
+	assert.Positive(t, *got["go_gc_heap_allocs_bytes"].Delta)
+	assert.Positive(t, *got["go_gc_cycles_total_gc_cycles"].Delta)
+}
+
+func TestHistQuantile(t *testing.T) {
+	buckets := []float64{0, 1, 2, 4, math.Inf(1)}
+	counts := []uint64{5, 3, 1, 1}
+	assert.Equal(t, 1.0, histQuantile(counts, buckets, 0.5))
+	assert.Equal(t, 4.0, histQuantile(counts, buckets, 0.9))
+	// открытая сверху корзина
+	assert.Equal(t, 4.0, histQuantile(counts, buckets, 0.99))
+	assert.Equal(t, 0.0, histQuantile([]uint64{0, 0, 0, 0}, buckets, 0.5))
+}
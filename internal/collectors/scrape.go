@@ -0,0 +1,357 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+// константы используемые сборщиком метрик с http источников
+const (
+	FormatPrometheus string        = "prometheus"
+	FormatExpvar     string        = "expvar"
+	expvarPath       string        = "/debug/vars"
+	scrapeTimeout    time.Duration = 5
+	scrapeMaxBody    int64         = 10 << 20
+	upMetric         string        = "up"
+)
+
+// ScrapeTarget описание локального http источника метрик
+type ScrapeTarget struct {
+	// Name имя источника, используется в префиксе имен метрик
+	Name string `json:"name"`
+	// URL адрес источника, допускается только localhost
+	URL string `json:"url"`
+	// Format формат ответа prometheus или expvar,
+	// если не задан определяется по пути в URL
+	Format string `json:"format,omitempty"`
+	// Prefix префикс имен метрик, по умолчанию Name + "_"
+	Prefix string `json:"prefix,omitempty"`
+	// Timeout таймаут опроса в секундах
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// Scraper сборщик метрик с http источников в формате prometheus и expvar
+type Scraper struct {
+	client *http.Client
+	// последние значения счетчиков, нужны для вычисления приращения
+	last map[string]float64
+	// дробные остатки приращений счетчиков
+	remainder map[string]float64
+	targets   []ScrapeTarget
+	mx        sync.Mutex
+}
+
+// структура для одного значения полученного от источника
+type sample struct {
+	name  string
+	mType string
+	value float64
+}
+
+// NewScraper функция создания сборщика, проверяет и дополняет описание источников
+func NewScraper(targets []ScrapeTarget) (*Scraper, error) {
+	scraper := &Scraper{
+		client:    &http.Client{},
+		last:      make(map[string]float64),
+		remainder: make(map[string]float64),
+	}
+	for _, target := range targets {
+		if len(target.Name) == 0 {
+			return nil, fmt.Errorf("scrape target %s without name", target.URL)
+		}
+		targetURL, err := url.Parse(target.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error when parse scrape url %s %w", target.URL, err)
+		}
+		if targetURL.Scheme != "http" && targetURL.Scheme != "https" {
+			return nil, fmt.Errorf("scrape target %s scheme must be http or https", target.Name)
+		}
+		if !isLocalHost(targetURL.Hostname()) {
+			return nil, fmt.Errorf("scrape target %s must be on localhost", target.Name)
+		}
+		if len(target.Format) == 0 {
+			target.Format = FormatPrometheus
+			if strings.HasSuffix(targetURL.Path, expvarPath) {
+				target.Format = FormatExpvar
+			}
+		}
+		if target.Format != FormatPrometheus && target.Format != FormatExpvar {
+			return nil, fmt.Errorf("scrape target %s unknown format %s", target.Name, target.Format)
+		}
+		if len(target.Prefix) == 0 {
+			target.Prefix = target.Name + "_"
+		}
+		if target.Timeout <= 0 {
+			target.Timeout = int(scrapeTimeout)
+		}
+		scraper.targets = append(scraper.targets, target)
+	}
+	return scraper, nil
+}
+
+// функция проверяет что хост является localhost
+func isLocalHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Name метод возвращает имя сборщика
+func (scraper *Scraper) Name() string {
+	return "scrape"
+}
+
+// Collect метод опрашивает все источники, для каждого источника
+// добавляется метрика up со значением 1 при успешном опросе и 0 при ошибке
+func (scraper *Scraper) Collect(ctx context.Context) ([]api.Metrics, error) {
+	var metrics []api.Metrics
+	var errs []error
+
+	for _, target := range scraper.targets {
+		up := float64(1)
+		samples, err := scraper.scrape(ctx, target)
+		if err != nil {
+			up = 0
+			errs = append(errs, fmt.Errorf("error when scrape %s %w", target.Name, err))
+		}
+		for _, s := range samples {
+			name := api.SanitizeName(target.Prefix + s.name)
+			if s.mType == api.Counter {
+				metrics = append(metrics, api.NewCounter(name, scraper.counterDelta(name, s.value)))
+				continue
+			}
+			metrics = append(metrics, api.NewGauge(name, s.value))
+		}
+		metrics = append(metrics, api.NewGauge(api.SanitizeName(target.Prefix+upMetric), up))
+	}
+	return metrics, errors.Join(errs...)
+}
+
+// метод вычисляет приращение счетчика с момента предыдущего опроса,
+// при первом опросе значение запоминается и приращение равно нулю.
+// Дробная часть приращения переносится на следующий опрос.
+func (scraper *Scraper) counterDelta(name string, value float64) int64 {
+	scraper.mx.Lock()
+	defer scraper.mx.Unlock()
+
+	prev, ok := scraper.last[name]
+	scraper.last[name] = value
+	var delta float64
+	switch {
+	case !ok:
+		return 0
+	case value < prev:
+		// счетчик был сброшен
+		delta = value
+	default:
+		delta = value - prev
+	}
+	delta += scraper.remainder[name]
+	whole := math.Trunc(delta)
+	scraper.remainder[name] = delta - whole
+	return int64(whole)
+}
+
+// метод для опроса одного источника
+func (scraper *Scraper) scrape(ctx context.Context, target ScrapeTarget) ([]sample, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(target.Timeout)*time.Second)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error when create request %w", err)
+	}
+	response, err := scraper.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error when do request %w", err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.New(response.Status)
+	}
+
+	body := io.LimitReader(response.Body, scrapeMaxBody)
+	if target.Format == FormatExpvar {
+		return parseExpvar(body)
+	}
+	return parsePrometheus(body)
+}
+
+// функция для разбора ответа в текстовом формате prometheus
+func parsePrometheus(r io.Reader) ([]sample, error) {
+	var samples []sample
+	types := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		name, labels, rest, err := splitPromSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d %w", lineNum, err)
+		}
+		valueFields := strings.Fields(rest)
+		if len(valueFields) == 0 {
+			return nil, fmt.Errorf("line %d sample %s without value", lineNum, name)
+		}
+		value, err := strconv.ParseFloat(valueFields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d wrong value %w", lineNum, err)
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		mType, ok := promSampleType(name, types)
+		if !ok {
+			continue
+		}
+		samples = append(samples, sample{name: name + labels, mType: mType, value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error when read response %w", err)
+	}
+	return samples, nil
+}
+
+// функция определяет тип метрики для значения по объявлению # TYPE,
+// возвращает false если значение нужно пропустить
+func promSampleType(name string, types map[string]string) (string, bool) {
+	if family, ok := types[name]; ok {
+		if family == "counter" {
+			return api.Counter, true
+		}
+		return api.Gauge, true
+	}
+	for _, suffix := range []string{"_bucket", "_count", "_sum", "_total", "_created"} {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		family, ok := types[strings.TrimSuffix(name, suffix)]
+		if !ok {
+			continue
+		}
+		switch {
+		case suffix == "_created":
+			// время создания счетчика не является метрикой
+			return "", false
+		case family == "counter", suffix == "_bucket", suffix == "_count":
+			return api.Counter, true
+		default:
+			return api.Gauge, true
+		}
+	}
+	return api.Gauge, true
+}
+
+// функция разделяет строку на имя, метки и оставшуюся часть,
+// метки сортируются и переводятся в суффикс имени вида _label_value
+func splitPromSample(line string) (string, string, string, error) {
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return "", "", "", fmt.Errorf("wrong sample %q", line)
+	}
+	name := line[:end]
+	if line[end] != '{' {
+		return name, "", line[end:], nil
+	}
+
+	var pairs []string
+	rest := line[end+1:]
+	for {
+		rest = strings.TrimLeft(rest, " \t,")
+		if strings.HasPrefix(rest, "}") {
+			rest = rest[1:]
+			break
+		}
+		eq := strings.Index(rest, "=")
+		if eq <= 0 || len(rest) < eq+2 || rest[eq+1] != '"' {
+			return "", "", "", fmt.Errorf("wrong labels in %q", line)
+		}
+		key := strings.TrimSpace(rest[:eq])
+		rest = rest[eq+2:]
+
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(rest); i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+				value.WriteByte(rest[i])
+				continue
+			}
+			if rest[i] == '"' {
+				rest = rest[i+1:]
+				closed = true
+				break
+			}
+			value.WriteByte(rest[i])
+		}
+		if !closed {
+			return "", "", "", fmt.Errorf("unterminated label value in %q", line)
+		}
+		pairs = append(pairs, key+"_"+value.String())
+	}
+	sort.Strings(pairs)
+
+	var labels string
+	for _, pair := range pairs {
+		labels += "_" + pair
+	}
+	return name, labels, rest, nil
+}
+
+// функция для разбора ответа expvar, числовые значения вложенных
+// объектов превращаются в gauge с именем из пути через подчеркивание
+func parseExpvar(r io.Reader) ([]sample, error) {
+	var vars map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&vars); err != nil {
+		return nil, fmt.Errorf("error when decode expvar %w", err)
+	}
+	var samples []sample
+	flattenExpvar("", vars, &samples)
+	return samples, nil
+}
+
+func flattenExpvar(path string, value interface{}, samples *[]sample) {
+	switch value := value.(type) {
+	case float64:
+		*samples = append(*samples, sample{name: path, mType: api.Gauge, value: value})
+	case map[string]interface{}:
+		for key, nested := range value {
+			if len(path) != 0 {
+				key = path + "_" + key
+			}
+			flattenExpvar(key, nested, samples)
+		}
+	}
+}
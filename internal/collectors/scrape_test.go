@@ -0,0 +1,125 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+const promText = `# HELP http_requests_total Total requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{code="400",method="post"} 3
+# TYPE goroutines gauge
+goroutines 12
+# TYPE rpc_duration_seconds histogram
+rpc_duration_seconds_bucket{le="+Inf"} 7
+rpc_duration_seconds_sum 1.5
+rpc_duration_seconds_count 7
+# TYPE nan_value gauge
+nan_value NaN
+`
+
+func metricsByID(metrics []api.Metrics) map[string]api.Metrics {
+	result := make(map[string]api.Metrics, len(metrics))
+	for _, metric := range metrics {
+		result[metric.ID] = metric
+	}
+	return result
+}
+
+func TestParsePrometheus(t *testing.T) {
+	samples, err := parsePrometheus(strings.NewReader(promText))
+	require.NoError(t, err)
+
+	got := make(map[string]sample, len(samples))
+	for _, s := range samples {
+		got[s.name] = s
+	}
+
+	tests := []struct {
+		name  string
+		mType string
+		value float64
+	}{
+		{name: "http_requests_total_code_200_method_post", mType: api.Counter, value: 1027},
+		{name: "http_requests_total_code_400_method_post", mType: api.Counter, value: 3},
+		{name: "goroutines", mType: api.Gauge, value: 12},
+		{name: "rpc_duration_seconds_bucket_le_+Inf", mType: api.Counter, value: 7},
+		{name: "rpc_duration_seconds_sum", mType: api.Gauge, value: 1.5},
+		{name: "rpc_duration_seconds_count", mType: api.Counter, value: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ok := got[tt.name]
+			require.True(t, ok, "sample not found")
+			assert.Equal(t, tt.mType, s.mType)
+			assert.Equal(t, tt.value, s.value)
+		})
+	}
+	assert.Len(t, samples, len(tests), "NaN sample must be skipped")
+}
+
+func TestScraperCollect(t *testing.T) {
+	hits := 5
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metrics":
+			hits += 5
+			_, _ = fmt.Fprintf(w, "# TYPE hits counter\nhits %d\n", hits)
+		case "/debug/vars":
+			_, _ = w.Write([]byte(`{"cmdline":["app"],"memstats":{"Alloc":1024,"BySize":[1,2]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	scraper, err := NewScraper([]ScrapeTarget{
+		{Name: "prom", URL: srv.URL + "/metrics"},
+		{Name: "vars", URL: srv.URL + "/debug/vars"},
+		{Name: "down", URL: srv.URL + "/missing"},
+	})
+	require.NoError(t, err)
+
+	metrics, err := scraper.Collect(context.Background())
+	assert.Error(t, err, "missing target must return error")
+	got := metricsByID(metrics)
+
+	assert.Equal(t, int64(0), *got["prom_hits"].Delta, "first scrape is a baseline")
+	assert.Equal(t, float64(1024), *got["vars_memstats_Alloc"].Value)
+	assert.Equal(t, float64(1), *got["prom_up"].Value)
+	assert.Equal(t, float64(1), *got["vars_up"].Value)
+	assert.Equal(t, float64(0), *got["down_up"].Value)
+
+	metrics, _ = scraper.Collect(context.Background())
+	got = metricsByID(metrics)
+	assert.Equal(t, int64(5), *got["prom_hits"].Delta)
+}
+
+func TestScraperCounterDelta(t *testing.T) {
+	scraper, err := NewScraper(nil)
+	require.NoError(t, err)
+
+	// дробные приращения накапливаются и не теряются
+	var total int64
+	for _, value := range []float64{0.5, 0.75, 1.25, 1.5, 2, 2.5} {
+		total += scraper.counterDelta("seconds", value)
+	}
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, int64(0), scraper.counterDelta("seconds", 2.75))
+	assert.Equal(t, int64(1), scraper.counterDelta("seconds", 3.5))
+}
+
+func TestNewScraperRejectsRemote(t *testing.T) {
+	_, err := NewScraper([]ScrapeTarget{{Name: "remote", URL: "http://example.com/metrics"}})
+	assert.Error(t, err)
+}
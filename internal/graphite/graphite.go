@@ -0,0 +1,154 @@
+// Package graphite - пакет приема метрик в формате Graphite plaintext по TCP и UDP
+package graphite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+// ссылка на сегмент пути в имени метрики правила
+var segmentRef = regexp.MustCompile(`\$(\d+)`)
+
+// Config правила преобразования путей graphite в имена метрик
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule правило преобразования пути. Match шаблон пути, сегменты разделяются
+// точкой и сравниваются по одному (`*`, `?`, `[...]`), число сегментов должно совпадать.
+// Name имя метрики, $N заменяется на N-й сегмент пути (с 1).
+// Type тип метрики gauge или counter, по умолчанию gauge.
+// Drop отбрасывает подходящие метрики.
+type Rule struct {
+	Match string `json:"match"`
+	Name  string `json:"name,omitempty"`
+	Type  string `json:"type,omitempty"`
+	Drop  bool   `json:"drop,omitempty"`
+}
+
+// LoadConfig функция читает правила преобразования из файла формата json
+func LoadConfig(filename string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Config{}, fmt.Errorf("error when read graphite rules file %w", err)
+	}
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return Config{}, fmt.Errorf("error when unmarshal graphite rules file %w", err)
+	}
+	err = cfg.Validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("error in graphite rules file %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate метод проверяет правила преобразования
+func (cfg Config) Validate() error {
+	for _, rule := range cfg.Rules {
+		if len(rule.Match) == 0 {
+			return errors.New("rule must have match")
+		}
+		segments := strings.Split(rule.Match, ".")
+		for _, segment := range segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("rule %q: wrong pattern %w", rule.Match, err)
+			}
+		}
+		if rule.Drop {
+			continue
+		}
+		switch rule.Type {
+		case "", api.Gauge, api.Counter:
+		default:
+			return fmt.Errorf("rule %q: wrong metric type %q", rule.Match, rule.Type)
+		}
+		for _, ref := range segmentRef.FindAllStringSubmatch(rule.Name, -1) {
+			index, _ := strconv.Atoi(ref[1])
+			if index < 1 || index > len(segments) {
+				return fmt.Errorf("rule %q: segment %s out of range", rule.Match, ref[0])
+			}
+		}
+	}
+	return nil
+}
+
+// метод возвращает имя и тип метрики для пути, false если метрика отбрасывается.
+// Используется первое подходящее правило, если правил нет точки заменяются на `_`
+func (cfg Config) mapPath(metricPath string) (string, string, bool) {
+	segments := strings.Split(metricPath, ".")
+	for _, rule := range cfg.Rules {
+		if !rule.match(segments) {
+			continue
+		}
+		if rule.Drop {
+			return "", "", false
+		}
+		metricType := rule.Type
+		if len(metricType) == 0 {
+			metricType = api.Gauge
+		}
+		name := metricPath
+		if len(rule.Name) != 0 {
+			name = segmentRef.ReplaceAllStringFunc(rule.Name, func(ref string) string {
+				index, _ := strconv.Atoi(ref[1:])
+				return segments[index-1]
+			})
+		}
+		return api.SanitizeName(name), metricType, true
+	}
+	return api.SanitizeName(metricPath), api.Gauge, true
+}
+
+func (rule Rule) match(segments []string) bool {
+	patterns := strings.Split(rule.Match, ".")
+	if len(patterns) != len(segments) {
+		return false
+	}
+	for i, pattern := range patterns {
+		if ok, _ := path.Match(pattern, segments[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// метод разбирает строку вида `path value [timestamp]` в метрику,
+// метка времени проверяется, но не сохраняется
+func (cfg Config) parseLine(line string) (api.Metrics, bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return api.Metrics{}, false, fmt.Errorf("wrong line %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return api.Metrics{}, false, fmt.Errorf("wrong value %q", fields[1])
+	}
+	if len(fields) == 3 {
+		if _, err = strconv.ParseFloat(fields[2], 64); err != nil {
+			return api.Metrics{}, false, fmt.Errorf("wrong timestamp %q", fields[2])
+		}
+	}
+
+	name, metricType, ok := cfg.mapPath(fields[0])
+	if !ok {
+		return api.Metrics{}, false, nil
+	}
+	if metricType == api.Counter {
+		if value != math.Trunc(value) {
+			return api.Metrics{}, false, fmt.Errorf("counter %s value %q is not integer", name, fields[1])
+		}
+		return api.NewCounter(name, int64(value)), true, nil
+	}
+	return api.NewGauge(name, value), true, nil
+}
@@ -0,0 +1,152 @@
+package graphite
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/clientlimit"
+	"github.com/netzen86/collectmetrics/internal/repositories/memstorage"
+)
+
+func TestParseLine(t *testing.T) {
+	cfg := Config{Rules: []Rule{
+		{Match: "collectd.*.cpu-*.cpu-idle", Drop: true},
+		{Match: "collectd.*.cpu-*.*", Name: "cpu_$4_host_$2_$3"},
+		{Match: "app.*.requests", Name: "$2_requests", Type: api.Counter},
+	}}
+	require.NoError(t, cfg.Validate())
+
+	tests := []struct {
+		line   string
+		metric api.Metrics
+		stored bool
+		err    bool
+	}{
+		{line: "collectd.web1.cpu-0.cpu-user 12.5 1700000000", stored: true,
+			metric: api.Metrics{ID: "cpu_cpu_user_host_web1_cpu_0", MType: api.Gauge}},
+		{line: "collectd.web1.cpu-0.cpu-idle 80 1700000000"},
+		{line: "app.billing.requests 3 -1", stored: true,
+			metric: api.Metrics{ID: "billing_requests", MType: api.Counter}},
+		{line: "app.billing.requests 3.5 1700000000", err: true},
+		{line: "servers.db-1.load 0.7", stored: true,
+			metric: api.Metrics{ID: "servers_db_1_load", MType: api.Gauge}},
+		{line: "servers.load abc 1700000000", err: true},
+		{line: "servers.load", err: true},
+		{line: "servers.load 1 now", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			metric, stored, err := cfg.parseLine(tt.line)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.stored, stored)
+			assert.Equal(t, tt.metric.ID, metric.ID)
+			assert.Equal(t, tt.metric.MType, metric.MType)
+		})
+	}
+
+	assert.Error(t, Config{Rules: []Rule{{Match: "a.*", Name: "$3"}}}.Validate())
+	assert.Error(t, Config{Rules: []Rule{{Match: "a.[", Name: "b"}}}.Validate())
+	assert.Error(t, Config{Rules: []Rule{{Match: "a", Type: "histogram"}}}.Validate())
+}
+
+func TestListener(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	storage := memstorage.NewMemStorage()
+	listener := NewListener("127.0.0.1:0", Config{Rules: []Rule{
+		{Match: "*.hits", Type: api.Counter},
+	}}, netip.MustParsePrefix("127.0.0.0/8"), nil, storage, logger)
+	require.NoError(t, listener.Start(context.Background()))
+	defer listener.Stop()
+	address := listener.tcp.Addr().String()
+
+	tcp, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	_, err = fmt.Fprint(tcp, "web.hits 2 1700000000\nweb.load 1.5 1700000000\nbroken\n")
+	require.NoError(t, err)
+	require.NoError(t, tcp.Close())
+
+	udp, err := net.Dial("udp", address)
+	require.NoError(t, err)
+	_, err = fmt.Fprint(udp, "web.hits 3 1700000000\nweb.temp 36.6 1700000000")
+	require.NoError(t, err)
+	require.NoError(t, udp.Close())
+
+	assert.Eventually(t, func() bool {
+		hits, errHits := storage.GetCounterMetric(context.Background(), "web_hits", logger)
+		temp, errTemp := storage.GetGaugeMetric(context.Background(), "web_temp", logger)
+		load, errLoad := storage.GetGaugeMetric(context.Background(), "web_load", logger)
+		return errHits == nil && errTemp == nil && errLoad == nil &&
+			hits == 5 && temp == 36.6 && load == 1.5
+	}, 2*time.Second, 10*time.Millisecond)
+
+	listener.Stop()
+	_, err = net.Dial("tcp", address)
+	assert.Error(t, err)
+	// повторная остановка и nil приемник безопасны
+	listener.Stop()
+	var none *Listener
+	none.Stop()
+}
+
+func TestListenerAccess(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	send := func(listener *Listener, data string) {
+		udp, err := net.Dial("udp", listener.udp.LocalAddr().String())
+		require.NoError(t, err)
+		_, err = fmt.Fprint(udp, data)
+		require.NoError(t, err)
+		require.NoError(t, udp.Close())
+	}
+
+	t.Run("untrusted subnet", func(t *testing.T) {
+		storage := memstorage.NewMemStorage()
+		listener := NewListener("127.0.0.1:0", Config{}, netip.MustParsePrefix("10.0.0.0/8"), nil, storage, logger)
+		require.NoError(t, listener.Start(context.Background()))
+		defer listener.Stop()
+
+		tcp, err := net.Dial("tcp", listener.tcp.Addr().String())
+		require.NoError(t, err)
+		_, _ = fmt.Fprint(tcp, "web.load 1 1700000000\n")
+		// соединение закрывается сервером без чтения данных
+		require.NoError(t, tcp.SetReadDeadline(time.Now().Add(2*time.Second)))
+		_, err = tcp.Read(make([]byte, 1))
+		assert.Error(t, err)
+		require.NoError(t, tcp.Close())
+		send(listener, "web.temp 1 1700000000")
+
+		listener.Stop()
+		_, err = storage.GetGaugeMetric(context.Background(), "web_load", logger)
+		assert.Error(t, err)
+		_, err = storage.GetGaugeMetric(context.Background(), "web_temp", logger)
+		assert.Error(t, err)
+	})
+
+	t.Run("client limits", func(t *testing.T) {
+		storage := memstorage.NewMemStorage()
+		limiter := clientlimit.NewLimiter(clientlimit.Config{MaxMetrics: 1})
+		listener := NewListener("127.0.0.1:0", Config{}, netip.Prefix{}, limiter, storage, logger)
+		require.NoError(t, listener.Start(context.Background()))
+		defer listener.Stop()
+
+		send(listener, "web.load 1 1700000000\nweb.temp 2 1700000000\nweb.load 3 1700000000")
+		assert.Eventually(t, func() bool {
+			load, err := storage.GetGaugeMetric(context.Background(), "web_load", logger)
+			return err == nil && load == 3
+		}, 2*time.Second, 10*time.Millisecond)
+		_, err := storage.GetGaugeMetric(context.Background(), "web_temp", logger)
+		assert.Error(t, err)
+	})
+}
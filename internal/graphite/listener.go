@@ -0,0 +1,232 @@
+package graphite
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/audit"
+	"github.com/netzen86/collectmetrics/internal/clientlimit"
+	"github.com/netzen86/collectmetrics/internal/repositories"
+	"github.com/netzen86/collectmetrics/internal/repositories/files"
+)
+
+const (
+	// максимальный размер датаграммы UDP
+	maxDatagram int = 65535
+	// соединение TCP без данных закрывается через это время
+	idleTimeout time.Duration = 5 * time.Minute
+)
+
+// Listener принимает метрики graphite по TCP и UDP на одном адресе.
+// Доверенная сеть и ограничения клиента проверяются по адресу источника,
+// проверки токенов нет, поэтому при включенной авторизации приемник не запускается.
+type Listener struct {
+	storage repositories.Repo
+	ctx     context.Context
+	tcp     net.Listener
+	udp     net.PacketConn
+	conns   map[net.Conn]struct{}
+	limiter *clientlimit.Limiter
+	wg      sync.WaitGroup
+	logger  zap.SugaredLogger
+	address string
+	cfg     Config
+	trusted netip.Prefix
+	mx      sync.Mutex
+	closed  bool
+}
+
+// NewListener функция создания приемника метрик graphite, пустая сеть trusted
+// и nil limiter отключают проверки
+func NewListener(address string, cfg Config, trusted netip.Prefix, limiter *clientlimit.Limiter,
+	storage repositories.Repo, logger zap.SugaredLogger) *Listener {
+	return &Listener{
+		storage: storage,
+		conns:   make(map[net.Conn]struct{}),
+		limiter: limiter,
+		logger:  logger,
+		address: address,
+		cfg:     cfg,
+		trusted: trusted,
+	}
+}
+
+// Start метод открывает TCP и UDP порты и запускает прием метрик
+func (listener *Listener) Start(ctx context.Context) error {
+	var err error
+	listener.tcp, err = net.Listen("tcp", listener.address)
+	if err != nil {
+		return fmt.Errorf("error when listen graphite tcp %w", err)
+	}
+	listener.udp, err = net.ListenPacket("udp", listener.tcp.Addr().String())
+	if err != nil {
+		listener.tcp.Close()
+		return fmt.Errorf("error when listen graphite udp %w", err)
+	}
+	listener.ctx = ctx
+
+	listener.wg.Add(2)
+	go listener.serveTCP()
+	go listener.serveUDP()
+	listener.logger.Infof("graphite listener started on %s", listener.tcp.Addr())
+	return nil
+}
+
+// Stop метод закрывает порты и соединения и ждет завершения обработки,
+// для nil или незапущенного приемника ничего не делает
+func (listener *Listener) Stop() {
+	if listener == nil || listener.tcp == nil {
+		return
+	}
+	listener.tcp.Close()
+	listener.udp.Close()
+	listener.mx.Lock()
+	listener.closed = true
+	for conn := range listener.conns {
+		conn.Close()
+	}
+	listener.mx.Unlock()
+	listener.wg.Wait()
+	listener.logger.Info("graphite listener stopped")
+}
+
+func (listener *Listener) serveTCP() {
+	defer listener.wg.Done()
+	for {
+		conn, err := listener.tcp.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				listener.logger.Warnf("error when accept graphite connection %v", err)
+				continue
+			}
+			return
+		}
+		if !listener.allowed(conn.RemoteAddr()) {
+			listener.logger.Warnf("graphite connection from untrusted %s", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		// соединение принятое во время остановки сразу закрывается
+		listener.mx.Lock()
+		if listener.closed {
+			listener.mx.Unlock()
+			conn.Close()
+			continue
+		}
+		listener.conns[conn] = struct{}{}
+		listener.wg.Add(1)
+		listener.mx.Unlock()
+		go listener.handleConn(conn)
+	}
+}
+
+func (listener *Listener) handleConn(conn net.Conn) {
+	defer listener.wg.Done()
+	defer func() {
+		listener.mx.Lock()
+		delete(listener.conns, conn)
+		listener.mx.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for {
+		err := conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		if err != nil || !scanner.Scan() {
+			return
+		}
+		listener.handleLine(scanner.Text(), conn.RemoteAddr())
+	}
+}
+
+func (listener *Listener) serveUDP() {
+	defer listener.wg.Done()
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := listener.udp.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				listener.logger.Warnf("error when read graphite datagram %v", err)
+				continue
+			}
+			return
+		}
+		if !listener.allowed(addr) {
+			listener.logger.Warnf("graphite datagram from untrusted %s", addr)
+			continue
+		}
+		for _, line := range bytes.Split(buf[:n], []byte("\n")) {
+			listener.handleLine(string(line), addr)
+		}
+	}
+}
+
+// метод проверяет что адрес источника входит в доверенную сеть
+func (listener *Listener) allowed(addr net.Addr) bool {
+	if !listener.trusted.IsValid() {
+		return true
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	return err == nil && listener.trusted.Contains(addrPort.Addr().Unmap())
+}
+
+// метод разбирает строку и сохраняет метрику в хранилище, ошибки и превышение
+// ограничений клиента пишутся в лог и не прерывают прием
+func (listener *Listener) handleLine(line string, addr net.Addr) {
+	line = strings.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+	metric, ok, err := listener.cfg.parseLine(line)
+	if err != nil {
+		listener.logger.Warnf("error when parse graphite line from %s %v", addr, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	host, _, splitErr := net.SplitHostPort(addr.String())
+	if splitErr != nil {
+		host = addr.String()
+	}
+	// каждая строка считается отдельным запросом клиента
+	if allow, _ := listener.limiter.Allow(host); !allow {
+		listener.logger.Warnf("graphite metric %s from %s dropped, rate limit exceeded", metric.ID, host)
+		return
+	}
+	err = listener.limiter.AllowMetrics(host, metric.MType+"/"+metric.ID)
+	if err != nil {
+		listener.logger.Warnf("graphite metric %s from %s dropped %v", metric.ID, host, err)
+		return
+	}
+
+	// для файлового хранилища значения counter нужно складывать
+	_, cntSummed := repositories.Unwrap(listener.storage).(*files.Filestorage)
+	var value any
+	switch metric.MType {
+	case api.Counter:
+		value = *metric.Delta
+	default:
+		value = *metric.Value
+	}
+	ctx := audit.WithRequest(listener.ctx, audit.Request{
+		Client:    host,
+		Transport: audit.TransportGraphite,
+		Endpoint:  addr.Network(),
+	})
+	err = listener.storage.UpdateParam(ctx, cntSummed, metric.MType, metric.ID, value, listener.logger)
+	if err != nil {
+		listener.logger.Warnf("error when update graphite metric %s %v", metric.ID, err)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/audit"
+)
+
+// ограничения числа записей журнала аудита в ответе
+const (
+	auditLimitDef int = 100
+	auditLimitMax int = 1000
+)
+
+// функция возвращает сведения о запросе для журнала аудита
+func auditRequest(r *http.Request, transport string) audit.Request {
+	return audit.Request{
+		Client:    ClientKey(r),
+		Agent:     r.Header.Get(api.ACLHeader),
+		Transport: transport,
+		Endpoint:  r.URL.Path,
+	}
+}
+
+// AuditHandle хэндлер возвращает записи журнала аудита (GET /audit).
+// Параметры выборки: client, transport, type, id, since и until в формате RFC3339, limit
+func AuditHandle(log audit.Log, srvlog zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if log == nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusNotFound),
+				"audit log disabled"), http.StatusNotFound)
+			return
+		}
+
+		filter, err := auditFilter(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusBadRequest), err),
+				http.StatusBadRequest)
+			return
+		}
+
+		entries, err := log.Query(r.Context(), filter)
+		if err != nil {
+			srvlog.Warnf("error when query audit log %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+		if entries == nil {
+			entries = []audit.Entry{}
+		}
+		resp, err := json.Marshal(entries)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", api.Js)
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(resp)
+		if err != nil {
+			srvlog.Warnf("error when write audit response %v", err)
+		}
+	}
+}
+
+// функция разбирает параметры выборки записей журнала аудита
+func auditFilter(r *http.Request) (audit.Filter, error) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Client:    query.Get("client"),
+		Transport: query.Get("transport"),
+		MType:     query.Get("type"),
+		ID:        query.Get("id"),
+		Limit:     auditLimitDef,
+	}
+	var err error
+	if since := query.Get("since"); len(since) != 0 {
+		filter.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			return audit.Filter{}, fmt.Errorf("wrong since %q", since)
+		}
+	}
+	if until := query.Get("until"); len(until) != 0 {
+		filter.Until, err = time.Parse(time.RFC3339, until)
+		if err != nil {
+			return audit.Filter{}, fmt.Errorf("wrong until %q", until)
+		}
+	}
+	if limit := query.Get("limit"); len(limit) != 0 {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit <= 0 || filter.Limit > auditLimitMax {
+			return audit.Filter{}, fmt.Errorf("limit must be from 1 to %d", auditLimitMax)
+		}
+	}
+	return filter, nil
+}
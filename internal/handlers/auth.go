@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/auth"
+)
+
+// тело запроса создания токена
+type tokenRequest struct {
+	Name     string   `json:"name"`
+	Roles    []string `json:"roles"`
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+// ответ на создание токена, значение токена возвращается один раз
+type tokenResponse struct {
+	Secret string `json:"token"`
+	auth.Token
+}
+
+// Authorize функция проверяет токен из заголовка Authorization и его роль,
+// без токена отвечает 401, без роли 403. Токен сохраняется в контексте запроса
+// для проверки префиксов метрик в хэндлерах. Если хранилище токенов nil проверки нет.
+func Authorize(store *auth.Store, role auth.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if store == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secret, ok := auth.BearerToken(r.Header.Get("Authorization"))
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			token, err := store.Authenticate(secret)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			if !token.HasRole(role) {
+				http.Error(w, fmt.Sprintf("%s role %s required\n", http.StatusText(http.StatusForbidden), role),
+					http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithToken(r.Context(), token)))
+		})
+	}
+}
+
+// TokensListHandle хэндлер возвращает описания токенов без хэшей
+func TokensListHandle(store *auth.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusNotFound),
+				"token auth disabled"), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, store.List())
+	}
+}
+
+// TokenCreateHandle хэндлер создает токен, в теле имя, роли и префиксы метрик
+func TokenCreateHandle(store *auth.Store, srvlog zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusNotFound),
+				"token auth disabled"), http.StatusNotFound)
+			return
+		}
+		var request tokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusBadRequest),
+				"decode token request error"), http.StatusBadRequest)
+			return
+		}
+		roles := make([]auth.Role, 0, len(request.Roles))
+		for _, name := range request.Roles {
+			role, err := auth.ParseRole(name)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusBadRequest), err),
+					http.StatusBadRequest)
+				return
+			}
+			roles = append(roles, role)
+		}
+		if len(roles) == 0 {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusBadRequest),
+				"token needs at least one role"), http.StatusBadRequest)
+			return
+		}
+
+		secret, token, err := store.Create(request.Name, roles, request.Prefixes)
+		if err != nil {
+			srvlog.Errorf("error when create token %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+		token.Hash = ""
+		srvlog.Infof("token %s %q created with roles %v", token.ID, token.Name, token.Roles)
+		writeJSON(w, http.StatusCreated, tokenResponse{Secret: secret, Token: token})
+	}
+}
+
+// TokenRevokeHandle хэндлер отзывает токен по идентификатору
+func TokenRevokeHandle(store *auth.Store, srvlog zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		err := store.Revoke(id)
+		switch {
+		case errors.Is(err, auth.ErrNotFound):
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		case err != nil:
+			srvlog.Errorf("error when revoke token %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+		srvlog.Infof("token %s revoked", id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// функция отправляет ответ в формате json
+func writeJSON(w http.ResponseWriter, code int, data any) {
+	resp, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", api.Js)
+	w.WriteHeader(code)
+	_, _ = w.Write(resp)
+}
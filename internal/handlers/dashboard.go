@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/auth"
+	"github.com/netzen86/collectmetrics/internal/repositories"
+	"github.com/netzen86/collectmetrics/internal/utils"
+	"github.com/netzen86/collectmetrics/web"
+)
+
+// шаблоны страниц дашборда встроены в бинарный файл
+var dashboardTemplates = template.Must(template.ParseFS(web.FS, "template/*.html"))
+
+// строка таблицы дашборда
+type dashboardRow struct {
+	ID      string  `json:"id"`
+	Type    string  `json:"type"`
+	Value   string  `json:"value"`
+	Updated string  `json:"updated,omitempty"`
+	Number  float64 `json:"number"`
+}
+
+// функция возвращает метрики хранилища для дашборда отсортированные по имени,
+// если заданы тип и имя возвращается только эта метрика
+func dashboardRows(r *http.Request, storage repositories.Repo,
+	mType, mName string, srvlog zap.SugaredLogger) ([]dashboardRow, error) {
+	metrics, err := storage.GetAllMetrics(r.Context(), srvlog)
+	if err != nil {
+		return nil, fmt.Errorf("error when getting all metrics %w", err)
+	}
+	tracked, _ := storage.(*repositories.Tracked)
+
+	rows := make([]dashboardRow, 0, len(metrics.Metrics))
+	for _, metric := range metrics.Metrics {
+		if len(mName) != 0 && (metric.ID != mName || metric.MType != mType) {
+			continue
+		}
+		// метрики вне префиксов токена не показываются
+		if !auth.AllowedMetric(r.Context(), metric.ID) {
+			continue
+		}
+		row := dashboardRow{ID: metric.ID, Type: metric.MType}
+		switch {
+		case metric.Value != nil:
+			row.Number = *metric.Value
+			row.Value = strconv.FormatFloat(*metric.Value, 'g', -1, 64)
+		case metric.Delta != nil:
+			row.Number = float64(*metric.Delta)
+			row.Value = strconv.FormatInt(*metric.Delta, 10)
+		}
+		if tracked != nil {
+			if updated := tracked.LastUpdate(metric.MType, metric.ID); !updated.IsZero() {
+				row.Updated = updated.Format(time.RFC3339)
+			}
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+	return rows, nil
+}
+
+// функция выполняет шаблон и отправляет страницу с компрессией
+func renderPage(w http.ResponseWriter, r *http.Request, name string, data any) {
+	var buf bytes.Buffer
+	err := dashboardTemplates.ExecuteTemplate(&buf, name, data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%v %v\n",
+			http.StatusText(http.StatusInternalServerError), err),
+			http.StatusInternalServerError)
+		return
+	}
+	page, err := utils.CoHTTP(buf.Bytes(), r, w)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", api.HTML)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(page)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+// RetrieveMHandle функция выводит таблицу метрик хранящихся в хранилище
+func RetrieveMHandle(storage repositories.Repo, srvlog zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := dashboardRows(r, storage, "", "", srvlog)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+		renderPage(w, r, "metrics.html", rows)
+	}
+}
+
+// MetricPageHandle функция выводит страницу метрики с графиком
+func MetricPageHandle(storage repositories.Repo, srvlog zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := dashboardRows(r, storage, chi.URLParam(r, "mType"), chi.URLParam(r, "mName"), srvlog)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+		if len(rows) == 0 {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		renderPage(w, r, "metric.html", rows[0])
+	}
+}
+
+// DashboardDataHandle функция возвращает метрики для обновления дашборда в формате json,
+// параметры type и name выбирают одну метрику
+func DashboardDataHandle(storage repositories.Repo, srvlog zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := dashboardRows(r, storage, r.URL.Query().Get("type"), r.URL.Query().Get("name"), srvlog)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+		resp, err := json.Marshal(rows)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", api.Js)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(resp)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// StaticHandle функция отдает встроенные статические файлы дашборда
+func StaticHandle() http.Handler {
+	// путь задан константой, ошибки быть не может
+	static, _ := fs.Sub(web.FS, "static")
+	return http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+}
@@ -10,17 +10,21 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-	"text/template"
-	"time"
 
 	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
+	"github.com/netzen86/collectmetrics/internal/alerts"
 	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/audit"
+	"github.com/netzen86/collectmetrics/internal/auth"
+	"github.com/netzen86/collectmetrics/internal/clientlimit"
 	"github.com/netzen86/collectmetrics/internal/repositories"
 	"github.com/netzen86/collectmetrics/internal/repositories/db"
 	"github.com/netzen86/collectmetrics/internal/repositories/files"
 	"github.com/netzen86/collectmetrics/internal/security"
+	"github.com/netzen86/collectmetrics/internal/tracing"
 	"github.com/netzen86/collectmetrics/internal/utils"
 )
 
@@ -30,7 +34,7 @@ func UpdateMHandle(storage repositories.Repo, srvlog zap.SugaredLogger) http.Han
 
 		// если тип хранилища файлсторэж то
 		// необходимо суммировать метрики типа counter
-		_, cntSummed := storage.(*files.Filestorage)
+		_, cntSummed := repositories.Unwrap(storage).(*files.Filestorage)
 
 		mType := chi.URLParam(r, "mType")
 		if mType != api.Counter && mType != api.Gauge {
@@ -41,9 +45,26 @@ func UpdateMHandle(storage repositories.Repo, srvlog zap.SugaredLogger) http.Han
 		mName := chi.URLParam(r, "mName")
 		mValue := chi.URLParam(r, "mValue")
 
+		// проверяем доступ токена к метрике
+		if err := auth.CheckMetrics(r.Context(), mName); err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusForbidden), err), http.StatusForbidden)
+			return
+		}
+		// проверяем значение до учета метрики в ограничении клиента
+		if err := checkValue(mType, mValue); err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(400), err), 400)
+			return
+		}
+		// проверяем ограничение числа различных метрик клиента
+		if err := clientlimit.CheckMetrics(r.Context(), metricKey(mType, mName)); err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusForbidden), err), http.StatusForbidden)
+			return
+		}
+
+		ctx := audit.WithRequest(r.Context(), auditRequest(r, audit.TransportURI))
 		retrybuilder := func() func() error {
 			return func() error {
-				err := storage.UpdateParam(r.Context(), cntSummed, mType,
+				err := storage.UpdateParam(ctx, cntSummed, mType,
 					mName, mValue, srvlog)
 				if err != nil {
 					srvlog.Warnf("error updating from uri %w", err)
@@ -60,65 +81,6 @@ func UpdateMHandle(storage repositories.Repo, srvlog zap.SugaredLogger) http.Han
 	}
 }
 
-// RetrieveMHandle функция выводит имена метрик хранящихся в хранилище
-func RetrieveMHandle(storage repositories.Repo, srvlog zap.SugaredLogger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		var buf bytes.Buffer
-		if r == nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError),
-				http.StatusInternalServerError)
-			return
-		}
-		ctx := r.Context()
-
-		// получаем корень папки проекта
-		workDir := utils.WorkingDir()
-
-		// проверяем существует ли файл жаблона страшицы
-		if !utils.ChkFileExist(workDir + api.TemplatePath) {
-			http.Error(w, http.StatusText(http.StatusInternalServerError),
-				http.StatusInternalServerError)
-			return
-		}
-		// создаем шаблон
-		t, err := template.ParseFiles(workDir + api.TemplatePath)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("%v %v\n",
-				http.StatusText(http.StatusInternalServerError), err),
-				http.StatusInternalServerError)
-			return
-		}
-		// получаем метрики
-		metrics, err := storage.GetAllMetrics(ctx, srvlog)
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError),
-				http.StatusInternalServerError)
-			return
-		}
-		// генерим шаблон
-		err = t.Execute(&buf, metrics)
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError),
-				http.StatusInternalServerError)
-			return
-		}
-		data, err := utils.CoHTTP(buf.Bytes(), r, w)
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError),
-				http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", api.HTML)
-		w.WriteHeader(http.StatusOK)
-		_, err = w.Write(data)
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError),
-				http.StatusInternalServerError)
-			return
-		}
-	}
-}
-
 // RetrieveOneMHandle функция для получения значения метрики с помощью URI
 func RetrieveOneMHandle(storage repositories.Repo, srvlog zap.SugaredLogger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -126,6 +88,10 @@ func RetrieveOneMHandle(storage repositories.Repo, srvlog zap.SugaredLogger) htt
 		ctx := r.Context()
 		metric.MType = chi.URLParam(r, "mType")
 		metric.ID = chi.URLParam(r, "mName")
+		if err := auth.CheckMetrics(ctx, metric.ID); err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusForbidden), err), http.StatusForbidden)
+			return
+		}
 
 		switch {
 		case metric.MType == api.Counter:
@@ -201,7 +167,8 @@ func RetrieveOneMHandle(storage repositories.Repo, srvlog zap.SugaredLogger) htt
 func JSONUpdateMMHandle(storage repositories.Repo, filename,
 	signKey string, time int, privKey *rsa.PrivateKey, srvlog zap.SugaredLogger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
+		ctx, span := tracing.Start(r.Context(), "handlers.JSONUpdateMMHandle")
+		defer span.End()
 		var metrics []api.Metrics
 		var metricsMap api.MetricsMap
 		var metric api.Metrics
@@ -250,7 +217,9 @@ func JSONUpdateMMHandle(storage repositories.Repo, filename,
 
 		// расшифровываем если контент зашифрован
 		if len(r.Header.Get("CryptRSA")) != 0 {
+			_, decryptSpan := tracing.Start(ctx, "security.DecryptMetric")
 			err = security.DecryptMetric(&buf, privKey)
+			tracing.End(decryptSpan, err)
 			if err != nil {
 				http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusInternalServerError),
 					"can't decrypt data"), http.StatusInternalServerError)
@@ -258,6 +227,12 @@ func JSONUpdateMMHandle(storage repositories.Repo, filename,
 			}
 		}
 
+		// для журнала аудита отмечаем проверенную подпись и шифрование
+		request := auditRequest(r, audit.TransportJSON)
+		request.Signed = len(signKey) != 0 && len(r.Header.Get("HashSHA256")) != 0
+		request.Encrypted = len(r.Header.Get("CryptRSA")) != 0
+		ctx = audit.WithRequest(ctx, request)
+
 		// десериализуем JSON в metrics
 		if strings.Contains(r.RequestURI, "/updates/") {
 			if err = json.Unmarshal(buf.Bytes(), &metrics); err != nil {
@@ -279,6 +254,32 @@ func JSONUpdateMMHandle(storage repositories.Repo, filename,
 			http.Error(w, "Metrics slice empty try update endpoint", 400)
 			return
 		}
+		span.SetAttributes(attribute.Int("metrics.count", len(metrics)))
+
+		names := make([]string, 0, len(metrics))
+		ids := make([]string, 0, len(metrics))
+		for _, metric := range metrics {
+			names = append(names, metricKey(metric.MType, metric.ID))
+			ids = append(ids, metric.ID)
+		}
+		// проверяем доступ токена к метрикам
+		if err = auth.CheckMetrics(ctx, ids...); err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusForbidden), err), http.StatusForbidden)
+			return
+		}
+		// проверяем метрики до учета в ограничении клиента
+		for _, metric := range metrics {
+			if err = checkMetric(&metric); err != nil {
+				http.Error(w, fmt.Sprintf("%s %s %v", http.StatusText(http.StatusBadRequest),
+					"can't select sorage ", err), http.StatusBadRequest)
+				return
+			}
+		}
+		// проверяем ограничение числа различных метрик клиента
+		if err = clientlimit.CheckMetrics(ctx, names...); err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusForbidden), err), http.StatusForbidden)
+			return
+		}
 
 		for _, metric := range metrics {
 			err = MetricParseSelecStor(ctx, storage, &metric, srvlog)
@@ -348,23 +349,59 @@ func JSONUpdateMMHandle(storage repositories.Repo, filename,
 	}
 }
 
+// функция возвращает имя метрики с типом для учета различных метрик клиента
+func metricKey(mType, mName string) string {
+	return mType + "/" + mName
+}
+
+// функция проверяет что метрику можно сохранить в хранилище
+func checkMetric(metric *api.Metrics) error {
+	if metric.ID == "" {
+		return fmt.Errorf("%s", "not valid metric name")
+	}
+	switch {
+	case metric.MType == api.Counter:
+		if metric.Delta == nil {
+			return fmt.Errorf("delta nil %s %s", metric.ID, metric.MType)
+		}
+	case metric.MType == api.Gauge:
+		if metric.Value == nil {
+			return fmt.Errorf("value nil %s %s", metric.ID, metric.MType)
+		}
+	default:
+		return fmt.Errorf("%s", "empty metic")
+	}
+	return nil
+}
+
+// функция проверяет значение метрики переданное в URI
+func checkValue(mType, mValue string) error {
+	var err error
+	if mType == api.Counter {
+		_, err = utils.ParseValCnt(mValue)
+	} else {
+		_, err = utils.ParseValGag(mValue)
+	}
+	return err
+}
+
 // MetricParseSelecStor функция для сохраненние метрик в хранилище
 func MetricParseSelecStor(ctx context.Context, storage repositories.Repo,
-	metric *api.Metrics, srvlog zap.SugaredLogger) error {
+	metric *api.Metrics, srvlog zap.SugaredLogger) (err error) {
+	ctx, span := tracing.Start(ctx, "handlers.MetricParseSelecStor",
+		attribute.String("metric.id", metric.ID), attribute.String("metric.type", metric.MType))
+	defer func() { tracing.End(span, err) }()
 
 	// переменная для определения того нужно ли
 	// складывать значение метрики типа counter, используется для файлсторэжа
-	_, cntSummed := storage.(*files.Filestorage)
+	_, cntSummed := repositories.Unwrap(storage).(*files.Filestorage)
 
-	if metric.ID == "" {
-		return fmt.Errorf("%s", "not valid metric name")
+	if err = checkMetric(metric); err != nil {
+		return err
 	}
 
 	switch {
 	case metric.MType == api.Counter:
-		if metric.Delta == nil {
-			return fmt.Errorf("delta nil %s %s", metric.ID, metric.MType)
-		}
 		retrybuilder := func() func() error {
 			return func() error {
 				err := storage.UpdateParam(ctx, cntSummed, metric.MType,
@@ -384,9 +421,6 @@ func MetricParseSelecStor(ctx context.Context, storage repositories.Repo,
 			return fmt.Errorf("can't get updated counter value %w", err)
 		}
 	case metric.MType == api.Gauge:
-		if metric.Value == nil {
-			return fmt.Errorf("value nil %s %s", metric.ID, metric.MType)
-		}
 		retrybuilder := func() func() error {
 			return func() error {
 				err := storage.UpdateParam(ctx, cntSummed,
@@ -431,6 +465,10 @@ func JSONRetrieveOneHandle(storage repositories.Repo, signkeystr string,
 			http.Error(w, http.StatusText(400), 400)
 			return
 		}
+		if err = auth.CheckMetrics(ctx, metric.ID); err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusForbidden), err), http.StatusForbidden)
+			return
+		}
 		// зарашиваем метрики
 		switch {
 		case metric.MType == api.Counter:
@@ -509,31 +547,49 @@ func JSONRetrieveOneHandle(storage repositories.Repo, signkeystr string,
 	}
 }
 
-// PingDB функция для проверки подключения к базе данных
-func PingDB(dbconstring string) http.HandlerFunc {
+// PingDB функция для проверки подключения к базе данных,
+// используется пул соединений хранилища
+func PingDB(storage repositories.Repo) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		dbstorage, err := db.NewDBStorage(ctx, dbconstring)
-		if err != nil {
+		dbstorage, ok := repositories.Unwrap(storage).(*db.DBStorage)
+		if !ok {
+			http.Error(w, fmt.Sprintf("%v %v\n", http.StatusText(500), "storage is not data base"), 500)
+			return
+		}
+		if err := dbstorage.Check(r.Context()); err != nil {
 			http.Error(w, fmt.Sprintf("%v %v\n", http.StatusText(500), err), 500)
 			return
 		}
-		defer func() {
-			err = dbstorage.DB.Close()
-			if err != nil {
-				http.Error(w, http.StatusText(http.StatusInternalServerError),
-					http.StatusInternalServerError)
-				return
-			}
-		}()
+		w.WriteHeader(http.StatusOK)
+	}
+}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-		defer cancel()
-		if err := dbstorage.DB.PingContext(ctx); err != nil {
-			http.Error(w, fmt.Sprintf("%v %v\n", http.StatusText(500), err), 500)
+// AlertsHandle хэндлер возвращает активные оповещения в формате json,
+// оповещения по метрикам вне префиксов токена не показываются
+func AlertsHandle(engine *alerts.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		active := []alerts.Alert{}
+		if engine != nil {
+			for _, alert := range engine.Active() {
+				if auth.AllowedMetric(r.Context(), alert.Metric) {
+					active = append(active, alert)
+				}
+			}
+		}
+		resp, err := json.Marshal(active)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
 			return
 		}
+		w.Header().Set("Content-Type", api.Js)
 		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(resp)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
 	}
 }
 
@@ -1,12 +1,45 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/netzen86/collectmetrics/internal/repositories"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netzen86/collectmetrics/internal/alerts"
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/audit"
+	"github.com/netzen86/collectmetrics/internal/auth"
+	"github.com/netzen86/collectmetrics/internal/clientlimit"
+	"github.com/netzen86/collectmetrics/internal/health"
+	"github.com/netzen86/collectmetrics/internal/influx"
+	"github.com/netzen86/collectmetrics/internal/otlp"
+	"github.com/netzen86/collectmetrics/internal/repositories"
+	"github.com/netzen86/collectmetrics/internal/repositories/files"
+	"github.com/netzen86/collectmetrics/internal/repositories/memstorage"
+	"github.com/netzen86/collectmetrics/internal/selfmetrics"
+	"github.com/netzen86/collectmetrics/internal/tracing"
 )
 
 func TestUpdateMHandle(t *testing.T) {
@@ -29,3 +62,527 @@ func TestUpdateMHandle(t *testing.T) {
 		})
 	}
 }
+
+func TestRateLimit(t *testing.T) {
+	newRouter := func(limiter *clientlimit.Limiter) chi.Router {
+		router := chi.NewRouter()
+		router.With(RateLimit(limiter)).Post("/update/{mType}/{mName}/{mValue}",
+			UpdateMHandle(memstorage.NewMemStorage(), *zap.NewNop().Sugar()))
+		return router
+	}
+	send := func(router chi.Router, remoteAddr, uri string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, uri, nil)
+		request.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	t.Run("rate limit", func(t *testing.T) {
+		router := newRouter(clientlimit.NewLimiter(clientlimit.Config{Rate: 1}))
+		assert.Equal(t, http.StatusOK, send(router, "10.0.0.1:5000", "/update/gauge/Alloc/1").Code)
+		response := send(router, "10.0.0.1:5001", "/update/gauge/Alloc/2")
+		assert.Equal(t, http.StatusTooManyRequests, response.Code)
+		assert.Equal(t, "1", response.Header().Get("Retry-After"))
+		// у другого клиента свои токены
+		assert.Equal(t, http.StatusOK, send(router, "10.0.0.2:5000", "/update/gauge/Alloc/1").Code)
+	})
+
+	t.Run("distinct metrics", func(t *testing.T) {
+		router := newRouter(clientlimit.NewLimiter(clientlimit.Config{MaxMetrics: 1}))
+		assert.Equal(t, http.StatusOK, send(router, "10.0.0.1:5000", "/update/gauge/Alloc/1").Code)
+		assert.Equal(t, http.StatusOK, send(router, "10.0.0.1:5000", "/update/gauge/Alloc/2").Code)
+		assert.Equal(t, http.StatusForbidden, send(router, "10.0.0.1:5000", "/update/gauge/Sys/1").Code)
+	})
+
+	t.Run("rejected metrics not counted", func(t *testing.T) {
+		router := newRouter(clientlimit.NewLimiter(clientlimit.Config{MaxMetrics: 1}))
+		// неверное значение не занимает место в ограничении клиента
+		assert.Equal(t, http.StatusBadRequest, send(router, "10.0.0.1:5000", "/update/gauge/Sys/none").Code)
+		assert.Equal(t, http.StatusOK, send(router, "10.0.0.1:5000", "/update/gauge/Alloc/1").Code)
+
+		limiter := clientlimit.NewLimiter(clientlimit.Config{MaxMetrics: 1})
+		ctx := auth.WithToken(clientlimit.WithClient(context.Background(), limiter, "10.0.0.1"),
+			auth.Token{Roles: []auth.Role{auth.RoleWrite}, Prefixes: []string{"app_"}})
+		handler := JSONUpdateMMHandle(memstorage.NewMemStorage(), "", "", 1, nil, *zap.NewNop().Sugar())
+		update := func(body string) int {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body)).WithContext(ctx))
+			return recorder.Code
+		}
+		// метрика вне префиксов токена и метрика без значения не учитываются
+		assert.Equal(t, http.StatusForbidden, update(`[{"id":"Alloc","type":"gauge","value":1}]`))
+		assert.Equal(t, http.StatusBadRequest, update(`[{"id":"app_Sys","type":"gauge"}]`))
+		assert.Equal(t, http.StatusOK, update(`[{"id":"app_Alloc","type":"gauge","value":1}]`))
+	})
+}
+
+func TestDashboard(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	storage := repositories.NewTracked(memstorage.NewMemStorage())
+	assert.NoError(t, storage.UpdateParam(context.Background(), false, api.Gauge, "Alloc", 1.5, logger))
+	assert.NoError(t, storage.UpdateParam(context.Background(), false, api.Counter, "PollCount", int64(3), logger))
+
+	router := chi.NewRouter()
+	router.Get("/", RetrieveMHandle(storage, logger))
+	router.Get("/metric/{mType}/{mName}", MetricPageHandle(storage, logger))
+	router.Get("/dashboard/data", DashboardDataHandle(storage, logger))
+	router.Handle("/static/*", StaticHandle())
+
+	get := func(uri string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, uri, nil))
+		return recorder
+	}
+
+	response := get("/")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `<a href="/metric/gauge/Alloc">Alloc</a>`)
+	assert.Contains(t, response.Body.String(), `/static/dashboard.js`)
+
+	response = get("/metric/counter/PollCount")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), "<canvas")
+	assert.Equal(t, http.StatusNotFound, get("/metric/gauge/Missing").Code)
+
+	var rows []dashboardRow
+	response = get("/dashboard/data?type=gauge&name=Alloc")
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &rows))
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, "1.5", rows[0].Value)
+		assert.NotEmpty(t, rows[0].Updated)
+	}
+
+	response = get("/static/dashboard.js")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.NotContains(t, response.Body.String(), "http://")
+}
+
+func TestAlertsHandle(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	storage := memstorage.NewMemStorage()
+	assert.NoError(t, storage.UpdateParam(context.Background(), false, api.Gauge, "billing_queue", 50.0, logger))
+	assert.NoError(t, storage.UpdateParam(context.Background(), false, api.Gauge, "shop_queue", 70.0, logger))
+	engine := alerts.NewEngine(alerts.Config{Rules: []alerts.Rule{
+		{Name: "billing", Metric: "billing_queue", Op: alerts.OpGreater, Threshold: 10},
+		{Name: "shop", Metric: "shop_queue", Op: alerts.OpGreater, Threshold: 10},
+	}}, storage, logger)
+	require.NoError(t, engine.Evaluate(context.Background()))
+	handler := AlertsHandle(engine)
+	get := func(ctx context.Context) []alerts.Alert {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/alerts", nil).WithContext(ctx))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var active []alerts.Alert
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &active))
+		return active
+	}
+
+	assert.Len(t, get(context.Background()), 2)
+	// токен с префиксом видит только оповещения по своим метрикам
+	active := get(auth.WithToken(context.Background(), auth.Token{Roles: []auth.Role{auth.RoleRead}, Prefixes: []string{"billing_"}}))
+	if assert.Len(t, active, 1) {
+		assert.Equal(t, "billing_queue", active[0].Metric)
+	}
+}
+
+func TestOTLPHandle(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	storage := memstorage.NewMemStorage()
+	handler := OTLPHandle(storage, otlp.NewConverter(), logger)
+	request := &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+			Name: "queue",
+			Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{{
+				Value: &metricspb.NumberDataPoint_AsInt{AsInt: 4},
+			}}}},
+		}, {
+			Name: "requests",
+			Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				IsMonotonic:            true,
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+				DataPoints: []*metricspb.NumberDataPoint{{
+					Value: &metricspb.NumberDataPoint_AsInt{AsInt: 5},
+				}},
+			}},
+		}, {
+			Name: "size",
+			Data: &metricspb.Metric_Summary{Summary: &metricspb.Summary{
+				DataPoints: []*metricspb.SummaryDataPoint{{}},
+			}},
+		}}}},
+	}}}
+	send := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	body, err := proto.Marshal(request)
+	require.NoError(t, err)
+	response := send("application/x-protobuf", body)
+	require.Equal(t, http.StatusOK, response.Code)
+	var export colmetricspb.ExportMetricsServiceResponse
+	require.NoError(t, proto.Unmarshal(response.Body.Bytes(), &export))
+	assert.Equal(t, int64(1), export.GetPartialSuccess().GetRejectedDataPoints())
+
+	body, err = protojson.Marshal(request)
+	require.NoError(t, err)
+	response = send(api.Js, body)
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, api.Js, response.Header().Get("Content-Type"))
+
+	queue, err := storage.GetGaugeMetric(context.Background(), "queue", logger)
+	require.NoError(t, err)
+	assert.Equal(t, 4.0, queue)
+	requests, err := storage.GetCounterMetric(context.Background(), "requests", logger)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), requests)
+
+	assert.Equal(t, http.StatusBadRequest, send(api.Js, []byte("{")).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, send("text/plain", body).Code)
+}
+
+func TestOTLPHandleRetry(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	storage := memstorage.NewMemStorage()
+	handler := OTLPHandle(storage, otlp.NewConverter(), logger)
+	start := uint64(time.Now().Add(time.Hour).UnixNano())
+	send := func(ctx context.Context, value int64) int {
+		body, err := proto.Marshal(&colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+				Name: "jobs",
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					IsMonotonic:            true,
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					DataPoints: []*metricspb.NumberDataPoint{{
+						StartTimeUnixNano: start,
+						Value:             &metricspb.NumberDataPoint_AsInt{AsInt: value},
+					}},
+				}},
+			}}}},
+		}}})
+		require.NoError(t, err)
+		r := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body)).WithContext(ctx)
+		r.Header.Set("Content-Type", "application/x-protobuf")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder.Code
+	}
+
+	// запрос отклонен, приращение не должно потеряться при повторе
+	forbidden := auth.WithToken(context.Background(), auth.Token{Roles: []auth.Role{auth.RoleWrite}, Prefixes: []string{"other"}})
+	assert.Equal(t, http.StatusForbidden, send(forbidden, 10))
+	assert.Equal(t, http.StatusOK, send(context.Background(), 10))
+	jobs, err := storage.GetCounterMetric(context.Background(), "jobs", logger)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), jobs)
+
+	assert.Equal(t, http.StatusOK, send(context.Background(), 25))
+	jobs, err = storage.GetCounterMetric(context.Background(), "jobs", logger)
+	require.NoError(t, err)
+	assert.Equal(t, int64(25), jobs)
+}
+
+// хранилище отклоняет обновление выбранной метрики
+type failingRepo struct {
+	repositories.Repo
+	fail string
+}
+
+func (storage *failingRepo) UpdateParam(ctx context.Context, cntSummed bool, metricType, metricName string,
+	metricValue interface{}, srvlog zap.SugaredLogger) error {
+	if metricName == storage.fail {
+		return errors.New("storage unavailable")
+	}
+	return storage.Repo.UpdateParam(ctx, cntSummed, metricType, metricName, metricValue, srvlog)
+}
+
+// функция возвращает тело запроса OTLP с накопительными рядами
+func cumulativeExport(t *testing.T, start uint64, values map[string]int64) []byte {
+	metrics := make([]*metricspb.Metric, 0, len(values))
+	for _, name := range []string{"jobs", "orders"} {
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		metrics = append(metrics, &metricspb.Metric{Name: name, Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			IsMonotonic:            true,
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			DataPoints: []*metricspb.NumberDataPoint{{
+				StartTimeUnixNano: start,
+				Value:             &metricspb.NumberDataPoint_AsInt{AsInt: value},
+			}},
+		}}})
+	}
+	body, err := proto.Marshal(&colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+	}}})
+	require.NoError(t, err)
+	return body
+}
+
+func TestOTLPHandlePartialFailure(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	storage := &failingRepo{Repo: memstorage.NewMemStorage(), fail: "orders"}
+	handler := OTLPHandle(storage, otlp.NewConverter(), logger)
+	body := cumulativeExport(t, uint64(time.Now().Add(time.Hour).UnixNano()), map[string]int64{"jobs": 10, "orders": 4})
+	send := func() int {
+		r := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-protobuf")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder.Code
+	}
+
+	// первая точка сохранена, вторая нет, повтор не учитывает первую второй раз
+	assert.Equal(t, http.StatusInternalServerError, send())
+	storage.fail = ""
+	assert.Equal(t, http.StatusOK, send())
+	jobs, err := storage.GetCounterMetric(context.Background(), "jobs", logger)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), jobs)
+	orders, err := storage.GetCounterMetric(context.Background(), "orders", logger)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), orders)
+}
+
+func TestOTLPHandleConcurrent(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	storage := memstorage.NewMemStorage()
+	handler := OTLPHandle(storage, otlp.NewConverter(), logger)
+	start := uint64(time.Now().Add(time.Hour).UnixNano())
+
+	// параллельные экспорты одного значения ряда, приращение учитывается один раз
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodPost, "/v1/metrics",
+				bytes.NewReader(cumulativeExport(t, start, map[string]int64{"jobs": 20})))
+			r.Header.Set("Content-Type", "application/x-protobuf")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, r)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+		}()
+	}
+	wg.Wait()
+
+	jobs, err := storage.GetCounterMetric(context.Background(), "jobs", logger)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), jobs)
+}
+
+func TestInfluxWriteHandle(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	storage := memstorage.NewMemStorage()
+	handler := InfluxWriteHandle(storage, influx.NewConfig(""), logger)
+	send := func(body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body)))
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusNoContent, send("cpu,host=a usage=12.5,count=2i 1700000000\n").Code)
+	response := send("cpu,host=a count=3i\ncpu usage=\n")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	var write writeResponse
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &write))
+	assert.Equal(t, 1, write.Written)
+	if assert.Len(t, write.Errors, 1) {
+		assert.Equal(t, 2, write.Errors[0].Line)
+	}
+
+	usage, err := storage.GetGaugeMetric(context.Background(), "cpu_usage_host_a", logger)
+	require.NoError(t, err)
+	assert.Equal(t, 12.5, usage)
+	// целое поле содержит текущее значение и заменяет предыдущее
+	count, err := storage.GetGaugeMetric(context.Background(), "cpu_count_host_a", logger)
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, count)
+}
+
+func TestHealth(t *testing.T) {
+	checker := health.NewChecker()
+	checker.Add("storage", memstorage.NewMemStorage())
+	checker.Add("file", &files.Filestorage{Filename: t.TempDir() + "/missing/metrics.json"})
+	get := func(handler http.HandlerFunc) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		return recorder
+	}
+
+	response := get(LivenessHandle())
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, response.Body.String())
+
+	response = get(ReadinessHandle(checker))
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+	var report health.Report
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &report))
+	assert.Equal(t, health.StatusOK, report.Components["storage"].Status)
+	assert.Equal(t, health.StatusFail, report.Components["file"].Status)
+	assert.NotEmpty(t, report.Components["file"].Error)
+}
+
+func TestSelfMetrics(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	registry := selfmetrics.NewRegistry()
+	storage := memstorage.NewMemStorage()
+	router := chi.NewRouter()
+	router.Use(Instrument(registry))
+	router.Post("/update/{mType}/{mName}/{mValue}", UpdateMHandle(storage, logger))
+	router.Get("/internal/metrics", SelfMetricsHandle(registry, storage, logger))
+
+	send := func(method, uri string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(method, uri, nil))
+		return recorder
+	}
+	send(http.MethodPost, "/update/gauge/Alloc/1")
+	send(http.MethodPost, "/update/gauge/Sys/1")
+	send(http.MethodPost, "/update/histogram/Sys/1")
+
+	response := send(http.MethodGet, "/internal/metrics")
+	assert.Equal(t, http.StatusOK, response.Code)
+	body := response.Body.String()
+	assert.Contains(t, body, `collectmetrics_server_http_requests_total{route="/update/{mType}/{mName}/{mValue}",method="POST",code="200"} 2`)
+	assert.Contains(t, body, `collectmetrics_server_http_requests_total{route="/update/{mType}/{mName}/{mValue}",method="POST",code="400"} 1`)
+	assert.Contains(t, body, `collectmetrics_server_stored_series{type="gauge"} 2`)
+	// собственные метрики не попадают в хранилище
+	metrics, err := storage.GetAllMetrics(context.Background(), logger)
+	require.NoError(t, err)
+	assert.Len(t, metrics.Metrics, 2)
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	logger := *zap.NewNop().Sugar()
+	storage := tracing.NewStorage(memstorage.NewMemStorage(), "memory")
+	router := chi.NewRouter()
+	router.Use(Tracing)
+	router.Post("/update/", JSONUpdateMMHandle(storage, "", "", 300, nil, logger))
+
+	// контекст трассировки агента
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	request := httptest.NewRequest(http.MethodPost, "/update/",
+		strings.NewReader(`{"id":"Alloc","type":"gauge","value":1.5}`))
+	request.Header.Set("Content-Type", api.Js)
+	request.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	names := make(map[string]bool)
+	for _, span := range recorder.Ended() {
+		assert.Equal(t, traceID, span.SpanContext().TraceID().String())
+		names[span.Name()] = true
+	}
+	for _, name := range []string{"POST /update", "handlers.JSONUpdateMMHandle",
+		"handlers.MetricParseSelecStor", "storage.UpdateParam", "storage.GetGaugeMetric"} {
+		assert.True(t, names[name], name)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	log, err := audit.NewFileLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+	require.NoError(t, err)
+	defer log.Close()
+	storage := audit.NewStorage(memstorage.NewMemStorage(), log)
+	router := chi.NewRouter()
+	router.Post("/update/", JSONUpdateMMHandle(storage, "", "", 300, nil, logger))
+	router.Post("/update/{mType}/{mName}/{mValue}", UpdateMHandle(storage, logger))
+	router.Get("/audit", AuditHandle(log, logger))
+
+	send := func(method, uri, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, uri, strings.NewReader(body))
+		request.Header.Set("Content-Type", api.Js)
+		request.Header.Set(api.ACLHeader, "10.0.0.5")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	require.Equal(t, http.StatusOK, send(http.MethodPost, "/update/counter/PollCount/2", "").Code)
+	require.Equal(t, http.StatusOK, send(http.MethodPost, "/update/",
+		`{"id":"PollCount","type":"counter","delta":3}`).Code)
+
+	response := send(http.MethodGet, "/audit?id=PollCount", "")
+	require.Equal(t, http.StatusOK, response.Code)
+	var entries []audit.Entry
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &entries))
+	require.Len(t, entries, 2)
+	assert.Equal(t, audit.TransportURI, entries[0].Transport)
+	assert.Nil(t, entries[0].OldDelta)
+	assert.Equal(t, audit.TransportJSON, entries[1].Transport)
+	assert.Equal(t, "/update/", entries[1].Endpoint)
+	assert.Equal(t, "10.0.0.5", entries[1].Agent)
+	assert.Equal(t, int64(2), *entries[1].OldDelta)
+	assert.Equal(t, int64(5), *entries[1].NewDelta)
+
+	response = send(http.MethodGet, "/audit?transport=http-uri&limit=1", "")
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/audit?since=yesterday", "").Code)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/audit?limit=0", "").Code)
+
+	recorder := httptest.NewRecorder()
+	AuditHandle(nil, logger).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/audit", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestAuthorize(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	store, err := auth.NewStore(filepath.Join(t.TempDir(), "tokens.json"), "admin-secret")
+	require.NoError(t, err)
+	storage := memstorage.NewMemStorage()
+	router := chi.NewRouter()
+	router.With(Authorize(store, auth.RoleWrite)).Post("/update/{mType}/{mName}/{mValue}", UpdateMHandle(storage, logger))
+	router.With(Authorize(store, auth.RoleRead)).Get("/value/{mType}/{mName}", RetrieveOneMHandle(storage, logger))
+	router.With(Authorize(store, auth.RoleAdmin)).Post("/admin/tokens", TokenCreateHandle(store, logger))
+	router.With(Authorize(store, auth.RoleAdmin)).Delete("/admin/tokens/{id}", TokenRevokeHandle(store, logger))
+
+	send := func(method, uri, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, uri, strings.NewReader(body))
+		if len(token) != 0 {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	response := send(http.MethodPost, "/admin/tokens", "admin-secret", `{"name":"agent","roles":["write"],"prefixes":["cpu_"]}`)
+	require.Equal(t, http.StatusCreated, response.Code)
+	var created struct {
+		Token string `json:"token"`
+		ID    string `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &created))
+	require.NotEmpty(t, created.Token)
+
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodPost, "/update/gauge/cpu_idle/1", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodPost, "/update/gauge/cpu_idle/1", "wrong", "").Code)
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "/update/gauge/cpu_idle/1", created.Token, "").Code)
+	// метрика вне префиксов токена
+	assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "/update/gauge/Alloc/1", created.Token, "").Code)
+	// у токена нет роли read и admin
+	assert.Equal(t, http.StatusForbidden, send(http.MethodGet, "/value/gauge/cpu_idle", created.Token, "").Code)
+	assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "/admin/tokens", created.Token, `{"roles":["admin"]}`).Code)
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/value/gauge/cpu_idle", "admin-secret", "").Code)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/admin/tokens", "admin-secret", `{"roles":["owner"]}`).Code)
+
+	assert.Equal(t, http.StatusNoContent, send(http.MethodDelete, "/admin/tokens/"+created.ID, "admin-secret", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodPost, "/update/gauge/cpu_idle/1", created.Token, "").Code)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/health"
+	"github.com/netzen86/collectmetrics/internal/repositories"
+	"github.com/netzen86/collectmetrics/internal/selfmetrics"
+)
+
+// LivenessHandle хэндлер проверки что сервер запущен и обрабатывает запросы
+func LivenessHandle() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, health.Report{Status: health.StatusOK})
+	}
+}
+
+// ReadinessHandle хэндлер проверки готовности компонентов сервера,
+// возвращает 200 если готовы все компоненты, иначе 503
+func ReadinessHandle(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Check(r.Context())
+		code := http.StatusOK
+		if !report.Ready() {
+			code = http.StatusServiceUnavailable
+		}
+		writeHealth(w, code, report)
+	}
+}
+
+func writeHealth(w http.ResponseWriter, code int, report health.Report) {
+	resp, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", api.Js)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_, err = w.Write(resp)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+// SelfMetricsHandle хэндлер выводит собственные метрики сервера в текстовом формате prometheus,
+// перед выводом обновляется число метрик в хранилище
+func SelfMetricsHandle(registry *selfmetrics.Registry, storage repositories.Repo,
+	srvlog zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metrics, err := storage.GetAllMetrics(r.Context(), srvlog)
+		if err != nil {
+			srvlog.Warnf("error when getting all metrics %v", err)
+		} else {
+			series := map[string]int{api.Gauge: 0, api.Counter: 0}
+			for _, metric := range metrics.Metrics {
+				series[metric.MType]++
+			}
+			for metricType, count := range series {
+				registry.SetStoredSeries(metricType, count)
+			}
+		}
+
+		var buf bytes.Buffer
+		err = registry.WriteText(&buf)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(buf.Bytes())
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+	}
+}
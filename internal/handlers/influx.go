@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/audit"
+	"github.com/netzen86/collectmetrics/internal/auth"
+	"github.com/netzen86/collectmetrics/internal/clientlimit"
+	"github.com/netzen86/collectmetrics/internal/influx"
+	"github.com/netzen86/collectmetrics/internal/repositories"
+	"github.com/netzen86/collectmetrics/internal/utils"
+)
+
+// ошибка разбора строки в ответе InfluxWriteHandle
+type lineError struct {
+	Error string `json:"error"`
+	Line  int    `json:"line"`
+}
+
+// ответ InfluxWriteHandle если часть строк не удалось разобрать
+type writeResponse struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Errors  []lineError `json:"errors"`
+	Written int         `json:"written"`
+}
+
+// InfluxWriteHandle хэндлер приема метрик в формате InfluxDB line protocol (POST /write).
+// Корректные строки сохраняются всегда, если все строки разобраны возвращается 204,
+// иначе 400 со списком ошибок по строкам
+func InfluxWriteHandle(storage repositories.Repo, cfg influx.Config, srvlog zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := audit.WithRequest(r.Context(), auditRequest(r, audit.TransportInflux))
+		var buf bytes.Buffer
+
+		// читаем тело запроса
+		_, err := buf.ReadFrom(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusBadRequest),
+				"error body data reading"), http.StatusBadRequest)
+			return
+		}
+
+		// распаковываем если контент упакован
+		err = utils.SelectDeCoHTTP(&buf, r, srvlog)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusBadRequest),
+				"can't unpack data"), http.StatusBadRequest)
+			return
+		}
+
+		metrics, lineErrs := influx.Parse(buf.Bytes(), cfg)
+
+		names := make([]string, 0, len(metrics))
+		ids := make([]string, 0, len(metrics))
+		for _, metric := range metrics {
+			names = append(names, metricKey(metric.MType, metric.ID))
+			ids = append(ids, metric.ID)
+		}
+		// проверяем доступ токена к метрикам
+		if err = auth.CheckMetrics(ctx, ids...); err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusForbidden), err), http.StatusForbidden)
+			return
+		}
+		// проверяем ограничение числа различных метрик клиента
+		if err = clientlimit.CheckMetrics(ctx, names...); err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusForbidden), err), http.StatusForbidden)
+			return
+		}
+
+		for _, metric := range metrics {
+			err = MetricParseSelecStor(ctx, storage, &metric, srvlog)
+			if err != nil {
+				srvlog.Warnf("error parse metric %s error %w", metric.ID, err)
+				http.Error(w, fmt.Sprintf("%s %s %v", http.StatusText(http.StatusInternalServerError),
+					"can't update storage", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if len(lineErrs) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		response := writeResponse{
+			Code:    "invalid",
+			Message: fmt.Sprintf("partial write: %d lines rejected", len(lineErrs)),
+			Errors:  make([]lineError, 0, len(lineErrs)),
+			Written: len(metrics),
+		}
+		for _, lineErr := range lineErrs {
+			response.Errors = append(response.Errors, lineError{Line: lineErr.Line, Error: lineErr.Err.Error()})
+		}
+		resp, err := json.Marshal(response)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", api.Js)
+		w.WriteHeader(http.StatusBadRequest)
+		_, err = w.Write(resp)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+	}
+}
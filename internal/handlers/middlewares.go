@@ -2,25 +2,27 @@ package handlers
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"net/netip"
+	"strconv"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
 	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/clientlimit"
 	"github.com/netzen86/collectmetrics/internal/logger"
+	"github.com/netzen86/collectmetrics/internal/selfmetrics"
+	"github.com/netzen86/collectmetrics/internal/tracing"
 )
 
 // WithLogging функция для включения логирования запросов
 func WithLogging(h http.Handler) http.Handler {
+	sugar := logger.Logger()
 	logFn := func(w http.ResponseWriter, r *http.Request) {
-		sugar, err := logger.Logger()
-		if err != nil {
-			http.Error(w, fmt.Sprintf("%v %v\n",
-				http.StatusText(http.StatusInternalServerError),
-				http.StatusInternalServerError), 500)
-			return
-		}
-
 		// функция Now() возвращает текущее время
 		start := time.Now()
 
@@ -51,6 +53,57 @@ func WithLogging(h http.Handler) http.Handler {
 	return http.HandlerFunc(logFn)
 }
 
+// Tracing функция продолжает трассировку из заголовков запроса
+// и создает спан на всю цепочку обработчиков
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracing.ExtractHTTP(r.Context(), r.Header)
+		ctx, span := tracing.Start(ctx, "HTTP "+r.Method, attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path))
+		defer span.End()
+
+		lw, rd := logger.NewLRW(w)
+		next.ServeHTTP(lw, r.WithContext(ctx))
+
+		// имя спана по шаблону маршрута известно только после маршрутизации
+		if routeCtx := chi.RouteContext(ctx); routeCtx != nil && len(routeCtx.RoutePattern()) != 0 {
+			span.SetName(r.Method + " " + routeCtx.RoutePattern())
+			span.SetAttributes(attribute.String("http.route", routeCtx.RoutePattern()))
+		}
+		status := rd.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// Instrument функция учитывает запросы в собственных метриках сервера
+// по шаблону маршрута, методу и коду ответа
+func Instrument(registry *selfmetrics.Registry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			lw, rd := logger.NewLRW(w)
+			next.ServeHTTP(lw, r)
+
+			// шаблон вместо пути, чтобы имена метрик не порождали новые ряды
+			route := "unknown"
+			if routeCtx := chi.RouteContext(r.Context()); routeCtx != nil && len(routeCtx.RoutePattern()) != 0 {
+				route = routeCtx.RoutePattern()
+			}
+			status := rd.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			registry.ObserveHTTP(route, r.Method, status, time.Since(start))
+		})
+	}
+}
+
 // AccecsList функция ограничевает доступ к серверу по IP адресу
 func AccecsList(network netip.Prefix) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -77,3 +130,31 @@ func AccecsList(network netip.Prefix) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// RateLimit функция ограничивает частоту запросов клиента, при превышении
+// отвечает 429 с заголовком Retry-After. Клиент сохраняется в контексте запроса
+// для проверки числа различных метрик в хэндлерах.
+func RateLimit(limiter *clientlimit.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := ClientKey(r)
+			ok, wait := limiter.Allow(client)
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(clientlimit.RetryAfter(wait)))
+				http.Error(w, fmt.Sprintf("%v\n",
+					http.StatusText(http.StatusTooManyRequests)), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(clientlimit.WithClient(r.Context(), limiter, client)))
+		})
+	}
+}
+
+// ClientKey функция возвращает ключ клиента для ограничений - IP адрес соединения
+func ClientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
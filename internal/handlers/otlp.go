@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/audit"
+	"github.com/netzen86/collectmetrics/internal/auth"
+	"github.com/netzen86/collectmetrics/internal/clientlimit"
+	"github.com/netzen86/collectmetrics/internal/otlp"
+	"github.com/netzen86/collectmetrics/internal/repositories"
+	"github.com/netzen86/collectmetrics/internal/utils"
+)
+
+// тип содержимого OTLP/HTTP в формате protobuf
+const protobufContentType = "application/x-protobuf"
+
+// OTLPHandle хэндлер приема метрик по протоколу OTLP/HTTP (POST /v1/metrics),
+// тело запроса в формате protobuf или json, ответ в том же формате
+func OTLPHandle(storage repositories.Repo, converter *otlp.Converter,
+	srvlog zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := audit.WithRequest(r.Context(), auditRequest(r, audit.TransportOTLP))
+		var buf bytes.Buffer
+
+		contentType := r.Header.Get("Content-Type")
+		isJSON := strings.HasPrefix(contentType, api.Js)
+		if !isJSON && !strings.HasPrefix(contentType, protobufContentType) {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusUnsupportedMediaType),
+				"content type must be application/x-protobuf or application/json"),
+				http.StatusUnsupportedMediaType)
+			return
+		}
+
+		// читаем тело запроса
+		_, err := buf.ReadFrom(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusBadRequest),
+				"error body data reading"), http.StatusBadRequest)
+			return
+		}
+
+		// распаковываем если контент упакован
+		err = utils.SelectDeCoHTTP(&buf, r, srvlog)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusBadRequest),
+				"can't unpack data"), http.StatusBadRequest)
+			return
+		}
+
+		var request colmetricspb.ExportMetricsServiceRequest
+		if isJSON {
+			err = protojson.Unmarshal(buf.Bytes(), &request)
+		} else {
+			err = proto.Unmarshal(buf.Bytes(), &request)
+		}
+		if err != nil {
+			srvlog.Warnf("error when decode otlp request %w", err)
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusBadRequest),
+				"decode otlp request error"), http.StatusBadRequest)
+			return
+		}
+
+		// состояние ряда запоминается сразу после сохранения его точки, отклоненный
+		// запрос клиент может повторить без потери и без повторного учета приращений.
+		// Преобразователь заблокирован до конца сохранения.
+		result := converter.Convert(&request)
+		defer result.Done()
+
+		names := make([]string, 0, len(result.Metrics))
+		ids := make([]string, 0, len(result.Metrics))
+		for _, metric := range result.Metrics {
+			names = append(names, metricKey(metric.MType, metric.ID))
+			ids = append(ids, metric.ID)
+		}
+		// проверяем доступ токена к метрикам
+		if err = auth.CheckMetrics(ctx, ids...); err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusForbidden), err), http.StatusForbidden)
+			return
+		}
+		// проверяем ограничение числа различных метрик клиента
+		if err = clientlimit.CheckMetrics(ctx, names...); err != nil {
+			http.Error(w, fmt.Sprintf("%s %v\n", http.StatusText(http.StatusForbidden), err), http.StatusForbidden)
+			return
+		}
+
+		for i, metric := range result.Metrics {
+			err = MetricParseSelecStor(ctx, storage, &metric, srvlog)
+			if err != nil {
+				srvlog.Warnf("error parse metric %s error %w", metric.ID, err)
+				http.Error(w, fmt.Sprintf("%s %s %v", http.StatusText(http.StatusInternalServerError),
+					"can't update storage", err), http.StatusInternalServerError)
+				return
+			}
+			result.Stored(i)
+		}
+		result.Done()
+
+		// о неподдерживаемых точках сообщаем через partial_success
+		var response colmetricspb.ExportMetricsServiceResponse
+		if result.Rejected != 0 {
+			response.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+				RejectedDataPoints: result.Rejected,
+				ErrorMessage:       result.Message,
+			}
+		}
+		var resp []byte
+		if isJSON {
+			resp, err = protojson.Marshal(&response)
+		} else {
+			resp, err = proto.Marshal(&response)
+		}
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+
+		if isJSON {
+			w.Header().Set("Content-Type", api.Js)
+		} else {
+			w.Header().Set("Content-Type", protobufContentType)
+		}
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(resp)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// интервал проверки состояния для подписчиков Watch
+const watchInterval = 5 * time.Second
+
+// GRPCServer сервис grpc.health.v1.Health, состояние берется из Checker.
+// Пустое имя сервиса означает весь сервер, остальные имена должны быть
+// переданы в NewGRPCServer, для них возвращается то же состояние
+type GRPCServer struct {
+	healthpb.UnimplementedHealthServer
+	checker  *Checker
+	services map[string]bool
+}
+
+// NewGRPCServer функция создания сервиса проверки готовности для gRPC
+func NewGRPCServer(checker *Checker, services ...string) *GRPCServer {
+	known := map[string]bool{"": true}
+	for _, service := range services {
+		known[service] = true
+	}
+	return &GRPCServer{checker: checker, services: known}
+}
+
+// Check метод возвращает текущее состояние сервера
+func (srv *GRPCServer) Check(ctx context.Context,
+	in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if !srv.services[in.GetService()] {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", in.GetService())
+	}
+	return &healthpb.HealthCheckResponse{Status: srv.status(ctx)}, nil
+}
+
+// Watch метод отправляет состояние сервера сразу и при каждом изменении
+func (srv *GRPCServer) Watch(in *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	if !srv.services[in.GetService()] {
+		return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVICE_UNKNOWN})
+	}
+
+	ctx := stream.Context()
+	last := healthpb.HealthCheckResponse_UNKNOWN
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		if current := srv.status(ctx); current != last {
+			last = current
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: current}); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (srv *GRPCServer) status(ctx context.Context) healthpb.HealthCheckResponse_ServingStatus {
+	if srv.checker.Check(ctx).Ready() {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
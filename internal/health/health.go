@@ -0,0 +1,89 @@
+// Package health - пакет проверки готовности компонентов сервера
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/netzen86/collectmetrics/internal/repositories"
+)
+
+// время на проверку одного компонента
+const checkTimeout = 5 * time.Second
+
+// состояния компонентов и сервера
+const (
+	StatusOK   string = "ok"
+	StatusFail string = "fail"
+)
+
+// ComponentStatus состояние компонента
+type ComponentStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report результат проверки всех компонентов
+type Report struct {
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+	Status     string                     `json:"status"`
+}
+
+// Ready метод возвращает true если все компоненты готовы
+func (report Report) Ready() bool {
+	return report.Status == StatusOK
+}
+
+// Checker проверяет готовность зарегистрированных компонентов
+type Checker struct {
+	components map[string]repositories.HealthChecker
+	mx         sync.RWMutex
+}
+
+// NewChecker функция создания проверки готовности
+func NewChecker() *Checker {
+	return &Checker{components: make(map[string]repositories.HealthChecker)}
+}
+
+// Add метод регистрирует компонент под именем name
+func (checker *Checker) Add(name string, component repositories.HealthChecker) {
+	checker.mx.Lock()
+	defer checker.mx.Unlock()
+	checker.components[name] = component
+}
+
+// Check метод параллельно проверяет все компоненты,
+// сервер готов если готовы все компоненты
+func (checker *Checker) Check(ctx context.Context) Report {
+	checker.mx.RLock()
+	components := make(map[string]repositories.HealthChecker, len(checker.components))
+	for name, component := range checker.components {
+		components[name] = component
+	}
+	checker.mx.RUnlock()
+
+	report := Report{Status: StatusOK, Components: make(map[string]ComponentStatus, len(components))}
+	var mx sync.Mutex
+	var wg sync.WaitGroup
+	for name, component := range components {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			status := ComponentStatus{Status: StatusOK}
+			if err := component.Check(ctx); err != nil {
+				status = ComponentStatus{Status: StatusFail, Error: err.Error()}
+			}
+			mx.Lock()
+			defer mx.Unlock()
+			report.Components[name] = status
+			if status.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
@@ -0,0 +1,47 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+type checkFunc func(ctx context.Context) error
+
+func (check checkFunc) Check(ctx context.Context) error {
+	return check(ctx)
+}
+
+func TestChecker(t *testing.T) {
+	ctx := context.Background()
+	var storageErr error
+	checker := NewChecker()
+	checker.Add("storage", checkFunc(func(context.Context) error { return storageErr }))
+	checker.Add("cache", checkFunc(func(context.Context) error { return nil }))
+	srv := NewGRPCServer(checker, "Metric")
+
+	report := checker.Check(ctx)
+	assert.True(t, report.Ready())
+	assert.Equal(t, ComponentStatus{Status: StatusOK}, report.Components["storage"])
+	response, err := srv.Check(ctx, &healthpb.HealthCheckRequest{Service: "Metric"})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, response.GetStatus())
+
+	storageErr = errors.New("disk full")
+	report = checker.Check(ctx)
+	assert.False(t, report.Ready())
+	assert.Equal(t, ComponentStatus{Status: StatusFail, Error: "disk full"}, report.Components["storage"])
+	assert.Equal(t, StatusOK, report.Components["cache"].Status)
+	response, err = srv.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, response.GetStatus())
+
+	_, err = srv.Check(ctx, &healthpb.HealthCheckRequest{Service: "Unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
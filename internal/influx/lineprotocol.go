@@ -0,0 +1,227 @@
+// Package influx - пакет разбора метрик в формате InfluxDB line protocol
+package influx
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+// LineError ошибка разбора строки, строки нумеруются с 1
+type LineError struct {
+	Err  error
+	Line int
+}
+
+func (lineErr LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", lineErr.Line, lineErr.Err)
+}
+
+func (lineErr LineError) Unwrap() error {
+	return lineErr.Err
+}
+
+// Config настройки разбора строк
+type Config struct {
+	// имена полей measurement_field сохраняемых как counter
+	counters map[string]struct{}
+}
+
+// NewConfig функция создания настроек, counters - имена полей measurement_field
+// через запятую, целые значения которых добавляются к counter как приращения
+func NewConfig(counters string) Config {
+	cfg := Config{counters: make(map[string]struct{})}
+	for _, name := range strings.Split(counters, ",") {
+		if name = strings.TrimSpace(name); len(name) != 0 {
+			cfg.counters[api.SanitizeName(name)] = struct{}{}
+		}
+	}
+	return cfg
+}
+
+// Parse функция разбирает строки вида
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+//
+// Каждое поле становится метрикой с именем measurement_field, к которому
+// добавляются отсортированные теги в виде _tag_value. Числовые и логические поля
+// становятся gauge, в том числе целые (5i, 5u): обычно в line protocol передается
+// текущее значение поля. Целые поля перечисленные в cfg становятся counter,
+// их значение добавляется к counter как приращение. Строковые поля пропускаются.
+// Строки с ошибкой не сохраняются и возвращаются в списке ошибок,
+// пустые строки и комментарии (#) пропускаются. Метка времени проверяется,
+// но не сохраняется: хранилище содержит только последние значения.
+func Parse(data []byte, cfg Config) ([]api.Metrics, []LineError) {
+	var metrics []api.Metrics
+	var lineErrs []LineError
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(data)+1)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lineMetrics, err := parseLine(line, cfg)
+		if err != nil {
+			lineErrs = append(lineErrs, LineError{Line: number, Err: err})
+			continue
+		}
+		metrics = append(metrics, lineMetrics...)
+	}
+	return metrics, lineErrs
+}
+
+// функция разбирает одну строку
+func parseLine(line string, cfg Config) ([]api.Metrics, error) {
+	// кавычки учитываются только в полях, в имени и тегах это обычный символ
+	keySection, rest, ok := cut(line, ' ')
+	if !ok {
+		return nil, errors.New("missing fields")
+	}
+	sections := split(rest, ' ', true)
+	if len(sections) > 2 {
+		return nil, errors.New("unexpected data after timestamp")
+	}
+	if len(sections) == 2 {
+		if _, err := strconv.ParseInt(sections[1], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", sections[1])
+		}
+	}
+
+	key := split(keySection, ',', false)
+	measurement := unescape(key[0])
+	if len(measurement) == 0 {
+		return nil, errors.New("missing measurement")
+	}
+	tags := make([]string, 0, len(key)-1)
+	for _, tag := range key[1:] {
+		pair := split(tag, '=', false)
+		if len(pair) != 2 || len(pair[0]) == 0 || len(pair[1]) == 0 {
+			return nil, fmt.Errorf("invalid tag %q", tag)
+		}
+		tags = append(tags, api.SanitizeName(unescape(pair[0]))+"_"+
+			api.SanitizeName(unescape(pair[1])))
+	}
+	sort.Strings(tags)
+	suffix := ""
+	if len(tags) != 0 {
+		suffix = "_" + strings.Join(tags, "_")
+	}
+
+	var metrics []api.Metrics
+	for _, field := range split(sections[0], ',', true) {
+		pair := split(field, '=', true)
+		if len(pair) != 2 || len(pair[0]) == 0 {
+			return nil, fmt.Errorf("invalid field %q", field)
+		}
+		name := api.SanitizeName(measurement + "_" + unescape(pair[0]))
+		_, counter := cfg.counters[name]
+		metric, ok, err := parseField(name+suffix, pair[1], counter)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", unescape(pair[0]), err)
+		}
+		if ok {
+			metrics = append(metrics, metric)
+		}
+	}
+	if len(metrics) == 0 {
+		return nil, errors.New("no numeric fields")
+	}
+	return metrics, nil
+}
+
+// функция преобразует значение поля в метрику, для строк возвращает false.
+// Если counter, значение должно быть целым и становится приращением counter.
+func parseField(name, value string, counter bool) (api.Metrics, bool, error) {
+	switch {
+	case len(value) == 0:
+		return api.Metrics{}, false, errors.New("missing value")
+	case value[0] == '"':
+		if len(value) < 2 || value[len(value)-1] != '"' {
+			return api.Metrics{}, false, errors.New("unterminated string")
+		}
+		return api.Metrics{}, false, nil
+	case strings.HasSuffix(value, "i"):
+		integer, err := strconv.ParseInt(strings.TrimSuffix(value, "i"), 10, 64)
+		if err != nil {
+			return api.Metrics{}, false, fmt.Errorf("invalid integer %q", value)
+		}
+		if counter {
+			return api.NewCounter(name, integer), true, nil
+		}
+		return api.NewGauge(name, float64(integer)), true, nil
+	case strings.HasSuffix(value, "u"):
+		integer, err := strconv.ParseUint(strings.TrimSuffix(value, "u"), 10, 64)
+		if err != nil || (counter && integer > math.MaxInt64) {
+			return api.Metrics{}, false, fmt.Errorf("invalid unsigned integer %q", value)
+		}
+		if counter {
+			return api.NewCounter(name, int64(integer)), true, nil
+		}
+		return api.NewGauge(name, float64(integer)), true, nil
+	case counter:
+		return api.Metrics{}, false, fmt.Errorf("counter value must be integer, got %q", value)
+	}
+
+	switch value {
+	case "t", "T", "true", "True", "TRUE":
+		return api.NewGauge(name, 1), true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return api.NewGauge(name, 0), true, nil
+	}
+	gauge, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(gauge) || math.IsInf(gauge, 0) {
+		return api.Metrics{}, false, fmt.Errorf("invalid float %q", value)
+	}
+	return api.NewGauge(name, gauge), true, nil
+}
+
+// функция делит строку по разделителю без обратной косой черты перед ним,
+// если quoted, разделители внутри строк в двойных кавычках не учитываются
+func split(s string, sep byte, quoted bool) []string {
+	var parts []string
+	var inQuotes bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"' && quoted:
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// функция делит строку по первому разделителю без обратной косой черты перед ним
+func cut(s string, sep byte) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+// функция убирает экранирование запятых, пробелов и знаков равенства
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	replacer := strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=", `\\`, `\`)
+	return replacer.Replace(s)
+}
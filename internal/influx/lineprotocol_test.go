@@ -0,0 +1,67 @@
+package influx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+func TestParse(t *testing.T) {
+	data := []byte(`# комментарий
+cpu,host=web\ 1,core=0 usage=12.5,idle=87.5 1700000000000000000
+requests,path=/api count=3i,bytes=512u,ok=true,note="a=b, c"
+
+disk free=
+mem used=1e3
+bad
+net,host rx=1
+net rx=abc
+net rx=1 abc
+log msg="only strings"
+quote,tag=a"b f=1
+`)
+	metrics, lineErrs := Parse(data, NewConfig(""))
+
+	got := make(map[string]float64, len(metrics))
+	for _, metric := range metrics {
+		switch metric.MType {
+		case api.Gauge:
+			got[metric.MType+"/"+metric.ID] = *metric.Value
+		case api.Counter:
+			got[metric.MType+"/"+metric.ID] = float64(*metric.Delta)
+		}
+	}
+	assert.Equal(t, map[string]float64{
+		"gauge/cpu_usage_core_0_host_web_1": 12.5,
+		"gauge/cpu_idle_core_0_host_web_1":  87.5,
+		"gauge/requests_count_path__api":    3,
+		"gauge/requests_bytes_path__api":    512,
+		"gauge/requests_ok_path__api":       1,
+		"gauge/mem_used":                    1000,
+		// кавычка в теге не начинает строку
+		"gauge/quote_f_tag_a_b": 1,
+	}, got)
+
+	lines := make([]int, 0, len(lineErrs))
+	for _, lineErr := range lineErrs {
+		lines = append(lines, lineErr.Line)
+	}
+	assert.Equal(t, []int{5, 7, 8, 9, 10, 11}, lines)
+	assert.EqualError(t, lineErrs[0], `line 5: field "free": missing value`)
+}
+
+func TestParseCounters(t *testing.T) {
+	cfg := NewConfig("requests_count, requests_bytes")
+	metrics, lineErrs := Parse([]byte("requests,path=/api count=3i,bytes=512u,ok=true\nrequests count=1.5\n"), cfg)
+	assert.Equal(t, []api.Metrics{
+		api.NewCounter("requests_count_path__api", 3),
+		api.NewCounter("requests_bytes_path__api", 512),
+		api.NewGauge("requests_ok_path__api", 1),
+	}, metrics)
+	// дробное значение не может быть приращением counter
+	if assert.Len(t, lineErrs, 1) {
+		assert.Equal(t, 2, lineErrs[0].Line)
+	}
+}
@@ -0,0 +1,126 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// форматы записей лога
+const (
+	FormatConsole string = "console"
+	FormatJSON    string = "json"
+)
+
+// период в котором считаются одинаковые записи при сэмплировании
+const samplingTick = time.Second
+
+// Sampling параметры сэмплирования: в течение секунды пишутся первые Initial
+// записей с одинаковым уровнем и сообщением, затем каждая Thereafter запись.
+// Нулевое значение Initial отключает сэмплирование
+type Sampling struct {
+	Initial    int `json:"initial,omitempty" flag:"log-sampling-initial" env:"LOG_SAMPLING_INITIAL" min:"0" usage:"Log first N entries with the same message per second, 0 - disable sampling."`
+	Thereafter int `json:"thereafter,omitempty" flag:"log-sampling-thereafter" env:"LOG_SAMPLING_THEREAFTER" min:"0" usage:"After sampling-initial log every Nth entry with the same message per second."`
+}
+
+// Config параметры логирования, теги задают флаги, переменные окружения
+// и значения по умолчанию для пакета cfgload
+type Config struct {
+	// Level минимальный уровень записей: debug, info, warn, error
+	Level string `json:"level,omitempty" flag:"log-level" env:"LOG_LEVEL" DefVal:"info" usage:"Log level: debug, info, warn or error."`
+	// Format формат записей: console или json
+	Format string `json:"format,omitempty" flag:"log-format" env:"LOG_FORMAT" DefVal:"console" usage:"Log format: console or json."`
+	// File файл лога, пустое значение - stderr
+	File string `json:"file,omitempty" flag:"log-file" env:"LOG_FILE" usage:"Write log to file instead of stderr."`
+	// RotateInterval период ротации файла лога, например 24h
+	RotateInterval string   `json:"rotate_interval,omitempty" flag:"log-rotate-interval" env:"LOG_ROTATE_INTERVAL" usage:"Rotate log file every interval, e.g. 24h."`
+	Sampling       Sampling `json:"sampling,omitempty"`
+	// MaxSize размер файла лога в мегабайтах после которого он ротируется
+	MaxSize int `json:"max_size_mb,omitempty" flag:"log-max-size" env:"LOG_MAX_SIZE" min:"0" usage:"Rotate log file when it exceeds size in megabytes, 0 - never."`
+	// MaxBackups число хранимых ротированных файлов, 0 - хранить все
+	MaxBackups int `json:"max_backups,omitempty" flag:"log-max-backups" env:"LOG_MAX_BACKUPS" min:"0" usage:"Rotated log files to keep, 0 - keep all."`
+}
+
+// DefaultConfig функция возвращает параметры логирования по умолчанию
+func DefaultConfig() Config {
+	return Config{Level: zapcore.InfoLevel.String(), Format: FormatConsole}
+}
+
+// метод подставляет значения по умолчанию вместо пустых уровня и формата
+func (cfg Config) withDefaults() Config {
+	def := DefaultConfig()
+	if len(cfg.Level) == 0 {
+		cfg.Level = def.Level
+	}
+	if len(cfg.Format) == 0 {
+		cfg.Format = def.Format
+	}
+	return cfg
+}
+
+// Validate метод проверяет параметры логирования, пустые уровень и формат
+// означают значения по умолчанию
+func (cfg Config) Validate() error {
+	cfg = cfg.withDefaults()
+	if _, err := zapcore.ParseLevel(cfg.Level); err != nil {
+		return fmt.Errorf("wrong log level %q", cfg.Level)
+	}
+	if cfg.Format != FormatConsole && cfg.Format != FormatJSON {
+		return fmt.Errorf("log format must be %s or %s, got %q", FormatConsole, FormatJSON, cfg.Format)
+	}
+	if _, err := cfg.rotateInterval(); err != nil {
+		return err
+	}
+	if cfg.MaxSize < 0 || cfg.MaxBackups < 0 || cfg.Sampling.Initial < 0 || cfg.Sampling.Thereafter < 0 {
+		return fmt.Errorf("log size, backups and sampling must not be negative")
+	}
+	return nil
+}
+
+func (cfg Config) rotateInterval() (time.Duration, error) {
+	if len(cfg.RotateInterval) == 0 {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(cfg.RotateInterval)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("wrong log rotate interval %q", cfg.RotateInterval)
+	}
+	return interval, nil
+}
+
+// метод создает ядро zap по параметрам, уровень задается снаружи,
+// возвращает файл лога для закрытия при замене ядра
+func (cfg Config) build(level zapcore.LevelEnabler) (zapcore.Core, *rotatingFile, error) {
+	var encoder zapcore.Encoder
+	switch cfg.Format {
+	case FormatJSON:
+		encoderCfg := zap.NewProductionEncoderConfig()
+		encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoder = zapcore.NewJSONEncoder(encoderCfg)
+	default:
+		encoder = zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+	}
+
+	var output zapcore.WriteSyncer = zapcore.Lock(os.Stderr)
+	var file *rotatingFile
+	if len(cfg.File) != 0 {
+		interval, err := cfg.rotateInterval()
+		if err != nil {
+			return nil, nil, err
+		}
+		file, err = openRotatingFile(cfg.File, int64(cfg.MaxSize)<<20, interval, cfg.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		output = file
+	}
+
+	core := zapcore.NewCore(encoder, output, level)
+	if cfg.Sampling.Initial != 0 {
+		core = zapcore.NewSamplerWithOptions(core, samplingTick, cfg.Sampling.Initial, cfg.Sampling.Thereafter)
+	}
+	return core, file, nil
+}
@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// swapCore ядро zap которое передает записи текущему ядру,
+// позволяет менять вывод логгеров уже полученных компонентами
+type swapCore struct {
+	current *atomic.Pointer[zapcore.Core]
+	// запись держит блокировку на чтение, замена ядра ждет завершения записей
+	mx     *sync.RWMutex
+	fields []zapcore.Field
+}
+
+func newSwapCore(core zapcore.Core) *swapCore {
+	current := &atomic.Pointer[zapcore.Core]{}
+	current.Store(&core)
+	return &swapCore{current: current, mx: &sync.RWMutex{}}
+}
+
+// метод заменяет текущее ядро и возвращает предыдущее, после возврата
+// записей в предыдущее ядро больше нет
+func (core *swapCore) swap(next zapcore.Core) zapcore.Core {
+	core.mx.Lock()
+	defer core.mx.Unlock()
+	return *core.current.Swap(&next)
+}
+
+// метод возвращает текущее ядро с полями добавленными через With
+func (core *swapCore) load() zapcore.Core {
+	current := *core.current.Load()
+	if len(core.fields) != 0 {
+		current = current.With(core.fields)
+	}
+	return current
+}
+
+// Enabled метод проверяет включен ли уровень
+func (core *swapCore) Enabled(level zapcore.Level) bool {
+	return (*core.current.Load()).Enabled(level)
+}
+
+// With метод возвращает ядро с дополнительными полями
+func (core *swapCore) With(fields []zapcore.Field) zapcore.Core {
+	all := make([]zapcore.Field, 0, len(core.fields)+len(fields))
+	all = append(all, core.fields...)
+	all = append(all, fields...)
+	return &swapCore{current: core.current, mx: core.mx, fields: all}
+}
+
+// Check метод проверяет запись текущим ядром (уровень и сэмплирование) и добавляет
+// к записи само swapCore, чтобы запись попала в ядро текущее на момент записи
+func (core *swapCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if core.load().Check(entry, nil) == nil {
+		return checked
+	}
+	return checked.AddCore(entry, core)
+}
+
+// Write метод записывает запись в текущее ядро
+func (core *swapCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	core.mx.RLock()
+	defer core.mx.RUnlock()
+	return core.load().Write(entry, fields)
+}
+
+// Sync метод сбрасывает буферы текущего ядра
+func (core *swapCore) Sync() error {
+	core.mx.RLock()
+	defer core.mx.RUnlock()
+	return (*core.current.Load()).Sync()
+}
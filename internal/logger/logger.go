@@ -2,25 +2,94 @@
 package logger
 
 import (
-	"fmt"
 	"net/http"
+	"sync"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
-func Logger() (zap.SugaredLogger, error) {
-	// создаём предустановленный регистратор zap
-	logger, err := zap.NewDevelopment()
+// общий логгер процесса, ядро заменяется при настройке через Setup
+var shared = newSharedLogger()
+
+type sharedLogger struct {
+	file   *rotatingFile
+	core   *swapCore
+	logger *zap.Logger
+	level  zap.AtomicLevel
+	// уровень из конфигурации, к нему возвращается ToggleDebug
+	base zapcore.Level
+	mx   sync.Mutex
+}
+
+func newSharedLogger() *sharedLogger {
+	cfg := DefaultConfig()
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	// ядро с выводом в stderr создается без ошибок
+	core, _, _ := cfg.build(level)
+	swap := newSwapCore(core)
+	return &sharedLogger{
+		core:   swap,
+		logger: zap.New(swap, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)),
+		level:  level,
+		base:   zapcore.InfoLevel,
+	}
+}
+
+// Logger функция возвращает общий логгер процесса. Логгер можно получить
+// до вызова Setup, после настройки он пишет по новым параметрам
+func Logger() zap.SugaredLogger {
+	return *shared.logger.Sugar()
+}
+
+// Setup функция настраивает общий логгер процесса, предыдущий файл лога закрывается
+func Setup(cfg Config) error {
+	cfg = cfg.withDefaults()
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	level, _ := zapcore.ParseLevel(cfg.Level)
+	core, file, err := cfg.build(shared.level)
 	if err != nil {
-		return zap.SugaredLogger{},
-			fmt.Errorf("error when crating logger %w", err)
+		return err
 	}
-	defer func() {
-		err = logger.Sync()
-	}()
 
-	// делаем регистратор SugaredLogger
-	return *logger.Sugar(), nil
+	shared.mx.Lock()
+	defer shared.mx.Unlock()
+	// после замены записей в старое ядро нет, его можно сбросить и закрыть файл
+	previous := shared.core.swap(core)
+	shared.level.SetLevel(level)
+	shared.base = level
+	_ = previous.Sync()
+	if shared.file != nil {
+		_ = shared.file.Close()
+	}
+	shared.file = file
+	return nil
+}
+
+// Sync функция сбрасывает буферы общего логгера
+func Sync() error {
+	return shared.logger.Sync()
+}
+
+// LevelHandler функция возвращает обработчик для изменения уровня логирования:
+// GET возвращает текущий уровень, PUT с телом {"level":"debug"} задает новый
+func LevelHandler() http.Handler {
+	return shared.level
+}
+
+// ToggleDebug функция переключает уровень между debug и уровнем из конфигурации,
+// возвращает новый уровень
+func ToggleDebug() zapcore.Level {
+	shared.mx.Lock()
+	defer shared.mx.Unlock()
+	level := zapcore.DebugLevel
+	if shared.level.Level() == zapcore.DebugLevel && shared.base != zapcore.DebugLevel {
+		level = shared.base
+	}
+	shared.level.SetLevel(level)
+	return level
 }
 
 type (
@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRotatingFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	file, err := openRotatingFile(name, 10, 0, 2)
+	require.NoError(t, err)
+	defer file.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err = file.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, "fourth\n", string(data))
+	// хранятся только два последних ротированных файла
+	backups, err := filepath.Glob(name + ".*")
+	require.NoError(t, err)
+	assert.Len(t, backups, 2)
+}
+
+func TestSetup(t *testing.T) {
+	t.Cleanup(func() { require.NoError(t, Setup(DefaultConfig())) })
+
+	// логгер полученный до настройки пишет по новым параметрам
+	sugar := Logger()
+	name := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, Setup(Config{Level: "warn", Format: FormatJSON, File: name}))
+
+	sugar.Info("skipped")
+	sugar.With("metric", "Alloc").Warn("written")
+	require.NoError(t, Sync())
+
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 1)
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "written", entry["msg"])
+	assert.Equal(t, "Alloc", entry["metric"])
+
+	// переключение на debug и обратно на уровень из конфигурации
+	assert.Equal(t, zapcore.DebugLevel, ToggleDebug())
+	assert.Equal(t, zapcore.WarnLevel, ToggleDebug())
+
+	assert.Error(t, Setup(Config{Level: "verbose"}))
+	assert.Error(t, Setup(Config{Format: "xml"}))
+	assert.Error(t, Setup(Config{RotateInterval: "daily"}))
+}
+
+func TestSwapCore(t *testing.T) {
+	before, beforeLogs := observer.New(zapcore.InfoLevel)
+	after, afterLogs := observer.New(zapcore.InfoLevel)
+	core := newSwapCore(before)
+	log := zap.New(core)
+
+	// запись проверенная до замены ядра пишется в новое ядро,
+	// старое ядро после замены можно закрыть
+	checked := log.Check(zapcore.InfoLevel, "in flight")
+	require.NotNil(t, checked)
+	assert.Equal(t, before, core.swap(after))
+	checked.Write()
+	assert.Zero(t, beforeLogs.Len())
+	assert.Equal(t, 1, afterLogs.Len())
+
+	// уровень проверяется текущим ядром
+	assert.Nil(t, log.Check(zapcore.DebugLevel, "skipped"))
+}
+
+func TestLevelHandler(t *testing.T) {
+	t.Cleanup(func() { require.NoError(t, Setup(DefaultConfig())) })
+
+	recorder := httptest.NewRecorder()
+	LevelHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/admin/log-level",
+		strings.NewReader(`{"level":"debug"}`)))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	sugar := Logger()
+	assert.True(t, sugar.Desugar().Core().Enabled(zapcore.DebugLevel))
+
+	recorder = httptest.NewRecorder()
+	LevelHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/log-level", nil))
+	assert.JSONEq(t, `{"level":"debug"}`, recorder.Body.String())
+}
@@ -0,0 +1,113 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// формат времени в имени ротированного файла
+const backupTimeFormat = "20060102T150405.000000000"
+
+// rotatingFile файл лога с ротацией по размеру и по времени,
+// ротированный файл переименовывается в name.<время ротации>
+type rotatingFile struct {
+	opened     time.Time
+	file       *os.File
+	name       string
+	size       int64
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	mx         sync.Mutex
+}
+
+// функция открывает файл лога на дозапись, нулевые maxSize и interval отключают ротацию
+func openRotatingFile(name string, maxSize int64, interval time.Duration, maxBackups int) (*rotatingFile, error) {
+	file := &rotatingFile{name: name, maxSize: maxSize, interval: interval, maxBackups: maxBackups}
+	if err := file.open(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (file *rotatingFile) open() error {
+	var err error
+	file.file, err = os.OpenFile(file.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error when open log file %w", err)
+	}
+	info, err := file.file.Stat()
+	if err != nil {
+		file.file.Close()
+		return fmt.Errorf("error when stat log file %w", err)
+	}
+	file.size = info.Size()
+	file.opened = time.Now()
+	return nil
+}
+
+// Write метод записывает данные, предварительно ротируя файл если нужно
+func (file *rotatingFile) Write(data []byte) (int, error) {
+	file.mx.Lock()
+	defer file.mx.Unlock()
+
+	bySize := file.maxSize > 0 && file.size > 0 && file.size+int64(len(data)) > file.maxSize
+	byTime := file.interval > 0 && time.Since(file.opened) >= file.interval
+	if bySize || byTime {
+		if err := file.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := file.file.Write(data)
+	file.size += int64(n)
+	return n, err
+}
+
+// Sync метод сбрасывает данные файла на диск
+func (file *rotatingFile) Sync() error {
+	file.mx.Lock()
+	defer file.mx.Unlock()
+	return file.file.Sync()
+}
+
+// Close метод закрывает файл
+func (file *rotatingFile) Close() error {
+	file.mx.Lock()
+	defer file.mx.Unlock()
+	return file.file.Close()
+}
+
+// метод переименовывает текущий файл, открывает новый и удаляет лишние старые файлы
+func (file *rotatingFile) rotate() error {
+	if err := file.file.Close(); err != nil {
+		return fmt.Errorf("error when close log file %w", err)
+	}
+	backup := file.name + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(file.name, backup); err != nil {
+		return fmt.Errorf("error when rotate log file %w", err)
+	}
+	if err := file.open(); err != nil {
+		return err
+	}
+	if file.maxBackups == 0 {
+		return nil
+	}
+
+	// имена ротированных файлов упорядочены по времени ротации
+	backups, err := filepath.Glob(file.name + ".*")
+	if err != nil {
+		return fmt.Errorf("error when list log backups %w", err)
+	}
+	sort.Strings(backups)
+	for len(backups) > file.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("error when remove log backup %w", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
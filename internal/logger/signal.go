@@ -0,0 +1,29 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// LevelSignal сигнал переключения уровня логирования между debug и уровнем из конфигурации
+var LevelSignal os.Signal = syscall.SIGUSR1
+
+// WatchLevelSignal функция переключает уровень логирования по сигналу LevelSignal
+// до отмены ctx
+func WatchLevelSignal(ctx context.Context) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, LevelSignal)
+	defer signal.Stop(sig)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			level := ToggleDebug()
+			sugar := Logger()
+			sugar.Infof("log level changed to %s", level)
+		}
+	}
+}
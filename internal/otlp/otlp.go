@@ -0,0 +1,308 @@
+// Package otlp - пакет преобразования метрик OpenTelemetry (OTLP) в метрики сервера
+package otlp
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+// атрибуты ресурса используемые как префикс имени метрики
+var prefixAttributes = []string{"service.namespace", "service.name"}
+
+// Converter преобразует запросы экспорта OTLP в метрики сервера.
+// Gauge и немонотонные Sum сохраняются как gauge, монотонные Sum как counter.
+// Для накопительных (cumulative) Sum запоминается предыдущее значение ряда
+// и в хранилище передается приращение. Новое состояние ряда запоминается только
+// после сохранения его точки (Result.Stored), чтобы отклоненный запрос можно было повторить.
+type Converter struct {
+	// время создания, ряды начатые раньше не передают накопленное значение
+	started time.Time
+	// последние значения накопительных рядов
+	cumulative map[string]point
+	// значения немонотонных рядов с приращениями (delta)
+	upDown map[string]float64
+	// дробные остатки приращений counter с типом double
+	remainder map[string]float64
+	mx        sync.Mutex
+}
+
+type point struct {
+	start uint64
+	value float64
+}
+
+// изменения состояния рядов одного запроса
+type changes struct {
+	cumulative map[string]point
+	upDown     map[string]float64
+	remainder  map[string]float64
+}
+
+// Result результат преобразования запроса. Пока результат не закрыт методом Done,
+// преобразователь заблокирован, чтобы параллельные запросы одного ряда не считали
+// приращения от одного и того же предыдущего значения.
+type Result struct {
+	converter *Converter
+	changes   changes
+	// запоминание состояния ряда для каждой метрики, nil если состояния нет
+	commits  []func()
+	Message  string
+	Metrics  []api.Metrics
+	Rejected int64
+	done     bool
+}
+
+// Stored метод запоминает состояние ряда метрики Metrics[i], вызывается сразу
+// после ее сохранения. Если запрос прерван, повтор не сохранит приращения
+// уже записанных точек второй раз, а приращения остальных точек не потеряются.
+func (result *Result) Stored(i int) {
+	if !result.done && result.commits[i] != nil {
+		result.commits[i]()
+	}
+}
+
+// Done метод снимает блокировку преобразователя, повторный вызов ничего не делает
+func (result *Result) Done() {
+	if result.done {
+		return
+	}
+	result.done = true
+	result.converter.mx.Unlock()
+}
+
+func (result *Result) add(metric api.Metrics, commit func()) {
+	result.Metrics = append(result.Metrics, metric)
+	result.commits = append(result.commits, commit)
+}
+
+// NewConverter функция создания преобразователя метрик OTLP
+func NewConverter() *Converter {
+	return &Converter{
+		started:    time.Now(),
+		cumulative: make(map[string]point),
+		upDown:     make(map[string]float64),
+		remainder:  make(map[string]float64),
+	}
+}
+
+// Convert метод преобразует запрос экспорта в метрики сервера. Гистограммы
+// и summary не поддерживаются, их точки учитываются как отклоненные.
+// Состояние рядов меняется только вызовом Stored у результата, результат
+// нужно закрыть вызовом Done.
+func (converter *Converter) Convert(request *colmetricspb.ExportMetricsServiceRequest) *Result {
+	converter.mx.Lock()
+
+	result := &Result{
+		converter: converter,
+		changes: changes{
+			cumulative: make(map[string]point),
+			upDown:     make(map[string]float64),
+			remainder:  make(map[string]float64),
+		},
+	}
+	for _, resourceMetrics := range request.GetResourceMetrics() {
+		prefix, resource := resourceName(resourceMetrics.GetResource().GetAttributes())
+		for _, scopeMetrics := range resourceMetrics.GetScopeMetrics() {
+			for _, metric := range scopeMetrics.GetMetrics() {
+				name := series{name: prefix + api.SanitizeName(metric.GetName()), resource: resource}
+				switch data := metric.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					for _, dataPoint := range data.Gauge.GetDataPoints() {
+						if value, ok := pointValue(dataPoint); ok {
+							result.add(api.NewGauge(name.with(dataPoint.GetAttributes()), value), nil)
+						}
+					}
+				case *metricspb.Metric_Sum:
+					converter.sum(name, data.Sum, result)
+				case *metricspb.Metric_Histogram:
+					result.reject(len(data.Histogram.GetDataPoints()))
+				case *metricspb.Metric_ExponentialHistogram:
+					result.reject(len(data.ExponentialHistogram.GetDataPoints()))
+				case *metricspb.Metric_Summary:
+					result.reject(len(data.Summary.GetDataPoints()))
+				}
+			}
+		}
+	}
+	return result
+}
+
+func (result *Result) reject(points int) {
+	if points == 0 {
+		return
+	}
+	result.Rejected += int64(points)
+	result.Message = "histogram, exponential histogram and summary are not supported"
+}
+
+// метод преобразует точки Sum с учетом монотонности и temporality
+func (converter *Converter) sum(name series, sum *metricspb.Sum, result *Result) {
+	cumulative := sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	pending := &result.changes
+	for _, dataPoint := range sum.GetDataPoints() {
+		value, ok := pointValue(dataPoint)
+		if !ok {
+			continue
+		}
+		series := name.with(dataPoint.GetAttributes())
+		switch {
+		case !sum.GetIsMonotonic() && cumulative:
+			result.add(api.NewGauge(series, value), nil)
+		case !sum.GetIsMonotonic():
+			total, ok := pending.upDown[series]
+			if !ok {
+				total = converter.upDown[series]
+			}
+			total += value
+			pending.upDown[series] = total
+			result.add(api.NewGauge(series, total), func() { converter.upDown[series] = total })
+		case cumulative:
+			metric := converter.counter(series,
+				converter.cumulativeDelta(series, dataPoint.GetStartTimeUnixNano(), value, pending), pending)
+			last, remainder := pending.cumulative[series], pending.remainder[series]
+			result.add(metric, func() {
+				converter.cumulative[series] = last
+				converter.remainder[series] = remainder
+			})
+		default:
+			metric := converter.counter(series, value, pending)
+			remainder := pending.remainder[series]
+			result.add(metric, func() { converter.remainder[series] = remainder })
+		}
+	}
+}
+
+// метод возвращает приращение накопительного ряда с предыдущего значения.
+// Если изменилось время начала ряда или значение уменьшилось, ряд считается
+// перезапущенным и приращением является все значение. Для нового ряда
+// начатого до запуска сервера накопленное значение неизвестно откуда,
+// поэтому оно только запоминается.
+func (converter *Converter) cumulativeDelta(series string, start uint64, value float64, pending *changes) float64 {
+	prev, ok := pending.cumulative[series]
+	if !ok {
+		prev, ok = converter.cumulative[series]
+	}
+	pending.cumulative[series] = point{start: start, value: value}
+	switch {
+	case !ok && start != 0 && start >= uint64(converter.started.UnixNano()):
+		return value
+	case !ok:
+		return 0
+	case start != prev.start || value < prev.value:
+		return value
+	default:
+		return value - prev.value
+	}
+}
+
+// метод создает counter, дробная часть приращения переносится на следующую точку
+func (converter *Converter) counter(series string, delta float64, pending *changes) api.Metrics {
+	remainder, ok := pending.remainder[series]
+	if !ok {
+		remainder = converter.remainder[series]
+	}
+	delta += remainder
+	whole := math.Trunc(delta)
+	pending.remainder[series] = delta - whole
+	return api.NewCounter(series, int64(whole))
+}
+
+// функция возвращает значение точки, точки без значения пропускаются
+func pointValue(dataPoint *metricspb.NumberDataPoint) (float64, bool) {
+	if dataPoint.GetFlags()&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0 {
+		return 0, false
+	}
+	switch value := dataPoint.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		return value.AsDouble, true
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(value.AsInt), true
+	default:
+		return 0, false
+	}
+}
+
+// имя метрики с атрибутами ресурса, к которому добавляются атрибуты точки
+type series struct {
+	// атрибуты ресурса кроме префиксных
+	resource map[string]string
+	name     string
+}
+
+// функция возвращает префикс имени из атрибутов ресурса service.namespace и service.name
+// и остальные атрибуты ресурса
+func resourceName(attributes []*commonpb.KeyValue) (string, map[string]string) {
+	var prefix string
+	for _, key := range prefixAttributes {
+		for _, attribute := range attributes {
+			if attribute.GetKey() != key {
+				continue
+			}
+			if value, ok := attributeValue(attribute.GetValue()); ok && len(value) != 0 {
+				prefix += api.SanitizeName(value) + "_"
+			}
+		}
+	}
+	resource := make(map[string]string, len(attributes))
+	for _, attribute := range attributes {
+		if slices.Contains(prefixAttributes, attribute.GetKey()) {
+			continue
+		}
+		if value, ok := attributeValue(attribute.GetValue()); ok {
+			resource[attribute.GetKey()] = value
+		}
+	}
+	return prefix, resource
+}
+
+// метод добавляет к имени атрибуты ресурса и точки как в метриках prometheus:
+// атрибуты сортируются и переводятся в суффикс имени вида _key_value,
+// атрибут точки заменяет одноименный атрибут ресурса
+func (name series) with(attributes []*commonpb.KeyValue) string {
+	labels := maps.Clone(name.resource)
+	for _, attribute := range attributes {
+		if value, ok := attributeValue(attribute.GetValue()); ok {
+			labels[attribute.GetKey()] = value
+		}
+	}
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, api.SanitizeName(key)+"_"+api.SanitizeName(value))
+	}
+	sort.Strings(pairs)
+	var sb strings.Builder
+	sb.WriteString(name.name)
+	for _, pair := range pairs {
+		sb.WriteString("_")
+		sb.WriteString(pair)
+	}
+	return sb.String()
+}
+
+// функция возвращает строковое значение атрибута, массивы и вложенные атрибуты пропускаются
+func attributeValue(value *commonpb.AnyValue) (string, bool) {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue, true
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue), true
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10), true
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,183 @@
+package otlp
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+func attribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{
+		Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func request(metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource:     &resourcepb.Resource{Attributes: []*commonpb.KeyValue{attribute("service.name", "billing")}},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+	}}}
+}
+
+func sum(name string, monotonic bool, temporality metricspb.AggregationTemporality,
+	start uint64, value float64) *metricspb.Metric {
+	return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+		IsMonotonic:            monotonic,
+		AggregationTemporality: temporality,
+		DataPoints: []*metricspb.NumberDataPoint{{
+			StartTimeUnixNano: start,
+			Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+		}},
+	}}}
+}
+
+func values(result *Result) map[string]float64 {
+	got := make(map[string]float64, len(result.Metrics))
+	for _, metric := range result.Metrics {
+		switch metric.MType {
+		case api.Gauge:
+			got[metric.MType+"/"+metric.ID] = *metric.Value
+		case api.Counter:
+			got[metric.MType+"/"+metric.ID] = float64(*metric.Delta)
+		}
+	}
+	return got
+}
+
+// функция запоминает состояние всех рядов результата как после сохранения
+func storeAll(result *Result) {
+	for i := range result.Metrics {
+		result.Stored(i)
+	}
+	result.Done()
+}
+
+func TestConvert(t *testing.T) {
+	const (
+		delta      = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		cumulative = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	)
+	converter := NewConverter()
+	// ряд начат до запуска сервера, накопленное значение не учитывается
+	old := uint64(converter.started.Add(-time.Hour).UnixNano())
+	fresh := uint64(converter.started.Add(time.Second).UnixNano())
+
+	gauge := &metricspb.Metric{Name: "http.latency", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+		DataPoints: []*metricspb.NumberDataPoint{{
+			Attributes: []*commonpb.KeyValue{attribute("route", "/pay"), attribute("method", "GET")},
+			Value:      &metricspb.NumberDataPoint_AsDouble{AsDouble: 0.25},
+		}, {
+			Flags: uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK),
+		}},
+	}}}
+	histogram := &metricspb.Metric{Name: "size", Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+		DataPoints: []*metricspb.HistogramDataPoint{{}, {}},
+	}}}
+
+	result := converter.Convert(request(gauge, histogram,
+		sum("requests", true, delta, 0, 2.5),
+		sum("jobs", true, cumulative, old, 100),
+		sum("orders", true, cumulative, fresh, 7),
+		sum("queue", false, delta, 0, 3),
+		sum("connections", false, cumulative, old, 12)))
+	assert.Equal(t, map[string]float64{
+		"gauge/billing_http_latency_method_GET_route__pay": 0.25,
+		"counter/billing_requests":                         2,
+		"counter/billing_jobs":                             0,
+		"counter/billing_orders":                           7,
+		"gauge/billing_queue":                              3,
+		"gauge/billing_connections":                        12,
+	}, values(result))
+	assert.Equal(t, int64(2), result.Rejected)
+	assert.NotEmpty(t, result.Message)
+	storeAll(result)
+
+	result = converter.Convert(request(
+		sum("requests", true, delta, 0, 2.5),
+		sum("jobs", true, cumulative, old, 130),
+		// значение уменьшилось, счетчик источника перезапущен
+		sum("orders", true, cumulative, fresh, 3),
+		sum("queue", false, delta, 0, -1)))
+	assert.Equal(t, map[string]float64{
+		// дробные остатки приращений складываются
+		"counter/billing_requests": 3,
+		"counter/billing_jobs":     30,
+		"counter/billing_orders":   3,
+		"gauge/billing_queue":      2,
+	}, values(result))
+	assert.Zero(t, result.Rejected)
+	result.Done()
+}
+
+func TestConvertResourceAttributes(t *testing.T) {
+	converter := NewConverter()
+	result := converter.Convert(&colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{attribute("service.namespace", "shop"),
+			attribute("service.name", "billing"), attribute("host.name", "web1"), attribute("region", "eu")}},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+			Name: "queue",
+			Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{{
+				// атрибут точки заменяет одноименный атрибут ресурса
+				Attributes: []*commonpb.KeyValue{attribute("region", "us"), attribute("kind", "fast")},
+				Value:      &metricspb.NumberDataPoint_AsInt{AsInt: 4},
+			}}}},
+		}}}},
+	}}})
+	defer result.Done()
+	assert.Equal(t, map[string]float64{"gauge/shop_billing_queue_host_name_web1_kind_fast_region_us": 4}, values(result))
+}
+
+func TestConvertStored(t *testing.T) {
+	const cumulative = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	converter := NewConverter()
+	start := uint64(converter.started.Add(time.Second).UnixNano())
+	storeAll(converter.Convert(request(sum("jobs", true, cumulative, start, 10))))
+
+	// отклоненный запрос не меняет состояние рядов, повтор дает то же приращение
+	export := request(sum("jobs", true, cumulative, start, 25), sum("queue", false,
+		metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, 0, 4))
+	rejected := converter.Convert(export)
+	rejected.Done()
+	retry := converter.Convert(export)
+	assert.Equal(t, values(rejected), values(retry))
+	assert.Equal(t, map[string]float64{"counter/billing_jobs": 15, "gauge/billing_queue": 4}, values(retry))
+	storeAll(retry)
+
+	// сохранена только первая точка, повтор не учитывает ее приращение второй раз
+	partial := converter.Convert(request(sum("jobs", true, cumulative, start, 30), sum("orders", true, cumulative, start, 7)))
+	assert.Equal(t, map[string]float64{"counter/billing_jobs": 5, "counter/billing_orders": 7}, values(partial))
+	partial.Stored(0)
+	partial.Done()
+	result := converter.Convert(request(sum("jobs", true, cumulative, start, 30), sum("orders", true, cumulative, start, 7)))
+	assert.Equal(t, map[string]float64{"counter/billing_jobs": 0, "counter/billing_orders": 7}, values(result))
+	result.Done()
+}
+
+func TestConvertConcurrent(t *testing.T) {
+	const cumulative = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	converter := NewConverter()
+	start := uint64(converter.started.Add(time.Second).UnixNano())
+
+	// параллельные экспорты одного ряда не считают приращение дважды
+	var total atomic.Int64
+	var wg sync.WaitGroup
+	for value := 1; value <= 20; value++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := converter.Convert(request(sum("jobs", true, cumulative, start, 100)))
+			total.Add(*result.Metrics[0].Delta)
+			storeAll(result)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(100), total.Load())
+}
@@ -0,0 +1,363 @@
+package recording
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+// окно rate и increase по умолчанию
+const defaultWindow = time.Minute
+
+// функции выражений
+const (
+	FuncRate     string = "rate"
+	FuncIncrease string = "increase"
+	FuncSum      string = "sum"
+	FuncAvg      string = "avg"
+	FuncMin      string = "min"
+	FuncMax      string = "max"
+)
+
+var (
+	errDivisionByZero = errors.New("division by zero")
+	errNotEnough      = errors.New("not enough samples")
+)
+
+// данные для вычисления выражения
+type env struct {
+	metrics map[string]api.Metrics
+	history *history
+}
+
+// узел разобранного выражения
+type node interface {
+	eval(env env) (float64, error)
+}
+
+type number float64
+
+func (n number) eval(env) (float64, error) { return float64(n), nil }
+
+// значение метрики по имени
+type metricRef string
+
+func (ref metricRef) eval(env env) (float64, error) {
+	metric, ok := env.metrics[string(ref)]
+	if !ok {
+		return 0, fmt.Errorf("metric %s not found", ref)
+	}
+	return metricValue(metric), nil
+}
+
+type negative struct {
+	node node
+}
+
+func (n negative) eval(env env) (float64, error) {
+	value, err := n.node.eval(env)
+	return -value, err
+}
+
+type binary struct {
+	left  node
+	right node
+	op    byte
+}
+
+func (b binary) eval(env env) (float64, error) {
+	left, err := b.left.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	right, err := b.right.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	switch b.op {
+	case '+':
+		return left + right, nil
+	case '-':
+		return left - right, nil
+	case '*':
+		return left * right, nil
+	default:
+		if right == 0 {
+			return 0, errDivisionByZero
+		}
+		return left / right, nil
+	}
+}
+
+// rate и increase счетчика за окно по сохраненным значениям
+type counterFunc struct {
+	name   string
+	metric string
+	window time.Duration
+}
+
+func (f counterFunc) eval(env env) (float64, error) {
+	increase, elapsed, ok := env.history.increase(f.metric, f.window)
+	if !ok || elapsed <= 0 {
+		return 0, fmt.Errorf("%s(%s) %w", f.name, f.metric, errNotEnough)
+	}
+	if f.name == FuncIncrease {
+		return increase, nil
+	}
+	return increase / elapsed.Seconds(), nil
+}
+
+// агрегация значений метрик с именами подходящими под шаблон
+type aggregateFunc struct {
+	name    string
+	pattern string
+}
+
+func (f aggregateFunc) eval(env env) (float64, error) {
+	var result float64
+	var count int
+	for id, metric := range env.metrics {
+		if ok, _ := path.Match(f.pattern, id); !ok {
+			continue
+		}
+		value := metricValue(metric)
+		switch {
+		case count == 0:
+			result = value
+		case f.name == FuncMin:
+			result = min(result, value)
+		case f.name == FuncMax:
+			result = max(result, value)
+		default:
+			result += value
+		}
+		count++
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("%s(%s) no metrics match", f.name, f.pattern)
+	}
+	if f.name == FuncAvg {
+		result /= float64(count)
+	}
+	return result, nil
+}
+
+func metricValue(metric api.Metrics) float64 {
+	switch {
+	case metric.Value != nil:
+		return *metric.Value
+	case metric.Delta != nil:
+		return float64(*metric.Delta)
+	default:
+		return 0
+	}
+}
+
+// parser разбор выражения методом рекурсивного спуска:
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = factor { ("*" | "/") factor }
+//	factor = number | metric | func "(" metric [ "[" duration "]" ] ")" | "(" expr ")" | "-" factor
+type parser struct {
+	// счетчики используемые в rate и increase с наибольшим окном
+	counters map[string]time.Duration
+	input    string
+	pos      int
+}
+
+// parse функция разбирает выражение и возвращает счетчики для которых нужна история
+func parse(input string) (node, map[string]time.Duration, error) {
+	p := &parser{input: input, counters: make(map[string]time.Duration)}
+	expr, err := p.expr()
+	if err != nil {
+		return nil, nil, err
+	}
+	p.skipSpaces()
+	if p.pos != len(p.input) {
+		return nil, nil, fmt.Errorf("unexpected %q at %d", p.input[p.pos:], p.pos)
+	}
+	return expr, p.counters, nil
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// метод пропускает пробелы и проверяет следующий символ
+func (p *parser) accept(char byte) bool {
+	p.skipSpaces()
+	if p.pos < len(p.input) && p.input[p.pos] == char {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(char byte) error {
+	if !p.accept(char) {
+		return fmt.Errorf("expected %q at %d", char, p.pos)
+	}
+	return nil
+}
+
+func (p *parser) expr() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op byte
+		switch {
+		case p.accept('+'):
+			op = '+'
+		case p.accept('-'):
+			op = '-'
+		default:
+			return left, nil
+		}
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) term() (node, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op byte
+		switch {
+		case p.accept('*'):
+			op = '*'
+		case p.accept('/'):
+			op = '/'
+		default:
+			return left, nil
+		}
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) factor() (node, error) {
+	switch {
+	case p.accept('('):
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(')')
+	case p.accept('-'):
+		expr, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return negative{node: expr}, nil
+	}
+
+	p.skipSpaces()
+	if p.pos < len(p.input) && (isDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+		return p.number()
+	}
+	name := p.name()
+	if len(name) == 0 {
+		return nil, fmt.Errorf("expected metric at %d", p.pos)
+	}
+	if !p.accept('(') {
+		if strings.ContainsAny(name, "*?") {
+			return nil, fmt.Errorf("pattern %s allowed only in aggregation", name)
+		}
+		return metricRef(name), nil
+	}
+	return p.function(name)
+}
+
+func (p *parser) function(name string) (node, error) {
+	p.skipSpaces()
+	arg := p.name()
+	if len(arg) == 0 {
+		return nil, fmt.Errorf("%s expected metric at %d", name, p.pos)
+	}
+
+	var result node
+	switch name {
+	case FuncRate, FuncIncrease:
+		if strings.ContainsAny(arg, "*?") {
+			return nil, fmt.Errorf("%s does not support pattern %s", name, arg)
+		}
+		window := defaultWindow
+		if p.accept('[') {
+			end := strings.IndexByte(p.input[p.pos:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("expected ']' at %d", p.pos)
+			}
+			var err error
+			window, err = time.ParseDuration(strings.TrimSpace(p.input[p.pos : p.pos+end]))
+			if err != nil || window <= 0 {
+				return nil, fmt.Errorf("%s wrong window %q", name, p.input[p.pos:p.pos+end])
+			}
+			p.pos += end + 1
+		}
+		p.counters[arg] = max(p.counters[arg], window)
+		result = counterFunc{name: name, metric: arg, window: window}
+	case FuncSum, FuncAvg, FuncMin, FuncMax:
+		if _, err := path.Match(arg, ""); err != nil {
+			return nil, fmt.Errorf("%s wrong pattern %s", name, arg)
+		}
+		result = aggregateFunc{name: name, pattern: arg}
+	default:
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	return result, p.expect(')')
+}
+
+func (p *parser) number() (node, error) {
+	start := p.pos
+	for p.pos < len(p.input) {
+		char := p.input[p.pos]
+		exponent := (char == '+' || char == '-') && p.pos > start &&
+			(p.input[p.pos-1] == 'e' || p.input[p.pos-1] == 'E')
+		if !isDigit(char) && char != '.' && char != 'e' && char != 'E' && !exponent {
+			break
+		}
+		p.pos++
+	}
+	value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return nil, fmt.Errorf("wrong number %q", p.input[start:p.pos])
+	}
+	return number(value), nil
+}
+
+// метод читает имя метрики или шаблон имени
+func (p *parser) name() string {
+	start := p.pos
+	for p.pos < len(p.input) {
+		char := p.input[p.pos]
+		if !isDigit(char) && !unicode.IsLetter(rune(char)) &&
+			!strings.ContainsRune("_.:*?", rune(char)) {
+			break
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
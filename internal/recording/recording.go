@@ -0,0 +1,242 @@
+// Package recording - пакет правил записи вычисляемых метрик на сервере.
+// Правило вычисляет выражение по метрикам хранилища и записывает результат как gauge.
+package recording
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/repositories"
+)
+
+// интервал вычисления правил по умолчанию в секундах
+const evalInterval float64 = 10
+
+// Config правила записи из файла
+type Config struct {
+	Rules []Rule `json:"rules"`
+	// Interval интервал вычисления правил в секундах
+	Interval float64 `json:"interval,omitempty"`
+}
+
+// Rule правило записи: результат выражения Expr записывается в gauge Record
+type Rule struct {
+	Record string `json:"record"`
+	Expr   string `json:"expr"`
+}
+
+// LoadConfig функция читает правила записи из файла формата json
+func LoadConfig(filename string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Config{}, fmt.Errorf("error when read recording rules file %w", err)
+	}
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return Config{}, fmt.Errorf("error when unmarshal recording rules file %w", err)
+	}
+	err = cfg.Validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("error in recording rules file %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate метод проверяет правила и разбирает выражения
+func (cfg Config) Validate() error {
+	_, err := cfg.compile()
+	return err
+}
+
+// правило с разобранным выражением
+type compiled struct {
+	expr   node
+	record string
+}
+
+func (cfg Config) compile() ([]compiled, error) {
+	if cfg.Interval < 0 {
+		return nil, fmt.Errorf("interval must not be negative")
+	}
+	rules := make([]compiled, 0, len(cfg.Rules))
+	records := make(map[string]bool, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		if len(rule.Record) == 0 {
+			return nil, fmt.Errorf("rule without record name")
+		}
+		if records[rule.Record] {
+			return nil, fmt.Errorf("duplicate record %s", rule.Record)
+		}
+		records[rule.Record] = true
+		expr, _, err := parse(rule.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("record %s %w", rule.Record, err)
+		}
+		rules = append(rules, compiled{record: rule.Record, expr: expr})
+	}
+	return rules, nil
+}
+
+// Engine вычисляет правила записи по расписанию
+type Engine struct {
+	storage repositories.Repo
+	history *history
+	now     func() time.Time
+	logger  zap.SugaredLogger
+	rules   []compiled
+	// счетчики для rate и increase с наибольшим окном
+	counters map[string]time.Duration
+	interval time.Duration
+	mx       sync.Mutex
+}
+
+// NewEngine функция создания обработчика правил записи
+func NewEngine(cfg Config, storage repositories.Repo, logger zap.SugaredLogger) (*Engine, error) {
+	rules, err := cfg.compile()
+	if err != nil {
+		return nil, err
+	}
+	engine := &Engine{
+		storage:  storage,
+		history:  newHistory(),
+		now:      time.Now,
+		logger:   logger,
+		rules:    rules,
+		counters: make(map[string]time.Duration),
+		interval: time.Duration(evalInterval * float64(time.Second)),
+	}
+	if cfg.Interval != 0 {
+		engine.interval = time.Duration(cfg.Interval * float64(time.Second))
+	}
+	for _, rule := range cfg.Rules {
+		_, counters, _ := parse(rule.Expr)
+		for name, window := range counters {
+			engine.counters[name] = max(engine.counters[name], window)
+		}
+	}
+	return engine, nil
+}
+
+// Run метод вычисляет правила с интервалом из конфигурации до завершения контекста
+func (engine *Engine) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(engine.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			engine.logger.Info("stop recording rules evaluation")
+			return
+		case <-ticker.C:
+			err := engine.Evaluate(ctx)
+			if err != nil {
+				engine.logger.Warnf("error when evaluating recording rules %v", err)
+			}
+		}
+	}
+}
+
+// Evaluate метод один раз вычисляет все правила по порядку, результат правила
+// доступен следующим правилам. Правила которые не удалось вычислить,
+// например из-за отсутствия метрики, пропускаются.
+func (engine *Engine) Evaluate(ctx context.Context) error {
+	engine.mx.Lock()
+	defer engine.mx.Unlock()
+
+	metrics, err := engine.storage.GetAllMetrics(ctx, engine.logger)
+	if err != nil {
+		return fmt.Errorf("error when getting all metrics %w", err)
+	}
+
+	now := engine.now()
+	for name, window := range engine.counters {
+		if metric, ok := metrics.Metrics[name]; ok {
+			engine.history.add(name, now, metricValue(metric), window)
+		}
+	}
+
+	env := env{metrics: metrics.Metrics, history: engine.history}
+	for _, rule := range engine.rules {
+		value, err := rule.expr.eval(env)
+		if err != nil {
+			engine.logger.Debugf("skip record %s %v", rule.record, err)
+			continue
+		}
+		err = engine.storage.UpdateParam(ctx, false, api.Gauge, rule.record, value, engine.logger)
+		if err != nil {
+			return fmt.Errorf("error when update record %s %w", rule.record, err)
+		}
+		metrics.Metrics[rule.record] = api.Metrics{ID: rule.record, MType: api.Gauge, Value: &value}
+	}
+	return nil
+}
+
+type sample struct {
+	time  time.Time
+	value float64
+}
+
+// history значения счетчиков на момент вычисления правил
+type history struct {
+	samples map[string][]sample
+}
+
+func newHistory() *history {
+	return &history{samples: make(map[string][]sample)}
+}
+
+// метод сохраняет значение счетчика и удаляет значения старше окна,
+// одно значение до начала окна сохраняется как начальное
+func (h *history) add(name string, now time.Time, value float64, window time.Duration) {
+	samples := append(h.samples[name], sample{time: now, value: value})
+	start := now.Add(-window)
+	first := 0
+	for i := range samples {
+		if samples[i].time.After(start) {
+			break
+		}
+		first = i
+	}
+	h.samples[name] = samples[first:]
+}
+
+// метод возвращает прирост счетчика за окно и время за которое он посчитан.
+// Уменьшение значения считается сбросом счетчика.
+func (h *history) increase(name string, window time.Duration) (float64, time.Duration, bool) {
+	samples := h.samples[name]
+	if len(samples) < 2 {
+		return 0, 0, false
+	}
+	last := samples[len(samples)-1]
+	start := last.time.Add(-window)
+	first := 0
+	for i := range samples {
+		if samples[i].time.After(start) {
+			break
+		}
+		first = i
+	}
+	samples = samples[first:]
+	if len(samples) < 2 {
+		return 0, 0, false
+	}
+
+	var increase float64
+	for i := 1; i < len(samples); i++ {
+		delta := samples[i].value - samples[i-1].value
+		if delta < 0 {
+			// счетчик сброшен, считаем от нуля
+			delta = samples[i].value
+		}
+		increase += delta
+	}
+	return increase, last.time.Sub(samples[0].time), true
+}
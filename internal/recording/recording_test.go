@@ -0,0 +1,128 @@
+package recording
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/repositories/memstorage"
+)
+
+func TestExpr(t *testing.T) {
+	gauge := func(value float64) api.Metrics { return api.Metrics{MType: api.Gauge, Value: &value} }
+	counter := func(delta int64) api.Metrics { return api.Metrics{MType: api.Counter, Delta: &delta} }
+	env := env{
+		metrics: map[string]api.Metrics{
+			"TotalMemory":     gauge(1000),
+			"FreeMemory":      gauge(250),
+			"CPUutilization1": gauge(10),
+			"CPUutilization2": gauge(30),
+			"PollCount":       counter(7),
+		},
+		history: newHistory(),
+	}
+
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"TotalMemory - FreeMemory", 750},
+		{"(TotalMemory - FreeMemory) / TotalMemory * 100", 75},
+		{"-FreeMemory + 2 * 3", -244},
+		{"1.5e2 - PollCount", 143},
+		{"sum(CPUutilization*)", 40},
+		{"avg(CPUutilization*)", 20},
+		{"max(CPUutilization?) - min(CPUutilization?)", 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, _, err := parse(tt.expr)
+			require.NoError(t, err)
+			got, err := expr.eval(env)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.want, got, 1e-9)
+		})
+	}
+
+	for _, expr := range []string{"TotalMemory -", "foo(TotalMemory)", "rate(Poll*)",
+		"CPU*", "rate(PollCount[1x])", "(TotalMemory", "TotalMemory FreeMemory"} {
+		_, _, err := parse(expr)
+		assert.Error(t, err, expr)
+	}
+
+	for _, expr := range []string{"Missing + 1", "TotalMemory / (FreeMemory - 250)",
+		"sum(Missing*)", "rate(PollCount)"} {
+		node, _, err := parse(expr)
+		require.NoError(t, err)
+		_, err = node.eval(env)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestHistoryIncrease(t *testing.T) {
+	h := newHistory()
+	start := time.Unix(0, 0)
+	for i, value := range []float64{10, 20, 35, 5, 15} {
+		h.add("requests", start.Add(time.Duration(i)*10*time.Second), value, 20*time.Second)
+	}
+	// в окне 20 секунд значения 35, 5 (сброс счетчика) и 15
+	increase, elapsed, ok := h.increase("requests", 20*time.Second)
+	require.True(t, ok)
+	assert.Equal(t, 15.0, increase)
+	assert.Equal(t, 20*time.Second, elapsed)
+	assert.Len(t, h.samples["requests"], 3)
+
+	_, _, ok = h.increase("missing", time.Minute)
+	assert.False(t, ok)
+}
+
+func TestEngine(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	ctx := context.Background()
+	storage := memstorage.NewMemStorage()
+
+	engine, err := NewEngine(Config{Rules: []Rule{
+		{Record: "UsedMemory", Expr: "TotalMemory - FreeMemory"},
+		{Record: "UsedMemoryPercent", Expr: "UsedMemory / TotalMemory * 100"},
+		{Record: "PollCount_rate", Expr: "rate(PollCount[1m])"},
+		{Record: "PollCount_increase", Expr: "increase(PollCount)"},
+	}}, storage, logger)
+	require.NoError(t, err)
+	now := time.Unix(1000, 0)
+	engine.now = func() time.Time { return now }
+
+	require.NoError(t, storage.UpdateParam(ctx, false, api.Gauge, "TotalMemory", 1000.0, logger))
+	require.NoError(t, storage.UpdateParam(ctx, false, api.Gauge, "FreeMemory", 400.0, logger))
+	require.NoError(t, storage.UpdateParam(ctx, false, api.Counter, "PollCount", int64(10), logger))
+	require.NoError(t, engine.Evaluate(ctx))
+
+	used, err := storage.GetGaugeMetric(ctx, "UsedMemory", logger)
+	require.NoError(t, err)
+	assert.Equal(t, 600.0, used)
+	percent, err := storage.GetGaugeMetric(ctx, "UsedMemoryPercent", logger)
+	require.NoError(t, err)
+	assert.Equal(t, 60.0, percent)
+	// для rate нужно два значения счетчика
+	_, err = storage.GetGaugeMetric(ctx, "PollCount_rate", logger)
+	assert.Error(t, err)
+
+	now = now.Add(10 * time.Second)
+	require.NoError(t, storage.UpdateParam(ctx, false, api.Counter, "PollCount", int64(50), logger))
+	require.NoError(t, engine.Evaluate(ctx))
+	rate, err := storage.GetGaugeMetric(ctx, "PollCount_rate", logger)
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, rate)
+	increase, err := storage.GetGaugeMetric(ctx, "PollCount_increase", logger)
+	require.NoError(t, err)
+	assert.Equal(t, 50.0, increase)
+
+	_, err = NewEngine(Config{Rules: []Rule{{Record: "a", Expr: "b +"}}}, storage, logger)
+	assert.Error(t, err)
+	_, err = NewEngine(Config{Rules: []Rule{{Record: "a", Expr: "b"}, {Record: "a", Expr: "c"}}}, storage, logger)
+	assert.Error(t, err)
+}
@@ -198,3 +198,14 @@ func (dbstorage *DBStorage) GetGaugeMetric(ctx context.Context, metricID string,
 	}
 	return value, nil
 }
+
+// Check метод проверяет соединение с базой данных через существующий пул
+func (dbstorage *DBStorage) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	err := dbstorage.DB.PingContext(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot ping data base %w", err)
+	}
+	return nil
+}
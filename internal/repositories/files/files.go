@@ -5,8 +5,10 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -350,3 +352,19 @@ func (fs *Filestorage) GetAllMetrics(ctx context.Context, logger zap.SugaredLogg
 func (fs *Filestorage) CreateTables(ctx context.Context, logger zap.SugaredLogger) error {
 	return nil
 }
+
+// Check метод проверяет что в файл хранилища можно писать,
+// если файла еще нет проверяется что его можно создать
+func (fs *Filestorage) Check(ctx context.Context) error {
+	file, err := os.OpenFile(fs.Filename, os.O_WRONLY|os.O_APPEND, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.CreateTemp(filepath.Dir(fs.Filename), ".check-*")
+		if err == nil {
+			defer os.Remove(file.Name())
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error when open storage file for writing %w", err)
+	}
+	return file.Close()
+}
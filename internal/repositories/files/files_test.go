@@ -3,7 +3,9 @@ package files
 
 import (
 	"bufio"
+	"context"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/netzen86/collectmetrics/internal/api"
@@ -70,3 +72,28 @@ func TestConsumer_ReadMetric(t *testing.T) {
 		})
 	}
 }
+
+func TestFilestorage_Check(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		filename string
+		wantErr  bool
+	}{
+		{name: "new file", filename: filepath.Join(dir, "metrics.json")},
+		{name: "missing dir", filename: filepath.Join(dir, "missing", "metrics.json"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := &Filestorage{Filename: tt.filename}
+			if err := fs.Check(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("Filestorage.Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	// проверка не создает файл хранилища и не оставляет временных файлов
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Filestorage.Check() left files %v %v", entries, err)
+	}
+}
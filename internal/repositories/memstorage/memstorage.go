@@ -100,3 +100,8 @@ func (storage *MemStorage) GetGaugeMetric(ctx context.Context, metricID string,
 func (storage *MemStorage) CreateTables(ctx context.Context, logger zap.SugaredLogger) error {
 	return nil
 }
+
+// Check метод проверки готовности, хранилище в памяти готово всегда
+func (storage *MemStorage) Check(ctx context.Context) error {
+	return nil
+}
@@ -3,16 +3,79 @@ package repositories
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/netzen86/collectmetrics/internal/api"
 )
 
+// HealthChecker интерфейс проверки готовности компонента сервера,
+// Check возвращает ошибку если компонент не может обслуживать запросы
+type HealthChecker interface {
+	Check(ctx context.Context) error
+}
+
 type Repo interface {
+	HealthChecker
 	UpdateParam(ctx context.Context, cntSummed bool, metricType, metricName string, metricValue interface{}, srvlog zap.SugaredLogger) error
 	GetCounterMetric(ctx context.Context, metricID string, srvlog zap.SugaredLogger) (int64, error)
 	GetGaugeMetric(ctx context.Context, metricID string, srvlog zap.SugaredLogger) (float64, error)
 	GetAllMetrics(ctx context.Context, srvlog zap.SugaredLogger) (api.MetricsMap, error)
 	CreateTables(ctx context.Context, srvlog zap.SugaredLogger) error
 }
+
+// Tracked хранилище с учетом времени последнего обновления метрик
+type Tracked struct {
+	Repo
+	updated map[string]time.Time
+	mx      sync.RWMutex
+}
+
+// NewTracked функция оборачивает хранилище для учета времени обновления метрик
+func NewTracked(storage Repo) *Tracked {
+	return &Tracked{Repo: storage, updated: make(map[string]time.Time)}
+}
+
+// UpdateParam метод обновляет метрику в хранилище и запоминает время обновления
+func (storage *Tracked) UpdateParam(ctx context.Context, cntSummed bool, metricType, metricName string,
+	metricValue interface{}, srvlog zap.SugaredLogger) error {
+	err := storage.Repo.UpdateParam(ctx, cntSummed, metricType, metricName, metricValue, srvlog)
+	if err != nil {
+		return err
+	}
+	storage.mx.Lock()
+	storage.updated[metricType+"/"+metricName] = time.Now()
+	storage.mx.Unlock()
+	return nil
+}
+
+// LastUpdate метод возвращает время последнего обновления метрики,
+// нулевое время если метрика не обновлялась после запуска сервера
+func (storage *Tracked) LastUpdate(metricType, metricName string) time.Time {
+	storage.mx.RLock()
+	defer storage.mx.RUnlock()
+	return storage.updated[metricType+"/"+metricName]
+}
+
+// Wrapper интерфейс хранилища-обертки над другим хранилищем
+type Wrapper interface {
+	Unwrap() Repo
+}
+
+// Unwrap метод возвращает обернутое хранилище
+func (storage *Tracked) Unwrap() Repo {
+	return storage.Repo
+}
+
+// Unwrap функция снимает все обертки и возвращает исходное хранилище для проверки его типа
+func Unwrap(storage Repo) Repo {
+	for {
+		wrapper, ok := storage.(Wrapper)
+		if !ok {
+			return storage
+		}
+		storage = wrapper.Unwrap()
+	}
+}
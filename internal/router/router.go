@@ -7,36 +7,76 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/netzen86/collectmetrics/config"
+	"github.com/netzen86/collectmetrics/internal/auth"
 	"github.com/netzen86/collectmetrics/internal/handlers"
+	"github.com/netzen86/collectmetrics/internal/influx"
+	"github.com/netzen86/collectmetrics/internal/logger"
+	"github.com/netzen86/collectmetrics/internal/otlp"
 )
 
 func GetGateway(cfg config.ServerCfg, srvlog zap.SugaredLogger) chi.Router {
 
 	gw := chi.NewRouter()
 
-	gw.Use(handlers.WithLogging, handlers.AccecsList(cfg.TrustedSubnet))
+	gw.Use(handlers.Tracing, handlers.WithLogging, handlers.Instrument(cfg.SelfMetrics), handlers.AccecsList(cfg.TrustedSubnet))
 
 	gw.Route("/", func(gw chi.Router) {
 		gw.Post("/", handlers.BadRequest)
-		gw.Post("/update/", handlers.JSONUpdateMMHandle(
-			cfg.Storage, cfg.FileStoragePathDef, cfg.SignKeyString,
-			cfg.StoreInterval, cfg.PrivKey, srvlog))
-		gw.Post("/updates/", handlers.JSONUpdateMMHandle(
-			cfg.Storage, cfg.FileStoragePathDef, cfg.SignKeyString,
-			cfg.StoreInterval, cfg.PrivKey, srvlog))
-		gw.Post("/value/", handlers.JSONRetrieveOneHandle(cfg.Storage, cfg.SignKeyString, srvlog))
 		gw.Post("/update/{mType}/{mName}", handlers.BadRequest)
 		gw.Post("/update/{mType}/{mName}/", handlers.BadRequest)
-		gw.Post("/update/{mType}/{mName}/{mValue}", handlers.UpdateMHandle(cfg.Storage, srvlog))
-		gw.Post("/*", handlers.NotFound)
 
-		gw.Get("/ping", handlers.PingDB(cfg.DBconstring))
-		gw.Get("/value/{mType}/{mName}", handlers.RetrieveOneMHandle(cfg.Storage, srvlog))
-		gw.Get("/", handlers.RetrieveMHandle(cfg.Storage, srvlog))
-		gw.Get("/*", handlers.NotFound)
+		// проверки состояния и статика дашборда доступны без токена
+		gw.Get("/ping", handlers.PingDB(cfg.Storage))
+		gw.Get("/healthz", handlers.LivenessHandle())
+		gw.Get("/readyz", handlers.ReadinessHandle(cfg.Health))
+		gw.Handle("/static/*", handlers.StaticHandle())
+
+		// запись метрик, запросы обновления ограничиваются для каждого клиента
+		gw.Group(func(gw chi.Router) {
+			gw.Use(handlers.Authorize(cfg.Auth, auth.RoleWrite), handlers.RateLimit(cfg.Limiter))
+			gw.Post("/update/", handlers.JSONUpdateMMHandle(
+				cfg.Storage, cfg.FileStoragePathDef, cfg.SignKeyString,
+				cfg.StoreInterval, cfg.PrivKey, srvlog))
+			gw.Post("/updates/", handlers.JSONUpdateMMHandle(
+				cfg.Storage, cfg.FileStoragePathDef, cfg.SignKeyString,
+				cfg.StoreInterval, cfg.PrivKey, srvlog))
+			gw.Post("/update/{mType}/{mName}/{mValue}", handlers.UpdateMHandle(cfg.Storage, srvlog))
+			gw.Post("/v1/metrics", handlers.OTLPHandle(cfg.Storage, otlp.NewConverter(), srvlog))
+			gw.Post("/write", handlers.InfluxWriteHandle(cfg.Storage, influx.NewConfig(cfg.InfluxCounters), srvlog))
+		})
+
+		// чтение метрик и оповещений
+		gw.Group(func(gw chi.Router) {
+			gw.Use(handlers.Authorize(cfg.Auth, auth.RoleRead))
+			gw.Post("/value/", handlers.JSONRetrieveOneHandle(cfg.Storage, cfg.SignKeyString, srvlog))
+			gw.Get("/value/{mType}/{mName}", handlers.RetrieveOneMHandle(cfg.Storage, srvlog))
+			gw.Get("/", handlers.RetrieveMHandle(cfg.Storage, srvlog))
+			gw.Get("/metric/{mType}/{mName}", handlers.MetricPageHandle(cfg.Storage, srvlog))
+			gw.Get("/dashboard/data", handlers.DashboardDataHandle(cfg.Storage, srvlog))
+			gw.Get("/alerts", handlers.AlertsHandle(cfg.Alerts))
+		})
 
-		// Define the routes for serving profiling data
-		gw.Mount("/debug", middleware.Profiler())
+		// отладка: собственные метрики сервера и профилирование
+		gw.Group(func(gw chi.Router) {
+			gw.Use(handlers.Authorize(cfg.Auth, auth.RoleAdmin))
+			gw.Get("/internal/metrics", handlers.SelfMetricsHandle(cfg.SelfMetrics, cfg.Storage, srvlog))
+			// Define the routes for serving profiling data
+			gw.Mount("/debug", middleware.Profiler())
+		})
+
+		// администрирование: журнал аудита, уровень логирования и токены
+		gw.Group(func(gw chi.Router) {
+			gw.Use(handlers.Authorize(cfg.Auth, auth.RoleAdmin))
+			gw.Get("/audit", handlers.AuditHandle(cfg.Audit, srvlog))
+			// GET возвращает уровень логирования, PUT изменяет его
+			gw.Handle("/admin/log-level", logger.LevelHandler())
+			gw.Get("/admin/tokens", handlers.TokensListHandle(cfg.Auth))
+			gw.Post("/admin/tokens", handlers.TokenCreateHandle(cfg.Auth, srvlog))
+			gw.Delete("/admin/tokens/{id}", handlers.TokenRevokeHandle(cfg.Auth, srvlog))
+		})
+
+		gw.Post("/*", handlers.NotFound)
+		gw.Get("/*", handlers.NotFound)
 	},
 	)
 	return gw
@@ -0,0 +1,223 @@
+// Package selfmetrics - пакет собственных метрик сервера. Метрики хранятся
+// отдельно от метрик пользователей и отдаются в текстовом формате prometheus.
+package selfmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Namespace префикс имен собственных метрик сервера
+const Namespace = "collectmetrics_server"
+
+// типы метрик
+const (
+	kindCounter   string = "counter"
+	kindGauge     string = "gauge"
+	kindHistogram string = "histogram"
+)
+
+// имена метрик без префикса
+const (
+	httpRequests    string = "http_requests_total"
+	httpDuration    string = "http_request_duration_seconds"
+	grpcRequests    string = "grpc_requests_total"
+	grpcDuration    string = "grpc_request_duration_seconds"
+	storageDuration string = "storage_operation_duration_seconds"
+	storageErrors   string = "storage_errors_total"
+	storedSeries    string = "stored_series"
+)
+
+// экранирование значений меток в текстовом формате
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// границы интервалов гистограмм длительности в секундах
+var durationBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry собственные метрики сервера, методы безопасны для nil
+type Registry struct {
+	families map[string]*family
+	mx       sync.Mutex
+}
+
+type family struct {
+	series  map[string]*series
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+}
+
+type series struct {
+	labels  []string
+	buckets []uint64
+	value   float64
+	sum     float64
+	count   uint64
+}
+
+// NewRegistry функция создания набора собственных метрик сервера
+func NewRegistry() *Registry {
+	registry := &Registry{families: make(map[string]*family)}
+	registry.add(httpRequests, kindCounter, "HTTP requests by route, method and status code.",
+		"route", "method", "code")
+	registry.add(httpDuration, kindHistogram, "HTTP request duration by route and method.",
+		"route", "method")
+	registry.add(grpcRequests, kindCounter, "gRPC calls by method and status code.",
+		"method", "code")
+	registry.add(grpcDuration, kindHistogram, "gRPC call duration by method.",
+		"method")
+	registry.add(storageDuration, kindHistogram, "Storage operation duration by backend and operation.",
+		"backend", "operation")
+	registry.add(storageErrors, kindCounter, "Storage operation errors by backend and operation.",
+		"backend", "operation")
+	registry.add(storedSeries, kindGauge, "Metrics in storage by type.",
+		"type")
+	return registry
+}
+
+func (registry *Registry) add(name, kind, help string, labels ...string) {
+	metricFamily := &family{
+		series: make(map[string]*series),
+		name:   Namespace + "_" + name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+	}
+	if kind == kindHistogram {
+		metricFamily.buckets = durationBuckets
+	}
+	registry.families[name] = metricFamily
+}
+
+// ObserveHTTP метод учитывает HTTP запрос
+func (registry *Registry) ObserveHTTP(route, method string, code int, duration time.Duration) {
+	registry.update(httpRequests, 1, route, method, strconv.Itoa(code))
+	registry.update(httpDuration, duration.Seconds(), route, method)
+}
+
+// ObserveGRPC метод учитывает вызов gRPC
+func (registry *Registry) ObserveGRPC(method, code string, duration time.Duration) {
+	registry.update(grpcRequests, 1, method, code)
+	registry.update(grpcDuration, duration.Seconds(), method)
+}
+
+// ObserveStorage метод учитывает операцию хранилища и ее ошибку
+func (registry *Registry) ObserveStorage(backend, operation string, duration time.Duration, err error) {
+	registry.update(storageDuration, duration.Seconds(), backend, operation)
+	if err != nil {
+		registry.update(storageErrors, 1, backend, operation)
+	}
+}
+
+// SetStoredSeries метод задает число метрик типа metricType в хранилище
+func (registry *Registry) SetStoredSeries(metricType string, count int) {
+	registry.update(storedSeries, float64(count), metricType)
+}
+
+// метод изменяет ряд метрики: counter увеличивается на value,
+// gauge принимает значение value, в histogram добавляется наблюдение
+func (registry *Registry) update(name string, value float64, labels ...string) {
+	if registry == nil {
+		return
+	}
+	registry.mx.Lock()
+	defer registry.mx.Unlock()
+
+	metricFamily := registry.families[name]
+	key := strings.Join(labels, "\xff")
+	metricSeries, ok := metricFamily.series[key]
+	if !ok {
+		metricSeries = &series{labels: labels, buckets: make([]uint64, len(metricFamily.buckets))}
+		metricFamily.series[key] = metricSeries
+	}
+	switch metricFamily.kind {
+	case kindCounter:
+		metricSeries.value += value
+	case kindGauge:
+		metricSeries.value = value
+	case kindHistogram:
+		for i, bound := range metricFamily.buckets {
+			if value <= bound {
+				metricSeries.buckets[i]++
+			}
+		}
+		metricSeries.sum += value
+		metricSeries.count++
+	}
+}
+
+// WriteText метод записывает метрики в текстовом формате prometheus
+func (registry *Registry) WriteText(w io.Writer) error {
+	if registry == nil {
+		return nil
+	}
+	registry.mx.Lock()
+	defer registry.mx.Unlock()
+
+	names := make([]string, 0, len(registry.families))
+	for name := range registry.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := bufio.NewWriter(w)
+	for _, name := range names {
+		registry.families[name].write(buf)
+	}
+	return buf.Flush()
+}
+
+func (metricFamily *family) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metricFamily.name, metricFamily.help,
+		metricFamily.name, metricFamily.kind)
+
+	keys := make([]string, 0, len(metricFamily.series))
+	for key := range metricFamily.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		metricSeries := metricFamily.series[key]
+		labels := formatLabels(metricFamily.labels, metricSeries.labels)
+		if metricFamily.kind != kindHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", metricFamily.name, wrapLabels(labels), formatValue(metricSeries.value))
+			continue
+		}
+		for i, bound := range metricFamily.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", metricFamily.name,
+				wrapLabels(labels, `le="`+formatValue(bound)+`"`), metricSeries.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", metricFamily.name, wrapLabels(labels, `le="+Inf"`), metricSeries.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", metricFamily.name, wrapLabels(labels), formatValue(metricSeries.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", metricFamily.name, wrapLabels(labels), metricSeries.count)
+	}
+}
+
+// функция возвращает метки вида name="value" с экранированием значений
+func formatLabels(names, values []string) []string {
+	labels := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		labels = append(labels, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	return labels
+}
+
+func wrapLabels(labels []string, extra ...string) string {
+	labels = append(labels[:len(labels):len(labels)], extra...)
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,69 @@
+package selfmetrics
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/repositories"
+	"github.com/netzen86/collectmetrics/internal/repositories/memstorage"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.ObserveHTTP("/update/", "POST", 200, 3*time.Millisecond)
+	registry.ObserveHTTP("/update/", "POST", 200, 2*time.Second)
+	registry.ObserveGRPC("/server.Metric/AddMetric", "OK", time.Millisecond)
+	registry.SetStoredSeries(api.Gauge, 3)
+	registry.SetStoredSeries(api.Gauge, 5)
+
+	var buf bytes.Buffer
+	require.NoError(t, registry.WriteText(&buf))
+	text := buf.String()
+	for _, line := range []string{
+		"# TYPE collectmetrics_server_http_requests_total counter",
+		`collectmetrics_server_http_requests_total{route="/update/",method="POST",code="200"} 2`,
+		`collectmetrics_server_http_request_duration_seconds_bucket{route="/update/",method="POST",le="0.005"} 1`,
+		`collectmetrics_server_http_request_duration_seconds_bucket{route="/update/",method="POST",le="2.5"} 2`,
+		`collectmetrics_server_http_request_duration_seconds_bucket{route="/update/",method="POST",le="+Inf"} 2`,
+		`collectmetrics_server_http_request_duration_seconds_sum{route="/update/",method="POST"} 2.003`,
+		`collectmetrics_server_http_request_duration_seconds_count{route="/update/",method="POST"} 2`,
+		`collectmetrics_server_grpc_requests_total{method="/server.Metric/AddMetric",code="OK"} 1`,
+		`collectmetrics_server_stored_series{type="gauge"} 5`,
+	} {
+		assert.Contains(t, text, line+"\n")
+	}
+
+	// nil набор метрик ничего не учитывает
+	var none *Registry
+	none.ObserveHTTP("/", "GET", 200, time.Second)
+	assert.NoError(t, none.WriteText(&buf))
+}
+
+func TestStorage(t *testing.T) {
+	logger := *zap.NewNop().Sugar()
+	ctx := context.Background()
+	registry := NewRegistry()
+	base := memstorage.NewMemStorage()
+	storage := repositories.NewTracked(NewStorage(base, registry, "memory"))
+	assert.Same(t, base, repositories.Unwrap(storage))
+
+	require.NoError(t, storage.UpdateParam(ctx, false, api.Gauge, "Alloc", 1.5, logger))
+	_, err := storage.GetGaugeMetric(ctx, "Missing", logger)
+	require.Error(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, registry.WriteText(&buf))
+	assert.Contains(t, buf.String(),
+		`collectmetrics_server_storage_operation_duration_seconds_count{backend="memory",operation="update"} 1`)
+	assert.Contains(t, buf.String(),
+		`collectmetrics_server_storage_errors_total{backend="memory",operation="get_gauge"} 1`)
+	assert.NotContains(t, buf.String(),
+		`collectmetrics_server_storage_errors_total{backend="memory",operation="update"}`)
+}
@@ -0,0 +1,68 @@
+package selfmetrics
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/repositories"
+)
+
+// Storage хранилище с учетом длительности и ошибок операций
+type Storage struct {
+	repositories.Repo
+	registry *Registry
+	backend  string
+}
+
+// NewStorage функция оборачивает хранилище для учета операций,
+// backend имя типа хранилища в метках метрик
+func NewStorage(storage repositories.Repo, registry *Registry, backend string) *Storage {
+	return &Storage{Repo: storage, registry: registry, backend: backend}
+}
+
+// Unwrap метод возвращает обернутое хранилище
+func (storage *Storage) Unwrap() repositories.Repo {
+	return storage.Repo
+}
+
+func (storage *Storage) observe(operation string, start time.Time, err error) {
+	storage.registry.ObserveStorage(storage.backend, operation, time.Since(start), err)
+}
+
+// UpdateParam метод обновляет метрику в хранилище
+func (storage *Storage) UpdateParam(ctx context.Context, cntSummed bool, metricType, metricName string,
+	metricValue interface{}, srvlog zap.SugaredLogger) error {
+	start := time.Now()
+	err := storage.Repo.UpdateParam(ctx, cntSummed, metricType, metricName, metricValue, srvlog)
+	storage.observe("update", start, err)
+	return err
+}
+
+// GetCounterMetric метод возвращает значение counter
+func (storage *Storage) GetCounterMetric(ctx context.Context, metricID string,
+	srvlog zap.SugaredLogger) (int64, error) {
+	start := time.Now()
+	delta, err := storage.Repo.GetCounterMetric(ctx, metricID, srvlog)
+	storage.observe("get_counter", start, err)
+	return delta, err
+}
+
+// GetGaugeMetric метод возвращает значение gauge
+func (storage *Storage) GetGaugeMetric(ctx context.Context, metricID string,
+	srvlog zap.SugaredLogger) (float64, error) {
+	start := time.Now()
+	value, err := storage.Repo.GetGaugeMetric(ctx, metricID, srvlog)
+	storage.observe("get_gauge", start, err)
+	return value, err
+}
+
+// GetAllMetrics метод возвращает все метрики хранилища
+func (storage *Storage) GetAllMetrics(ctx context.Context, srvlog zap.SugaredLogger) (api.MetricsMap, error) {
+	start := time.Now()
+	metrics, err := storage.Repo.GetAllMetrics(ctx, srvlog)
+	storage.observe("get_all", start, err)
+	return metrics, err
+}
@@ -13,6 +13,8 @@ import (
 
 	"github.com/netzen86/collectmetrics/config"
 	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/audit"
+	"github.com/netzen86/collectmetrics/internal/graphite"
 	"github.com/netzen86/collectmetrics/internal/repositories/files"
 	"github.com/netzen86/collectmetrics/internal/utils"
 )
@@ -48,6 +50,11 @@ func RestoreM(ctx context.Context, serverCfg config.ServerCfg,
 		if err != nil {
 			return fmt.Errorf("error load metrics fom file %w", err)
 		}
+		// загруженные метрики попадают в журнал аудита как импорт из файла
+		ctx = audit.WithRequest(ctx, audit.Request{
+			Transport: audit.TransportRestore,
+			Endpoint:  serverCfg.FileStoragePathDef,
+		})
 		for _, metric := range metrics.Metrics {
 			if metric.MType == api.Gauge {
 				err := serverCfg.Storage.UpdateParam(ctx, false,
@@ -68,7 +75,8 @@ func RestoreM(ctx context.Context, serverCfg config.ServerCfg,
 }
 
 func GracefulSrv(sig chan os.Signal, serverCtx context.Context,
-	serverStopCtx context.CancelFunc, httpSrv *http.Server, gSRV *grpc.Server, srvlog zap.SugaredLogger) {
+	serverStopCtx context.CancelFunc, httpSrv *http.Server, gSRV *grpc.Server,
+	graphiteSrv *graphite.Listener, srvlog zap.SugaredLogger) {
 	<-sig
 	// Shutdown signal with grace period of 30 seconds
 	shutdownCtx, cancel := context.WithTimeout(serverCtx, 30*time.Second)
@@ -89,5 +97,6 @@ func GracefulSrv(sig chan os.Signal, serverCtx context.Context,
 		srvlog.Infof("error when graceful shutdown %w", err)
 	}
 	gSRV.Stop()
+	graphiteSrv.Stop()
 	serverStopCtx()
 }
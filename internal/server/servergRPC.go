@@ -2,14 +2,28 @@ package server
 
 import (
 	"context"
-	"log"
+	"net"
+	"strconv"
+	"time"
 
 	"github.com/netzen86/collectmetrics/config"
 	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/audit"
+	"github.com/netzen86/collectmetrics/internal/auth"
+	"github.com/netzen86/collectmetrics/internal/clientlimit"
+	"github.com/netzen86/collectmetrics/internal/health"
 	"github.com/netzen86/collectmetrics/internal/logger"
+	"github.com/netzen86/collectmetrics/internal/repositories"
 	"github.com/netzen86/collectmetrics/internal/repositories/files"
+	"github.com/netzen86/collectmetrics/internal/selfmetrics"
+	"github.com/netzen86/collectmetrics/internal/tracing"
 	pb "github.com/netzen86/collectmetrics/proto/server"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 type MetricsServer struct {
@@ -28,16 +42,33 @@ func (srv *MetricsServer) AddMetric(ctx context.Context, in *pb.AddMetricRequest
 	var delta int64
 	var value float64
 	response.Metric = &pb.Metrics{}
-	_, cntSummed := srv.serverCfg.Storage.(*files.Filestorage)
+	_, cntSummed := repositories.Unwrap(srv.serverCfg.Storage).(*files.Filestorage)
 
-	srvlog, err := logger.Logger()
-	if err != nil {
-		log.Fatalf("error when get logger %v", err)
-	}
+	srvlog := logger.Logger()
 
 	response.Metric.Id = in.Metric.Id
 	response.Metric.Mtype = in.Metric.Mtype
 
+	// проверяем доступ токена к метрике
+	err = auth.CheckMetrics(ctx, in.Metric.Id)
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	// метрика неизвестного типа или без имени не сохраняется и не учитывается в ограничении
+	if len(in.Metric.Id) == 0 || (in.Metric.Mtype != api.Counter && in.Metric.Mtype != api.Gauge) {
+		return nil, status.Error(codes.InvalidArgument, "wrong metric name or type")
+	}
+	// проверяем ограничение числа различных метрик клиента
+	err = clientlimit.CheckMetrics(ctx, in.Metric.Mtype+"/"+in.Metric.Id)
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	ctx = audit.WithRequest(ctx, audit.Request{
+		Client:    peerKey(ctx),
+		Transport: audit.TransportGRPC,
+		Endpoint:  pb.Metric_AddMetric_FullMethodName,
+	})
 	switch {
 	case in.Metric.Mtype == api.Counter:
 		err = srv.serverCfg.Storage.UpdateParam(ctx, cntSummed, in.Metric.Mtype,
@@ -68,14 +99,16 @@ func (srv *MetricsServer) GetMetric(ctx context.Context, in *pb.GetMetricRequest
 	var value float64
 	response.Metric = &pb.Metrics{}
 
-	srvlog, err := logger.Logger()
-	if err != nil {
-		log.Fatalf("error when get logger %v", err)
-	}
+	srvlog := logger.Logger()
 
 	response.Metric.Id = in.Name
 	response.Metric.Mtype = in.Type
 
+	err = auth.CheckMetrics(ctx, in.Name)
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
 	switch {
 	case in.Type == api.Counter:
 		delta, err = srv.serverCfg.Storage.GetCounterMetric(ctx, in.Name, srvlog)
@@ -103,10 +136,7 @@ func (srv *MetricsServer) ListMetricsName(ctx context.Context, in *pb.ListMetric
 	var err error
 	var metrics api.MetricsMap
 
-	srvlog, err := logger.Logger()
-	if err != nil {
-		log.Fatalf("error when get logger %v", err)
-	}
+	srvlog := logger.Logger()
 
 	metrics, err = srv.serverCfg.Storage.GetAllMetrics(ctx, srvlog)
 	if err != nil {
@@ -114,18 +144,106 @@ func (srv *MetricsServer) ListMetricsName(ctx context.Context, in *pb.ListMetric
 	}
 
 	for key := range metrics.Metrics {
+		// метрики вне префиксов токена не возвращаются
+		if !auth.AllowedMetric(ctx, key) {
+			continue
+		}
 		response.Name = append(response.Name, key)
 	}
 
 	return &response, err
 }
 
+// функция ограничивает частоту вызовов AddMetric для каждого клиента,
+// при превышении возвращает ResourceExhausted и заголовок retry-after
+func rateLimitInterceptor(limiter *clientlimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+		if info.FullMethod != pb.Metric_AddMetric_FullMethodName {
+			return handler(ctx, req)
+		}
+		client := peerKey(ctx)
+		ok, wait := limiter.Allow(client)
+		if !ok {
+			retryAfter := strconv.Itoa(clientlimit.RetryAfter(wait))
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter))
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %s s", retryAfter)
+		}
+		return handler(clientlimit.WithClient(ctx, limiter, client), req)
+	}
+}
+
+// роли необходимые для вызова методов, остальные методы доступны без токена
+var methodRoles = map[string]auth.Role{
+	pb.Metric_AddMetric_FullMethodName:       auth.RoleWrite,
+	pb.Metric_GetMetric_FullMethodName:       auth.RoleRead,
+	pb.Metric_ListMetricsName_FullMethodName: auth.RoleRead,
+}
+
+// функция проверяет токен из метаданных authorization и его роль для методов сервиса метрик,
+// токен сохраняется в контексте для проверки префиксов метрик
+func authInterceptor(store *auth.Store) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+		role, ok := methodRoles[info.FullMethod]
+		if store == nil || !ok {
+			return handler(ctx, req)
+		}
+		values := metadata.ValueFromIncomingContext(ctx, auth.MetadataKey)
+		if len(values) == 0 {
+			return nil, status.Error(codes.Unauthenticated, auth.ErrUnauthenticated.Error())
+		}
+		secret, ok := auth.BearerToken(values[0])
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, auth.ErrUnauthenticated.Error())
+		}
+		token, err := store.Authenticate(secret)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if !token.HasRole(role) {
+			return nil, status.Errorf(codes.PermissionDenied, "role %s required", role)
+		}
+		return handler(auth.WithToken(ctx, token), req)
+	}
+}
+
+// функция учитывает вызовы в собственных метриках сервера по методу и коду ответа
+func instrumentInterceptor(registry *selfmetrics.Registry) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		registry.ObserveGRPC(info.FullMethod, status.Code(err).String(), time.Since(start))
+		return resp, err
+	}
+}
+
+// функция возвращает ключ клиента для ограничений - IP адрес соединения
+func peerKey(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
 func GetgRPCSrv(srvCfg config.ServerCfg) *grpc.Server {
 	var metricSRV MetricsServer
 	metricSRV.serverCfg = &srvCfg
 	// создаём gRPC-сервер без зарегистрированной службы
-	s := grpc.NewServer()
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		tracing.UnaryServerInterceptor(),
+		instrumentInterceptor(srvCfg.SelfMetrics),
+		authInterceptor(srvCfg.Auth),
+		rateLimitInterceptor(srvCfg.Limiter)))
 	// регистрируем сервис
 	pb.RegisterMetricServer(s, &metricSRV)
+	// сервис проверки готовности сообщает то же состояние что и /readyz
+	healthpb.RegisterHealthServer(s, health.NewGRPCServer(srvCfg.Health, pb.Metric_ServiceDesc.ServiceName))
 	return s
 }
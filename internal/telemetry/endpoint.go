@@ -0,0 +1,171 @@
+package telemetry
+
+import (
+	"sync"
+	"time"
+)
+
+// значения автоматического выключателя по умолчанию
+const (
+	breakerThreshold   int           = 3
+	breakerOpenTimeout time.Duration = 30 * time.Second
+)
+
+// состояния автоматического выключателя сервера
+const (
+	BreakerClosed   string = "closed"
+	BreakerOpen     string = "open"
+	BreakerHalfOpen string = "half-open"
+)
+
+// EndpointState состояние сервера для страницы статуса
+type EndpointState struct {
+	OpenedAt    time.Time `json:"opened_at,omitempty"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+	State       string    `json:"state"`
+	LastError   string    `json:"last_error,omitempty"`
+	Failures    int       `json:"failures"`
+}
+
+// EndpointHealth учет доступности сервера с автоматическим выключателем.
+// После Threshold ошибок подряд выключатель размыкается и отправка на сервер
+// прекращается на OpenTimeout, затем пропускается одна пробная отправка:
+// при успехе выключатель замыкается, при ошибке снова размыкается.
+// Методы безопасны для nil.
+type EndpointHealth struct {
+	openedAt    time.Time
+	lastSuccess time.Time
+	state       string
+	lastError   string
+	openTimeout time.Duration
+	failures    int
+	threshold   int
+	// пробная отправка в состоянии half-open уже выполняется
+	probing bool
+	mx      sync.Mutex
+}
+
+// NewEndpointHealth функция создания учета доступности сервера,
+// нулевые значения заменяются значениями по умолчанию
+func NewEndpointHealth(threshold int, openTimeout time.Duration) *EndpointHealth {
+	health := &EndpointHealth{state: BreakerClosed}
+	health.SetBreaker(threshold, openTimeout)
+	return health
+}
+
+// SetBreaker метод меняет настройки выключателя, состояние сохраняется
+func (health *EndpointHealth) SetBreaker(threshold int, openTimeout time.Duration) {
+	if health == nil {
+		return
+	}
+	health.mx.Lock()
+	defer health.mx.Unlock()
+	if threshold <= 0 {
+		threshold = breakerThreshold
+	}
+	if openTimeout <= 0 {
+		openTimeout = breakerOpenTimeout
+	}
+	health.threshold = threshold
+	health.openTimeout = openTimeout
+}
+
+// Allow метод сообщает можно ли отправлять метрики на сервер.
+// В состоянии half-open разрешается только одна пробная отправка.
+func (health *EndpointHealth) Allow() bool {
+	if health == nil {
+		return true
+	}
+	health.mx.Lock()
+	defer health.mx.Unlock()
+	switch health.state {
+	case BreakerOpen:
+		if time.Since(health.openedAt) < health.openTimeout {
+			return false
+		}
+		health.state = BreakerHalfOpen
+		health.probing = true
+		return true
+	case BreakerHalfOpen:
+		if health.probing {
+			return false
+		}
+		health.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Success метод учитывает успешную отправку
+func (health *EndpointHealth) Success() {
+	if health == nil {
+		return
+	}
+	health.mx.Lock()
+	defer health.mx.Unlock()
+	health.close()
+	health.lastSuccess = time.Now()
+}
+
+// Responded метод учитывает ответ сервера с неповторяемой ошибкой,
+// например неверной подписью: сервер доступен и выключатель замыкается
+func (health *EndpointHealth) Responded(err error) {
+	if health == nil {
+		return
+	}
+	health.mx.Lock()
+	defer health.mx.Unlock()
+	health.close()
+	if err != nil {
+		health.lastError = err.Error()
+	}
+}
+
+func (health *EndpointHealth) close() {
+	health.failures = 0
+	health.state = BreakerClosed
+	health.probing = false
+}
+
+// Failure метод учитывает ошибку отправки
+func (health *EndpointHealth) Failure(err error) {
+	if health == nil {
+		return
+	}
+	health.mx.Lock()
+	defer health.mx.Unlock()
+	health.failures++
+	threshold := health.threshold
+	if threshold <= 0 {
+		threshold = breakerThreshold
+	}
+	if health.state == BreakerHalfOpen || health.failures >= threshold {
+		health.state = BreakerOpen
+		health.openedAt = time.Now()
+	}
+	health.probing = false
+	if err != nil {
+		health.lastError = err.Error()
+	}
+}
+
+// State метод возвращает текущее состояние сервера
+func (health *EndpointHealth) State() EndpointState {
+	if health == nil {
+		return EndpointState{State: BreakerClosed}
+	}
+	health.mx.Lock()
+	defer health.mx.Unlock()
+	state := EndpointState{
+		LastSuccess: health.lastSuccess,
+		State:       BreakerClosed,
+		LastError:   health.lastError,
+		Failures:    health.failures,
+	}
+	if health.state == BreakerOpen || health.state == BreakerHalfOpen {
+		state.State = health.state
+		state.OpenedAt = health.openedAt
+	}
+	return state
+}
@@ -0,0 +1,248 @@
+// Package telemetry - пакет для учета состояния агента: отправок, ошибок и работы сборщиков
+package telemetry
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+// имена метрик самодиагностики агента
+const (
+	AgentSends          string = "agent_sends"
+	AgentSendFailures   string = "agent_send_failures"
+	AgentSendRetries    string = "agent_send_retries"
+	AgentErrors         string = "agent_errors"
+	AgentQueueDepth     string = "agent_queue_depth"
+	AgentLastSuccess    string = "agent_last_success_timestamp"
+	AgentSendLatencyAvg string = "agent_send_latency_avg_seconds"
+	AgentSendLatencyMax string = "agent_send_latency_max_seconds"
+	AgentUptime         string = "agent_uptime_seconds"
+)
+
+// CollectorState состояние дополнительного сборщика метрик
+type CollectorState struct {
+	LastRun   time.Time     `json:"last_run"`
+	Name      string        `json:"name"`
+	LastError string        `json:"last_error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	Metrics   int           `json:"metrics"`
+	Errors    int64         `json:"errors"`
+}
+
+// Snapshot снимок состояния агента для страницы статуса
+type Snapshot struct {
+	Started     time.Time        `json:"started"`
+	LastSuccess time.Time        `json:"last_success"`
+	LastError   string           `json:"last_error,omitempty"`
+	Collectors  []CollectorState `json:"collectors"`
+	LastLatency time.Duration    `json:"last_latency"`
+	Sends       int64            `json:"sends"`
+	Failures    int64            `json:"failures"`
+	Retries     int64            `json:"retries"`
+	Errors      int64            `json:"errors"`
+	QueueDepth  int              `json:"queue_depth"`
+}
+
+// AgentStats счетчики самодиагностики агента, методы безопасны для nil
+type AgentStats struct {
+	started     time.Time
+	lastSuccess time.Time
+	queue       func() int
+	collectors  map[string]*CollectorState
+	lastError   string
+	lastLatency time.Duration
+	// значения накопленные с предыдущей отправки метрик самодиагностики
+	window   statsWindow
+	sends    int64
+	failures int64
+	retries  int64
+	errors   int64
+	mx       sync.Mutex
+}
+
+type statsWindow struct {
+	latencySum time.Duration
+	latencyMax time.Duration
+	latencyCnt int64
+	sends      int64
+	failures   int64
+	retries    int64
+	errors     int64
+}
+
+// NewAgentStats функция создания счетчиков самодиагностики
+func NewAgentStats() *AgentStats {
+	return &AgentStats{
+		started:    time.Now(),
+		collectors: make(map[string]*CollectorState),
+	}
+}
+
+// SetQueue метод задает функцию для получения глубины очереди метрик
+func (stats *AgentStats) SetQueue(queue func() int) {
+	if stats == nil {
+		return
+	}
+	stats.mx.Lock()
+	defer stats.mx.Unlock()
+	stats.queue = queue
+}
+
+// SendOK метод учитывает успешную отправку метрики
+func (stats *AgentStats) SendOK(latency time.Duration) {
+	if stats == nil {
+		return
+	}
+	stats.mx.Lock()
+	defer stats.mx.Unlock()
+	stats.sends++
+	stats.window.sends++
+	stats.lastSuccess = time.Now()
+	stats.lastLatency = latency
+	stats.window.latencySum += latency
+	stats.window.latencyCnt++
+	stats.window.latencyMax = max(stats.window.latencyMax, latency)
+}
+
+// SendFailed метод учитывает неудачную отправку метрики
+func (stats *AgentStats) SendFailed(err error) {
+	if stats == nil {
+		return
+	}
+	stats.mx.Lock()
+	defer stats.mx.Unlock()
+	stats.failures++
+	stats.window.failures++
+	if err != nil {
+		stats.lastError = err.Error()
+	}
+}
+
+// Retry метод учитывает повторную попытку отправки
+func (stats *AgentStats) Retry() {
+	if stats == nil {
+		return
+	}
+	stats.mx.Lock()
+	defer stats.mx.Unlock()
+	stats.retries++
+	stats.window.retries++
+}
+
+// Error метод учитывает ошибку агента не связанную с отправкой
+func (stats *AgentStats) Error(err error) {
+	if stats == nil {
+		return
+	}
+	stats.mx.Lock()
+	defer stats.mx.Unlock()
+	stats.errors++
+	stats.window.errors++
+	if err != nil {
+		stats.lastError = err.Error()
+	}
+}
+
+// CollectorDone метод запоминает результат опроса дополнительного сборщика
+func (stats *AgentStats) CollectorDone(name string, metrics int, duration time.Duration, err error) {
+	if stats == nil {
+		return
+	}
+	stats.mx.Lock()
+	defer stats.mx.Unlock()
+	state, ok := stats.collectors[name]
+	if !ok {
+		state = &CollectorState{Name: name}
+		stats.collectors[name] = state
+	}
+	state.LastRun = time.Now()
+	state.Metrics = metrics
+	state.Duration = duration
+	state.LastError = ""
+	if err != nil {
+		state.Errors++
+		state.LastError = err.Error()
+	}
+}
+
+// LastSuccess метод возвращает время последней успешной отправки
+// и время запуска агента
+func (stats *AgentStats) LastSuccess() (time.Time, time.Time) {
+	if stats == nil {
+		return time.Time{}, time.Time{}
+	}
+	stats.mx.Lock()
+	defer stats.mx.Unlock()
+	return stats.lastSuccess, stats.started
+}
+
+// Snapshot метод возвращает текущее состояние агента
+func (stats *AgentStats) Snapshot() Snapshot {
+	if stats == nil {
+		return Snapshot{}
+	}
+	stats.mx.Lock()
+	defer stats.mx.Unlock()
+
+	snapshot := Snapshot{
+		Started:     stats.started,
+		LastSuccess: stats.lastSuccess,
+		LastError:   stats.lastError,
+		LastLatency: stats.lastLatency,
+		Sends:       stats.sends,
+		Failures:    stats.failures,
+		Retries:     stats.retries,
+		Errors:      stats.errors,
+		Collectors:  make([]CollectorState, 0, len(stats.collectors)),
+	}
+	if stats.queue != nil {
+		snapshot.QueueDepth = stats.queue()
+	}
+	for _, state := range stats.collectors {
+		snapshot.Collectors = append(snapshot.Collectors, *state)
+	}
+	sort.Slice(snapshot.Collectors, func(i, j int) bool {
+		return snapshot.Collectors[i].Name < snapshot.Collectors[j].Name
+	})
+	return snapshot
+}
+
+// Metrics метод возвращает метрики самодиагностики agent_*,
+// счетчики содержат приращение с предыдущего вызова
+func (stats *AgentStats) Metrics() []api.Metrics {
+	if stats == nil {
+		return nil
+	}
+	stats.mx.Lock()
+	defer stats.mx.Unlock()
+
+	window := stats.window
+	stats.window = statsWindow{}
+
+	var latencyAvg float64
+	if window.latencyCnt != 0 {
+		latencyAvg = (window.latencySum / time.Duration(window.latencyCnt)).Seconds()
+	}
+	var queueDepth, lastSuccess float64
+	if stats.queue != nil {
+		queueDepth = float64(stats.queue())
+	}
+	if !stats.lastSuccess.IsZero() {
+		lastSuccess = float64(stats.lastSuccess.Unix())
+	}
+
+	return []api.Metrics{
+		api.NewCounter(AgentSends, window.sends),
+		api.NewCounter(AgentSendFailures, window.failures),
+		api.NewCounter(AgentSendRetries, window.retries),
+		api.NewCounter(AgentErrors, window.errors),
+		api.NewGauge(AgentQueueDepth, queueDepth),
+		api.NewGauge(AgentLastSuccess, lastSuccess),
+		api.NewGauge(AgentSendLatencyAvg, latencyAvg),
+		api.NewGauge(AgentSendLatencyMax, window.latencyMax.Seconds()),
+		api.NewGauge(AgentUptime, time.Since(stats.started).Seconds()),
+	}
+}
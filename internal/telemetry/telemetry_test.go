@@ -0,0 +1,91 @@
+package telemetry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+)
+
+func TestAgentStats(t *testing.T) {
+	stats := NewAgentStats()
+	stats.SetQueue(func() int { return 3 })
+	stats.SendOK(100 * time.Millisecond)
+	stats.SendOK(300 * time.Millisecond)
+	stats.SendFailed(errors.New("connection refused"))
+	stats.Retry()
+	stats.CollectorDone("exec", 2, time.Millisecond, errors.New("exit status 1"))
+
+	metrics := make(map[string]api.Metrics)
+	for _, metric := range stats.Metrics() {
+		metrics[metric.ID] = metric
+	}
+	assert.Equal(t, int64(2), *metrics[AgentSends].Delta)
+	assert.Equal(t, int64(1), *metrics[AgentSendFailures].Delta)
+	assert.Equal(t, int64(1), *metrics[AgentSendRetries].Delta)
+	assert.Equal(t, 3.0, *metrics[AgentQueueDepth].Value)
+	assert.InDelta(t, 0.2, *metrics[AgentSendLatencyAvg].Value, 1e-9)
+	assert.InDelta(t, 0.3, *metrics[AgentSendLatencyMax].Value, 1e-9)
+
+	// счетчики отдаются как приращение с прошлого вызова
+	for _, metric := range stats.Metrics() {
+		if metric.MType == api.Counter {
+			assert.Equal(t, int64(0), *metric.Delta, metric.ID)
+		}
+	}
+
+	snapshot := stats.Snapshot()
+	assert.Equal(t, int64(2), snapshot.Sends)
+	assert.Equal(t, "connection refused", snapshot.LastError)
+	assert.Equal(t, 3, snapshot.QueueDepth)
+	assert.Len(t, snapshot.Collectors, 1)
+	assert.Equal(t, "exit status 1", snapshot.Collectors[0].LastError)
+}
+
+func TestNilAgentStats(t *testing.T) {
+	var stats *AgentStats
+	stats.SendOK(time.Second)
+	stats.Error(errors.New("error"))
+	assert.Nil(t, stats.Metrics())
+	assert.Equal(t, Snapshot{}, stats.Snapshot())
+}
+
+func TestEndpointHealth(t *testing.T) {
+	health := NewEndpointHealth(2, 20*time.Millisecond)
+	assert.True(t, health.Allow())
+
+	health.Failure(errors.New("connection refused"))
+	assert.Equal(t, BreakerClosed, health.State().State)
+	health.Failure(errors.New("connection refused"))
+	assert.Equal(t, BreakerOpen, health.State().State)
+	assert.False(t, health.Allow())
+
+	// после таймаута пропускается одна пробная отправка
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, health.Allow())
+	assert.False(t, health.Allow())
+	assert.Equal(t, BreakerHalfOpen, health.State().State)
+
+	// ошибка пробной отправки снова размыкает выключатель
+	health.Failure(errors.New("connection refused"))
+	assert.Equal(t, BreakerOpen, health.State().State)
+
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, health.Allow())
+	health.Success()
+	state := health.State()
+	assert.Equal(t, BreakerClosed, state.State)
+	assert.Equal(t, 0, state.Failures)
+	assert.False(t, state.LastSuccess.IsZero())
+	assert.True(t, health.Allow())
+
+	// ответ сервера с неповторяемой ошибкой не размыкает выключатель
+	health.Failure(errors.New("connection refused"))
+	health.Responded(errors.New("400 Bad Request"))
+	health.Failure(errors.New("connection refused"))
+	assert.Equal(t, BreakerClosed, health.State().State)
+	assert.Equal(t, "connection refused", health.State().LastError)
+}
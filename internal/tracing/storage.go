@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/repositories"
+)
+
+// Storage хранилище со спаном на каждую операцию
+type Storage struct {
+	repositories.Repo
+	backend string
+}
+
+// NewStorage функция оборачивает хранилище для трассировки операций,
+// backend имя типа хранилища в атрибутах спанов
+func NewStorage(storage repositories.Repo, backend string) *Storage {
+	return &Storage{Repo: storage, backend: backend}
+}
+
+// Unwrap метод возвращает обернутое хранилище
+func (storage *Storage) Unwrap() repositories.Repo {
+	return storage.Repo
+}
+
+func (storage *Storage) start(ctx context.Context, operation string,
+	attrs ...attribute.KeyValue) (context.Context, func(error)) {
+	attrs = append(attrs, attribute.String("storage.backend", storage.backend))
+	ctx, span := Start(ctx, "storage."+operation, attrs...)
+	return ctx, func(err error) { End(span, err) }
+}
+
+// UpdateParam метод обновляет метрику в хранилище
+func (storage *Storage) UpdateParam(ctx context.Context, cntSummed bool, metricType, metricName string,
+	metricValue interface{}, srvlog zap.SugaredLogger) error {
+	ctx, end := storage.start(ctx, "UpdateParam",
+		attribute.String("metric.type", metricType), attribute.String("metric.id", metricName))
+	err := storage.Repo.UpdateParam(ctx, cntSummed, metricType, metricName, metricValue, srvlog)
+	end(err)
+	return err
+}
+
+// GetCounterMetric метод возвращает значение counter
+func (storage *Storage) GetCounterMetric(ctx context.Context, metricID string,
+	srvlog zap.SugaredLogger) (int64, error) {
+	ctx, end := storage.start(ctx, "GetCounterMetric", attribute.String("metric.id", metricID))
+	delta, err := storage.Repo.GetCounterMetric(ctx, metricID, srvlog)
+	end(err)
+	return delta, err
+}
+
+// GetGaugeMetric метод возвращает значение gauge
+func (storage *Storage) GetGaugeMetric(ctx context.Context, metricID string,
+	srvlog zap.SugaredLogger) (float64, error) {
+	ctx, end := storage.start(ctx, "GetGaugeMetric", attribute.String("metric.id", metricID))
+	value, err := storage.Repo.GetGaugeMetric(ctx, metricID, srvlog)
+	end(err)
+	return value, err
+}
+
+// GetAllMetrics метод возвращает все метрики хранилища
+func (storage *Storage) GetAllMetrics(ctx context.Context, srvlog zap.SugaredLogger) (api.MetricsMap, error) {
+	ctx, end := storage.start(ctx, "GetAllMetrics")
+	metrics, err := storage.Repo.GetAllMetrics(ctx, srvlog)
+	end(err)
+	return metrics, err
+}
+
+// CreateTables метод создает таблицы хранилища
+func (storage *Storage) CreateTables(ctx context.Context, srvlog zap.SugaredLogger) error {
+	ctx, end := storage.start(ctx, "CreateTables")
+	err := storage.Repo.CreateTables(ctx, srvlog)
+	end(err)
+	return err
+}
+
+// Check метод проверяет готовность хранилища
+func (storage *Storage) Check(ctx context.Context) error {
+	ctx, end := storage.start(ctx, "Check")
+	err := storage.Repo.Check(ctx)
+	end(err)
+	return err
+}
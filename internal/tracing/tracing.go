@@ -0,0 +1,102 @@
+// Package tracing - пакет трассировки OpenTelemetry для агента и сервера.
+// Контекст трассировки передается в заголовках http и метаданных gRPC
+// в формате W3C Trace Context, спаны пишутся в файл или на OTLP endpoint.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// имя инструментирующей библиотеки в спанах
+const tracerName = "github.com/netzen86/collectmetrics"
+
+// Config параметры экспорта спанов, если оба параметра пустые
+// спаны не записываются, но контекст трассировки передается дальше
+type Config struct {
+	// File файл для записи спанов в формате json
+	File string
+	// Endpoint адрес OTLP/HTTP приемника, например http://localhost:4318
+	Endpoint string
+}
+
+// Setup функция настраивает глобальные провайдер трассировки и пропагатор,
+// возвращает функцию которая отправляет накопленные спаны и закрывает экспорт
+func Setup(ctx context.Context, cfg Config, serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	var err error
+	switch {
+	case len(cfg.Endpoint) != 0:
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		if err != nil {
+			return nil, fmt.Errorf("error when create otlp trace exporter %w", err)
+		}
+	case len(cfg.File) != 0:
+		file, err = os.OpenFile(cfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("error when open trace file %w", err)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error when create file trace exporter %w", err)
+		}
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// Start функция начинает дочерний спан спана из ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End функция отмечает ошибку в спане если она есть и завершает спан
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// InjectHTTP функция добавляет контекст трассировки из ctx в заголовки запроса
+func InjectHTTP(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// ExtractHTTP функция возвращает ctx с контекстом трассировки из заголовков запроса
+func ExtractHTTP(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
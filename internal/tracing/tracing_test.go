@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/netzen86/collectmetrics/internal/api"
+	"github.com/netzen86/collectmetrics/internal/repositories/memstorage"
+)
+
+// функция подменяет глобальный провайдер на провайдер с записью спанов в память
+func setRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func TestHTTPPropagation(t *testing.T) {
+	recorder := setRecorder(t)
+
+	ctx, clientSpan := Start(context.Background(), "client")
+	header := http.Header{}
+	InjectHTTP(ctx, header)
+	clientSpan.End()
+	require.NotEmpty(t, header.Get("traceparent"))
+
+	_, serverSpan := Start(ExtractHTTP(context.Background(), header), "server")
+	End(serverSpan, errors.New("fail"))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, spans[0].SpanContext().TraceID(), spans[1].SpanContext().TraceID())
+	assert.Equal(t, spans[0].SpanContext().SpanID(), spans[1].Parent().SpanID())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+func TestGRPCInterceptors(t *testing.T) {
+	recorder := setRecorder(t)
+	ctx, parent := Start(context.Background(), "agent")
+
+	// клиент передает контекст трассировки в метаданных
+	var outgoing metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		outgoing, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	err := UnaryClientInterceptor()(ctx, "/server.Metric/AddMetric", nil, nil, nil, invoker)
+	require.NoError(t, err)
+	parent.End()
+	require.NotEmpty(t, outgoing.Get("traceparent"))
+
+	// сервер продолжает трассировку клиента
+	var handlerSpan trace.SpanContext
+	handler := func(ctx context.Context, req any) (any, error) {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		return nil, nil
+	}
+	incoming := metadata.NewIncomingContext(context.Background(), outgoing)
+	_, err = UnaryServerInterceptor()(incoming, nil,
+		&grpc.UnaryServerInfo{FullMethod: "/server.Metric/AddMetric"}, handler)
+	require.NoError(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	client, server := spans[0], spans[2]
+	assert.Equal(t, trace.SpanKindClient, client.SpanKind())
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+	assert.Equal(t, parent.SpanContext().TraceID(), server.SpanContext().TraceID())
+	assert.Equal(t, client.SpanContext().SpanID(), server.Parent().SpanID())
+	assert.Equal(t, server.SpanContext(), handlerSpan)
+}
+
+func TestStorage(t *testing.T) {
+	recorder := setRecorder(t)
+	logger := *zap.NewNop().Sugar()
+	storage := NewStorage(memstorage.NewMemStorage(), "memory")
+
+	ctx, parent := Start(context.Background(), "handler")
+	require.NoError(t, storage.UpdateParam(ctx, false, api.Gauge, "Alloc", 1.5, logger))
+	_, err := storage.GetCounterMetric(ctx, "missing", logger)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "storage.UpdateParam", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	require.Error(t, err)
+	assert.Equal(t, "storage.GetCounterMetric", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+func TestSetup(t *testing.T) {
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		shutdown, err := Setup(context.Background(), Config{}, "test")
+		require.NoError(t, err)
+		assert.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "spans.json")
+		shutdown, err := Setup(context.Background(), Config{File: file}, "test")
+		require.NoError(t, err)
+		_, span := Start(context.Background(), "collect")
+		span.End()
+		require.NoError(t, shutdown(context.Background()))
+
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"Name":"collect"`)
+		assert.Contains(t, string(data), `"Value":"test"`)
+	})
+}
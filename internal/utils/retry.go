@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// значения политики повторов по умолчанию
+const (
+	retryMaxAttempts int     = 4
+	retryBaseDelay   float64 = 1
+	retryMaxDelay    float64 = 8
+	retryJitter      float64 = 0.5
+)
+
+// RetryPolicy политика повторов с экспоненциальной задержкой,
+// задержки задаются в секундах
+type RetryPolicy struct {
+	// MaxAttempts максимальное число попыток включая первую
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	// BaseDelay задержка перед первым повтором, удваивается с каждым повтором
+	BaseDelay float64 `json:"base_delay,omitempty"`
+	// MaxDelay максимальная задержка между попытками
+	MaxDelay float64 `json:"max_delay,omitempty"`
+	// Jitter доля случайного отклонения задержки от 0 до 1
+	Jitter float64 `json:"jitter,omitempty"`
+}
+
+// PermanentError ошибка которую не нужно повторять
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Permanent функция помечает ошибку как неповторяемую
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent функция проверяет помечена ли ошибка как неповторяемая
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// RetryAfterError ошибка после которой повтор возможен не раньше чем через After,
+// например при ответе 429 или 503 с заголовком Retry-After
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryAfterError) Error() string { return e.Err.Error() }
+func (e *RetryAfterError) Unwrap() error { return e.Err }
+
+// DefaultRetryPolicy функция возвращает политику повторов по умолчанию
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: retryMaxAttempts,
+		BaseDelay:   retryBaseDelay,
+		MaxDelay:    retryMaxDelay,
+		Jitter:      retryJitter,
+	}
+}
+
+// WithDefaults метод заполняет незаданные значения значениями по умолчанию
+func (policy RetryPolicy) WithDefaults() RetryPolicy {
+	defaults := DefaultRetryPolicy()
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = defaults.MaxAttempts
+	}
+	if policy.BaseDelay == 0 {
+		policy.BaseDelay = defaults.BaseDelay
+	}
+	if policy.MaxDelay == 0 {
+		policy.MaxDelay = max(defaults.MaxDelay, policy.BaseDelay)
+	}
+	return policy
+}
+
+// Validate метод проверяет значения политики повторов
+func (policy RetryPolicy) Validate() error {
+	switch {
+	case policy.MaxAttempts < 0:
+		return fmt.Errorf("max attempts must not be negative, got %d", policy.MaxAttempts)
+	case policy.BaseDelay < 0 || policy.MaxDelay < 0:
+		return errors.New("retry delays must not be negative")
+	case policy.MaxDelay != 0 && policy.MaxDelay < policy.BaseDelay:
+		return fmt.Errorf("max delay %v less than base delay %v", policy.MaxDelay, policy.BaseDelay)
+	case policy.Jitter < 0 || policy.Jitter > 1:
+		return fmt.Errorf("jitter must be from 0 to 1, got %v", policy.Jitter)
+	}
+	return nil
+}
+
+// Retry метод выполняет функцию пока она не завершится успешно, не вернет
+// неповторяемую ошибку, не закончатся попытки или не будет отменен контекст.
+// Функции передается номер попытки. Задержка из RetryAfterError используется
+// если она больше расчетной, но не больше MaxDelay.
+func (policy RetryPolicy) Retry(ctx context.Context, op func(attempt int) error) error {
+	policy = policy.WithDefaults()
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = op(attempt)
+		if err == nil || IsPermanent(err) || attempt >= policy.MaxAttempts {
+			return err
+		}
+		delay := policy.Delay(attempt)
+		var retryAfter *RetryAfterError
+		if errors.As(err, &retryAfter) {
+			delay = max(delay, min(retryAfter.After, seconds(policy.MaxDelay)))
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Delay метод возвращает задержку перед повтором после попытки attempt,
+// задержка с учетом разброса не превышает MaxDelay
+func (policy RetryPolicy) Delay(attempt int) time.Duration {
+	delay := policy.BaseDelay * float64(uint64(1)<<min(attempt-1, 32))
+	delay = min(delay, policy.MaxDelay)
+	if policy.Jitter != 0 {
+		delay *= 1 + policy.Jitter*(2*rand.Float64()-1)
+	}
+	return seconds(min(delay, policy.MaxDelay))
+}
+
+// функция переводит секунды в time.Duration
+func seconds(delay float64) time.Duration {
+	return time.Duration(delay * float64(time.Second))
+}
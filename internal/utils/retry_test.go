@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: 0.001}
+	errTemp := errors.New("temporary")
+
+	t.Run("retries until success", func(t *testing.T) {
+		var attempts int
+		err := policy.Retry(context.Background(), func(attempt int) error {
+			attempts = attempt
+			if attempt < 2 {
+				return errTemp
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+	})
+
+	t.Run("stops at max attempts", func(t *testing.T) {
+		var attempts int
+		err := policy.Retry(context.Background(), func(attempt int) error {
+			attempts = attempt
+			return errTemp
+		})
+		assert.ErrorIs(t, err, errTemp)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("permanent error not retried", func(t *testing.T) {
+		var attempts int
+		err := policy.Retry(context.Background(), func(attempt int) error {
+			attempts = attempt
+			return Permanent(errTemp)
+		})
+		assert.True(t, IsPermanent(err))
+		assert.ErrorIs(t, err, errTemp)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("retry after", func(t *testing.T) {
+		start := time.Now()
+		err := policy.Retry(context.Background(), func(attempt int) error {
+			if attempt == 1 {
+				return &RetryAfterError{Err: errTemp, After: 50 * time.Millisecond}
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("retry after capped by max delay", func(t *testing.T) {
+		capped := RetryPolicy{MaxAttempts: 2, BaseDelay: 0.001, MaxDelay: 0.01}
+		start := time.Now()
+		err := capped.Retry(context.Background(), func(attempt int) error {
+			if attempt == 1 {
+				return &RetryAfterError{Err: errTemp, After: time.Hour}
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("cancel during retry after", func(t *testing.T) {
+		long := RetryPolicy{MaxAttempts: 2, BaseDelay: 1, MaxDelay: 3600}
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		var attempts int
+		start := time.Now()
+		err := long.Retry(ctx, func(attempt int) error {
+			attempts = attempt
+			return &RetryAfterError{Err: errTemp, After: time.Hour}
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.ErrorIs(t, err, errTemp)
+		assert.Equal(t, 1, attempts)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 1, MaxDelay: 5}
+	assert.Equal(t, time.Second, policy.Delay(1))
+	assert.Equal(t, 4*time.Second, policy.Delay(3))
+	assert.Equal(t, 5*time.Second, policy.Delay(10))
+
+	policy.Jitter = 0.5
+	for range 10 {
+		delay := policy.Delay(2)
+		assert.GreaterOrEqual(t, delay, time.Second)
+		assert.LessOrEqual(t, delay, 3*time.Second)
+	}
+	// после большого числа попыток разброс не выводит задержку за MaxDelay
+	for range 10 {
+		delay := policy.Delay(100)
+		assert.GreaterOrEqual(t, delay, 2500*time.Millisecond)
+		assert.LessOrEqual(t, delay, 5*time.Second)
+	}
+
+	assert.Error(t, RetryPolicy{MaxAttempts: -1}.Validate())
+	assert.Error(t, RetryPolicy{BaseDelay: 2, MaxDelay: 1}.Validate())
+	assert.Error(t, RetryPolicy{Jitter: 2}.Validate())
+	assert.NoError(t, DefaultRetryPolicy().Validate())
+}
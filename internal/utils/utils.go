@@ -115,12 +115,6 @@ func ChkFileExist(path string) bool {
 	return true
 }
 
-func WorkingDir() string {
-	// Working Directory
-	wd, _ := os.Getwd()
-	return wd
-}
-
 func RetryFunc(retrybuilder func() func() error) error {
 	ExpBackoff := backoff.NewExponentialBackOff()
 	ExpBackoff.InitialInterval = backoffII * time.Second
@@ -0,0 +1,195 @@
+// Дашборд метрик: сортировка и поиск в таблице, обновление значений и график метрики.
+// Не использует внешних библиотек, чтобы работать без доступа в интернет.
+var dashboard = (function () {
+    "use strict";
+
+    var refreshTable = 5000;
+    var refreshChart = 2000;
+    var maxPoints = 300;
+
+    function fetchData(query) {
+        return fetch("/dashboard/data" + (query || ""), {cache: "no-store"})
+            .then(function (response) {
+                if (!response.ok) {
+                    throw new Error(response.statusText);
+                }
+                return response.json();
+            });
+    }
+
+    function rowHTML(metric) {
+        var row = document.createElement("tr");
+        row.dataset.id = metric.id;
+        row.dataset.type = metric.type;
+        var link = document.createElement("a");
+        link.href = "/metric/" + encodeURIComponent(metric.type) + "/" + encodeURIComponent(metric.id);
+        link.textContent = metric.id;
+        var cells = [document.createElement("td"), document.createElement("td"),
+            document.createElement("td"), document.createElement("td")];
+        cells[0].appendChild(link);
+        cells[1].textContent = metric.type;
+        cells[2].className = "num";
+        cells.forEach(function (cell) { row.appendChild(cell); });
+        return row;
+    }
+
+    function setRow(row, metric) {
+        row.cells[2].textContent = metric.value;
+        row.cells[2].dataset.number = metric.number;
+        row.cells[3].textContent = metric.updated || "";
+        row.cells[3].dataset.updated = metric.updated || "";
+    }
+
+    function sortKey(row, key) {
+        switch (key) {
+        case "id":
+            return row.dataset.id.toLowerCase();
+        case "type":
+            return row.dataset.type;
+        case "number":
+            return parseFloat(row.cells[2].dataset.number);
+        default:
+            return row.cells[3].dataset.updated;
+        }
+    }
+
+    // таблица метрик с сортировкой по клику на заголовок и поиском по имени
+    function table(element, search) {
+        var body = element.tBodies[0];
+        var sortBy = "id";
+        var order = 1;
+
+        function sort() {
+            var rows = Array.prototype.slice.call(body.rows);
+            rows.sort(function (a, b) {
+                var x = sortKey(a, sortBy);
+                var y = sortKey(b, sortBy);
+                return x < y ? -order : x > y ? order : 0;
+            });
+            rows.forEach(function (row) { body.appendChild(row); });
+            Array.prototype.forEach.call(element.tHead.rows[0].cells, function (th) {
+                th.className = th.dataset.key === sortBy ? (order > 0 ? "asc" : "desc") : "";
+            });
+        }
+
+        function filter() {
+            var text = search.value.trim().toLowerCase();
+            var shown = 0;
+            Array.prototype.forEach.call(body.rows, function (row) {
+                var match = row.dataset.id.toLowerCase().indexOf(text) >= 0 ||
+                    row.dataset.type.indexOf(text) >= 0;
+                row.hidden = !match;
+                if (match) {
+                    shown++;
+                }
+            });
+            document.getElementById("count").textContent = shown + " metrics";
+        }
+
+        function refresh() {
+            fetchData().then(function (metrics) {
+                var rows = {};
+                Array.prototype.forEach.call(body.rows, function (row) {
+                    rows[row.dataset.type + "/" + row.dataset.id] = row;
+                });
+                metrics.forEach(function (metric) {
+                    var row = rows[metric.type + "/" + metric.id];
+                    if (!row) {
+                        row = rowHTML(metric);
+                        body.appendChild(row);
+                    }
+                    setRow(row, metric);
+                });
+                sort();
+                filter();
+            }).catch(function () {});
+        }
+
+        element.tHead.addEventListener("click", function (event) {
+            var key = event.target.dataset.key;
+            if (!key) {
+                return;
+            }
+            order = key === sortBy ? -order : 1;
+            sortBy = key;
+            sort();
+        });
+        search.addEventListener("input", filter);
+        sort();
+        setInterval(refresh, refreshTable);
+    }
+
+    function draw(canvas, points) {
+        var ctx = canvas.getContext("2d");
+        var pad = 50;
+        var width = canvas.width - pad - 10;
+        var height = canvas.height - 40;
+        ctx.clearRect(0, 0, canvas.width, canvas.height);
+        if (points.length === 0) {
+            return;
+        }
+
+        var minY = Math.min.apply(null, points.map(function (p) { return p.y; }));
+        var maxY = Math.max.apply(null, points.map(function (p) { return p.y; }));
+        if (minY === maxY) {
+            minY -= 1;
+            maxY += 1;
+        }
+        var minX = points[0].x;
+        var maxX = Math.max(points[points.length - 1].x, minX + 1);
+
+        ctx.strokeStyle = "#ccc";
+        ctx.fillStyle = "#555";
+        ctx.font = "11px sans-serif";
+        ctx.beginPath();
+        for (var i = 0; i <= 4; i++) {
+            var y = 10 + height * i / 4;
+            ctx.moveTo(pad, y);
+            ctx.lineTo(pad + width, y);
+            ctx.fillText(Number((maxY - (maxY - minY) * i / 4).toPrecision(4)), 2, y + 4);
+        }
+        ctx.stroke();
+        ctx.fillText(new Date(minX).toLocaleTimeString(), pad, canvas.height - 8);
+        ctx.fillText(new Date(maxX).toLocaleTimeString(), pad + width - 60, canvas.height - 8);
+
+        ctx.strokeStyle = "#1f77b4";
+        ctx.lineWidth = 2;
+        ctx.beginPath();
+        points.forEach(function (p, i) {
+            var x = pad + width * (p.x - minX) / (maxX - minX);
+            var y = 10 + height * (maxY - p.y) / (maxY - minY);
+            if (i === 0) {
+                ctx.moveTo(x, y);
+            } else {
+                ctx.lineTo(x, y);
+            }
+        });
+        ctx.stroke();
+    }
+
+    // график значений метрики, обновляемый опросом сервера
+    function chart(canvas, type, id, value, updated) {
+        var points = [];
+        var query = "?type=" + encodeURIComponent(type) + "&name=" + encodeURIComponent(id);
+
+        function refresh() {
+            fetchData(query).then(function (metrics) {
+                if (metrics.length === 0) {
+                    return;
+                }
+                value.textContent = metrics[0].value;
+                updated.textContent = metrics[0].updated || "";
+                points.push({x: Date.now(), y: metrics[0].number});
+                if (points.length > maxPoints) {
+                    points.shift();
+                }
+                draw(canvas, points);
+            }).catch(function () {});
+        }
+
+        refresh();
+        setInterval(refresh, refreshChart);
+    }
+
+    return {table: table, chart: chart};
+})();
@@ -0,0 +1,10 @@
+// Package web - пакет содержит шаблоны и статические файлы дашборда,
+// встроенные в бинарный файл сервера
+package web
+
+import "embed"
+
+// FS шаблоны страниц и статические файлы дашборда
+//
+//go:embed template/*.html static/*
+var FS embed.FS